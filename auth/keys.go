@@ -0,0 +1,74 @@
+// Package auth restricts access to streams to users presenting an API key entitled to them.
+package auth
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+)
+
+// Entitles an API key to every stream.
+const allStreams = "*"
+
+// The API keys permitted to consume streams.
+type KeyStore struct {
+	Keys    []*Key `yaml:"keys"`
+	byValue map[string]*Key
+}
+
+// An API key issued to a user, together with the names of the streams it may be used to consume and whether it may be
+// used to administer the service.
+type Key struct {
+	Name    string   `yaml:"name"`
+	Key     string   `yaml:"key"`
+	Streams []string `yaml:"streams"`
+	Admin   bool     `yaml:"admin"`
+}
+
+// Read and validate the key store held in the given file.
+func ReadKeyStore(path string) (*KeyStore, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyStore(data)
+}
+
+// Parse and validate a key store. Every key must have a name and a value, and no two keys may share either.
+func ParseKeyStore(data []byte) (*KeyStore, error) {
+	store := &KeyStore{}
+	if err := yaml.Unmarshal(data, store); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	store.byValue = make(map[string]*Key)
+	for i, key := range store.Keys {
+		if key.Name == "" || key.Key == "" {
+			return nil, fmt.Errorf("key %d must specify a name and key", i+1)
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("duplicate key name: %s", key.Name)
+		}
+		if store.byValue[key.Key] != nil {
+			return nil, fmt.Errorf("duplicate key: %s", key.Name)
+		}
+		names[key.Name] = true
+		store.byValue[key.Key] = key
+	}
+	return store, nil
+}
+
+// Return the key with the given value, or nil if no such key has been issued.
+func (s *KeyStore) Lookup(value string) *Key {
+	return s.byValue[value]
+}
+
+// Return true if the key may be used to consume the named stream.
+func (k *Key) Entitled(stream string) bool {
+	for _, entitled := range k.Streams {
+		if entitled == stream || entitled == allStreams {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const keyStoreDefinition = `
+keys:
+  - name: acme
+    key: acme-key
+    streams: [filings, officers]
+  - name: internal
+    key: internal-key
+    streams: ["*"]
+`
+
+func TestParseKeyStore(t *testing.T) {
+	Convey("When a key store is parsed", t, func() {
+		actual, err := ParseKeyStore([]byte(keyStoreDefinition))
+		Convey("Then every key should be held", func() {
+			So(err, ShouldBeNil)
+			So(actual.Keys, ShouldHaveLength, 2)
+			So(actual.Lookup("acme-key"), ShouldResemble, &Key{Name: "acme", Key: "acme-key", Streams: []string{"filings", "officers"}})
+			So(actual.Lookup("internal-key").Name, ShouldEqual, "internal")
+			So(actual.Lookup("unknown-key"), ShouldBeNil)
+		})
+	})
+}
+
+func TestReadKeyStore(t *testing.T) {
+	Convey("Given a key store file", t, func() {
+		path := filepath.Join(t.TempDir(), "keys.yaml")
+		_ = ioutil.WriteFile(path, []byte(keyStoreDefinition), 0600)
+		Convey("When the key store is read", func() {
+			actual, err := ReadKeyStore(path)
+			Convey("Then every key should be held", func() {
+				So(err, ShouldBeNil)
+				So(actual.Keys, ShouldHaveLength, 2)
+			})
+		})
+		Convey("When a key store that does not exist is read", func() {
+			actual, err := ReadKeyStore(filepath.Join(t.TempDir(), "missing.yaml"))
+			Convey("Then an error should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfKeyStoreInvalid(t *testing.T) {
+	Convey("When a key store with a key without a value is parsed", t, func() {
+		_, err := ParseKeyStore([]byte("keys:\n  - name: acme\n"))
+		Convey("Then an error should be returned", func() {
+			So(err.Error(), ShouldEqual, "key 1 must specify a name and key")
+		})
+	})
+	Convey("When a key store with duplicate key names is parsed", t, func() {
+		_, err := ParseKeyStore([]byte("keys:\n  - name: acme\n    key: one\n  - name: acme\n    key: two\n"))
+		Convey("Then an error should be returned", func() {
+			So(err.Error(), ShouldEqual, "duplicate key name: acme")
+		})
+	})
+	Convey("When a key store with duplicate key values is parsed", t, func() {
+		_, err := ParseKeyStore([]byte("keys:\n  - name: acme\n    key: one\n  - name: other\n    key: one\n"))
+		Convey("Then an error should be returned without revealing the key", func() {
+			So(err.Error(), ShouldEqual, "duplicate key: other")
+		})
+	})
+}
+
+func TestKeyEntitlements(t *testing.T) {
+	Convey("Given a key entitled to the filings stream", t, func() {
+		key := &Key{Name: "acme", Key: "acme-key", Streams: []string{"filings"}}
+		Convey("Then it should be entitled to the filings stream only", func() {
+			So(key.Entitled("filings"), ShouldBeTrue)
+			So(key.Entitled("officers"), ShouldBeFalse)
+		})
+	})
+	Convey("Given a key entitled to every stream", t, func() {
+		key := &Key{Name: "internal", Key: "internal-key", Streams: []string{"*"}}
+		Convey("Then it should be entitled to any stream", func() {
+			So(key.Entitled("officers"), ShouldBeTrue)
+		})
+	})
+}
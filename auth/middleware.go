@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"github.com/companieshouse/chs.go/log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	authorizationHeader = "Authorization"
+	basicScheme         = "Basic"
+	bearerScheme        = "Bearer"
+	msgMissingKey       = "API key missing"
+	msgUnsupported      = "authorization scheme not supported"
+	msgInvalidKey       = "API key invalid"
+	msgNotEntitled      = "API key not entitled to stream"
+	msgNotAdmin         = "API key not permitted to administer the service"
+)
+
+// Identifies the API key of an authenticated request in its context.
+type keyContextKey struct{}
+
+// Returns the API key with the given value, or nil if no such key has been issued.
+type Authenticatable interface {
+	Lookup(value string) *Key
+}
+
+// Rejects requests for streams that do not carry an API key entitled to the stream, and requests for administrative
+// paths that do not carry an admin key. Requests for other paths, e.g. health checks, are passed through unchanged.
+type Middleware struct {
+	keys       Authenticatable
+	streams    map[string]string
+	patterns   []*regexp.Regexp
+	admin      map[string]bool
+	serialiser transformer.Marshallable
+	logger     logger.Logger
+}
+
+// Construct a new Middleware instance.
+func NewMiddleware(keys Authenticatable, logger logger.Logger) *Middleware {
+	return &Middleware{
+		keys:       keys,
+		streams:    make(map[string]string),
+		admin:      make(map[string]bool),
+		serialiser: jsonproducer.Instance(),
+		logger:     logger,
+	}
+}
+
+// Require an API key entitled to the named stream for requests to the given path.
+func (m *Middleware) WithStream(path string, name string) *Middleware {
+	m.streams[path] = name
+	return m
+}
+
+// Require an API key for requests to the given path, on which several streams are served, leaving the handler to
+// check the key is entitled to each stream as it is requested.
+func (m *Middleware) WithStreams(path string) *Middleware {
+	m.streams[path] = ""
+	return m
+}
+
+// Require an API key for requests to every path matching the given pattern, e.g. paths carrying a company number, on
+// which several streams are served, leaving the handler to check the key is entitled to each stream.
+func (m *Middleware) WithStreamsPattern(pattern *regexp.Regexp) *Middleware {
+	m.patterns = append(m.patterns, pattern)
+	return m
+}
+
+// Require an API key permitted to administer the service for requests to the given path, e.g. metrics and the
+// connections held by each client.
+func (m *Middleware) WithAdminPath(path string) *Middleware {
+	m.admin[path] = true
+	return m
+}
+
+// Wrap the given handler so that it is only called for requests that may access the stream or administrative path
+// requested.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if m.admin[request.URL.Path] {
+			key, ok := m.authenticate(writer, request, "")
+			if !ok {
+				return
+			}
+			if !key.Admin {
+				m.reject(writer, request, http.StatusForbidden, msgNotAdmin, "", key)
+				return
+			}
+			next.ServeHTTP(writer, request)
+			return
+		}
+		stream, ok := m.stream(request.URL.Path)
+		if !ok {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		key, ok := m.authenticate(writer, request, stream)
+		if !ok {
+			return
+		}
+		if stream != "" && !key.Entitled(stream) {
+			m.reject(writer, request, http.StatusForbidden, msgNotEntitled, stream, key)
+			return
+		}
+		next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), keyContextKey{}, key)))
+	})
+}
+
+// Return the API key the request was authenticated with, or nil if the request has not been authenticated.
+func KeyFromContext(ctx context.Context) *Key {
+	key, _ := ctx.Value(keyContextKey{}).(*Key)
+	return key
+}
+
+// Return the key the request carries, or reject the request as unauthorised and return false if it carries none or
+// one that has not been issued.
+func (m *Middleware) authenticate(writer http.ResponseWriter, request *http.Request, stream string) (*Key, bool) {
+	value, supported := apiKey(request)
+	if !supported {
+		m.reject(writer, request, http.StatusUnauthorized, msgUnsupported, stream, nil)
+		return nil, false
+	}
+	if value == "" {
+		m.reject(writer, request, http.StatusUnauthorized, msgMissingKey, stream, nil)
+		return nil, false
+	}
+	key := m.keys.Lookup(value)
+	if key == nil {
+		m.reject(writer, request, http.StatusUnauthorized, msgInvalidKey, stream, nil)
+		return nil, false
+	}
+	return key, true
+}
+
+// Return the name of the stream served on the given path, which is empty if several streams are served on it, and
+// false if the path does not serve streams.
+func (m *Middleware) stream(path string) (string, bool) {
+	if name, ok := m.streams[path]; ok {
+		return name, true
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(path) {
+			return "", true
+		}
+	}
+	return "", false
+}
+
+func (m *Middleware) reject(writer http.ResponseWriter, request *http.Request, status int, msg string, stream string, key *Key) {
+	data := log.Data{"stream": stream, "status": status}
+	if key != nil {
+		data["key_name"] = key.Name
+	}
+	m.logger.InfoR(request, msg, data)
+	if status == http.StatusUnauthorized {
+		writer.Header().Set("WWW-Authenticate", basicScheme)
+	}
+	body, err := m.serialiser.Marshal(&json.AuthError{Error: msg, Stream: stream})
+	if err != nil {
+		m.logger.ErrorR(request, err)
+		writer.WriteHeader(status)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_, _ = writer.Write(body)
+}
+
+// Return the API key carried by the value of an Authorization header, for transports other than HTTP that pass the
+// header on in their own form, e.g. as gRPC metadata.
+func KeyFromAuthorization(header string) string {
+	value, _ := apiKey(&http.Request{Header: http.Header{authorizationHeader: {header}}})
+	return value
+}
+
+// Return the API key carried by the request, either as the username of basic credentials, as issued to users of the
+// public streaming API, as a bearer token or as the whole value of the Authorization header, and false if the header
+// gives credentials of any other scheme.
+func apiKey(request *http.Request) (string, bool) {
+	if username, _, ok := request.BasicAuth(); ok {
+		return username, true
+	}
+	header := strings.TrimSpace(request.Header.Get(authorizationHeader))
+	scheme, credentials, found := strings.Cut(header, " ")
+	if !found {
+		return header, true
+	}
+	if strings.EqualFold(scheme, bearerScheme) {
+		return strings.TrimSpace(credentials), true
+	}
+	// Malformed basic credentials carry no key rather than one of an unsupported scheme
+	return "", strings.EqualFold(scheme, basicScheme)
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"github.com/companieshouse/chs.go/log"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+type mockLogger struct {
+	mock.Mock
+}
+
+func TestCreateNewMiddleware(t *testing.T) {
+	Convey("When a new middleware instance is constructed", t, func() {
+		keys := &KeyStore{}
+		logger := &mockLogger{}
+		actual := NewMiddleware(keys, logger).WithStream("/filings", "filings")
+		Convey("Then a new middleware instance should be returned", func() {
+			So(actual.keys, ShouldEqual, keys)
+			So(actual.logger, ShouldEqual, logger)
+			So(actual.serialiser, ShouldNotBeNil)
+			So(actual.streams, ShouldResemble, map[string]string{"/filings": "filings"})
+			So(actual.admin, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestAuthenticateStreamRequests(t *testing.T) {
+	Convey("Given a middleware protecting the filings and officers streams", t, func() {
+		keys, _ := ParseKeyStore([]byte(keyStoreDefinition + "  - name: limited\n    key: limited-key\n    streams: [charges]\n"))
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything)
+		middleware := NewMiddleware(keys, logger).
+			WithStream("/prefix/filings", "filings").
+			WithStream("/prefix/officers", "officers").
+			WithStreams("/prefix/socket").
+			WithStreamsPattern(regexp.MustCompile("^/prefix/companies/[^/]+/events$"))
+		called := false
+		var authenticated *Key
+		handler := middleware.Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			called = true
+			authenticated = KeyFromContext(request.Context())
+		}))
+		serve := func(path string, authorization string) *httptest.ResponseRecorder {
+			request := httptest.NewRequest(http.MethodGet, path, nil)
+			if authorization != "" {
+				request.Header.Set("Authorization", authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			return recorder
+		}
+		Convey("When a request carrying an entitled key as basic credentials is received", func() {
+			request := httptest.NewRequest(http.MethodGet, "/prefix/filings?timepoint=1", nil)
+			request.SetBasicAuth("acme-key", "")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			Convey("Then the request should be passed on with the key it was authenticated with", func() {
+				So(called, ShouldBeTrue)
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(authenticated.Name, ShouldEqual, "acme")
+			})
+		})
+		Convey("When a request carrying an entitled key as the Authorization header is received", func() {
+			recorder := serve("/prefix/officers", "internal-key")
+			Convey("Then the request should be passed on", func() {
+				So(called, ShouldBeTrue)
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+		Convey("When a request carrying an entitled key as a bearer token is received", func() {
+			recorder := serve("/prefix/officers", "Bearer internal-key")
+			Convey("Then the request should be passed on with the key it was authenticated with", func() {
+				So(called, ShouldBeTrue)
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(authenticated.Name, ShouldEqual, "internal")
+			})
+		})
+		Convey("When a request carrying credentials of another scheme is received", func() {
+			recorder := serve("/prefix/filings", "Digest username=\"acme-key\"")
+			Convey("Then the request should be rejected as unauthorised because the scheme is not supported", func() {
+				So(called, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+				So(recorder.Body.String(), ShouldEqual, `{"error":"authorization scheme not supported","stream":"filings"}`)
+			})
+		})
+		Convey("When a request without a key is received", func() {
+			recorder := serve("/prefix/filings", "")
+			Convey("Then the request should be rejected as unauthorised", func() {
+				So(called, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+				So(recorder.Header().Get("WWW-Authenticate"), ShouldEqual, "Basic")
+				So(recorder.Header().Get("Content-Type"), ShouldEqual, "application/json")
+				So(recorder.Body.String(), ShouldEqual, `{"error":"API key missing","stream":"filings"}`)
+			})
+		})
+		Convey("When a request with a key that has not been issued is received", func() {
+			recorder := serve("/prefix/filings", "unknown-key")
+			Convey("Then the request should be rejected as unauthorised", func() {
+				So(called, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+				So(recorder.Body.String(), ShouldEqual, `{"error":"API key invalid","stream":"filings"}`)
+			})
+		})
+		Convey("When a request with a key not entitled to the stream is received", func() {
+			recorder := serve("/prefix/filings", "limited-key")
+			Convey("Then the request should be rejected as forbidden", func() {
+				So(called, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, http.StatusForbidden)
+				So(recorder.Header().Get("WWW-Authenticate"), ShouldBeEmpty)
+				So(recorder.Body.String(), ShouldEqual, `{"error":"API key not entitled to stream","stream":"filings"}`)
+				logger.AssertCalled(t, "InfoR", mock.Anything, msgNotEntitled, []log.Data{{"stream": "filings", "status": http.StatusForbidden, "key_name": "limited"}})
+			})
+		})
+		Convey("When a request for a path serving several streams is received with a key not entitled to any", func() {
+			recorder := serve("/prefix/socket", "limited-key")
+			Convey("Then the request should be passed on with the key it was authenticated with", func() {
+				So(called, ShouldBeTrue)
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(authenticated.Name, ShouldEqual, "limited")
+			})
+		})
+		Convey("When a request for a path serving several streams is received without a key", func() {
+			recorder := serve("/prefix/socket", "")
+			Convey("Then the request should be rejected as unauthorised", func() {
+				So(called, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+				So(recorder.Body.String(), ShouldEqual, `{"error":"API key missing"}`)
+			})
+		})
+		Convey("When requests for a path matching a pattern serving several streams are received", func() {
+			entitled := serve("/prefix/companies/01234567/events", "limited-key")
+			missing := serve("/prefix/companies/01234567/events", "")
+			Convey("Then a key should be required but its entitlements left to the handler", func() {
+				So(entitled.Code, ShouldEqual, http.StatusOK)
+				So(authenticated.Name, ShouldEqual, "limited")
+				So(missing.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+		Convey("When a request for a path that is not a stream is received without a key", func() {
+			recorder := serve("/healthcheck", "")
+			Convey("Then the request should be passed on without a key", func() {
+				So(called, ShouldBeTrue)
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(authenticated, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestAuthenticateAdminRequests(t *testing.T) {
+	Convey("Given a middleware protecting the metrics", t, func() {
+		keys, _ := ParseKeyStore([]byte(keyStoreDefinition + "  - name: ops\n    key: ops-key\n    admin: true\n"))
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything)
+		called := false
+		handler := NewMiddleware(keys, logger).WithAdminPath("/metrics").Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			called = true
+		}))
+		serve := func(authorization string) *httptest.ResponseRecorder {
+			called = false
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if authorization != "" {
+				request.Header.Set("Authorization", authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			return recorder
+		}
+		Convey("When a request carrying an admin key is received", func() {
+			recorder := serve("ops-key")
+			Convey("Then the request should be passed on", func() {
+				So(called, ShouldBeTrue)
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+		Convey("When a request without a key is received", func() {
+			recorder := serve("")
+			Convey("Then the request should be rejected as unauthorised", func() {
+				So(called, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+				So(recorder.Body.String(), ShouldEqual, `{"error":"API key missing"}`)
+			})
+		})
+		Convey("When a request carrying a key entitled to every stream but not to administer the service is received", func() {
+			recorder := serve("internal-key")
+			Convey("Then the request should be rejected as forbidden", func() {
+				So(called, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, http.StatusForbidden)
+				So(recorder.Body.String(), ShouldEqual, `{"error":"API key not permitted to administer the service"}`)
+				logger.AssertCalled(t, "InfoR", mock.Anything, msgNotAdmin, []log.Data{{"stream": "", "status": http.StatusForbidden, "key_name": "internal"}})
+			})
+		})
+	})
+}
+
+func TestReadKeyFromAuthorization(t *testing.T) {
+	Convey("When API keys are read from the values of Authorization headers", t, func() {
+		basic := KeyFromAuthorization("Basic YWNtZS1rZXk6")
+		bare := KeyFromAuthorization("acme-key")
+		bearer := KeyFromAuthorization("Bearer acme-key")
+		digest := KeyFromAuthorization("Digest username=\"acme-key\"")
+		Convey("Then keys given as basic credentials, as bearer tokens or as the whole value should be returned", func() {
+			So(basic, ShouldEqual, "acme-key")
+			So(bare, ShouldEqual, "acme-key")
+			So(bearer, ShouldEqual, "acme-key")
+			So(digest, ShouldBeEmpty)
+		})
+	})
+}
+
+func (l *mockLogger) Error(err error, data ...log.Data) {
+	l.Called(err, data)
+}
+
+func (l *mockLogger) Info(msg string, data ...log.Data) {
+	l.Called(msg, data)
+}
+
+func (l *mockLogger) InfoR(req *http.Request, msg string, data ...log.Data) {
+	l.Called(req, msg, data)
+}
+
+func (l *mockLogger) ErrorR(req *http.Request, err error, data ...log.Data) {
+	l.Called(req, err, data)
+}
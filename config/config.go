@@ -2,13 +2,40 @@ package config
 
 import "github.com/companieshouse/gofigure"
 
+const (
+	defaultHeartbeatInterval   = 30
+	defaultShutdownGracePeriod = 30
+	defaultBufferSize          = 100
+	defaultOverflowPolicy      = "drop_oldest"
+	defaultSchemaDeadline      = 60
+	defaultSchemaPollInterval  = 30
+)
+
 type Config struct {
-	gofigure          interface{} `order:"env,flag"`
-	BindAddress       string      `env:"BIND_ADDRESS" flag:"bind-address"`
-	CertFile          string      `env:"CERT_FILE" flag:"cert-file" json:"-"`
-	KafkaBroker       []string    `env:"KAFKA_STREAMING_BROKER_ADDR" flag:"kafka-broker-addr"`
-	KeyFile           string      `env:"KEY_FILE" flag:"key-file" json:"-"`
-	SchemaRegistryURL string      `env:"SCHEMA_REGISTRY_URL" flag:"schema-registry-url"`
+	gofigure            interface{} `order:"env,flag"`
+	BindAddress         string      `env:"BIND_ADDRESS" flag:"bind-address"`
+	CertFile            string      `env:"CERT_FILE" flag:"cert-file" json:"-"`
+	KafkaBroker         []string    `env:"KAFKA_STREAMING_BROKER_ADDR" flag:"kafka-broker-addr"`
+	KeyFile             string      `env:"KEY_FILE" flag:"key-file" json:"-"`
+	SchemaRegistryURL   string      `env:"SCHEMA_REGISTRY_URL" flag:"schema-registry-url"`
+	SchemaDeadline      int         `env:"SCHEMA_REGISTRY_DEADLINE" flag:"schema-registry-deadline"`
+	SchemaPollInterval  int         `env:"SCHEMA_POLL_INTERVAL" flag:"schema-poll-interval"`
+	SchemaDir           string      `env:"SCHEMA_DIR" flag:"schema-dir"`
+	HeartbeatInterval   int         `env:"HEARTBEAT_INTERVAL" flag:"heartbeat-interval"`
+	StreamsFile         string      `env:"STREAMS_FILE" flag:"streams-file"`
+	EmitRoutes          bool        `env:"EMIT_ROUTES" flag:"emit-routes"`
+	ShutdownGracePeriod int         `env:"SHUTDOWN_GRACE_PERIOD" flag:"shutdown-grace-period"`
+	BufferSize          int         `env:"BUFFER_SIZE" flag:"buffer-size"`
+	OverflowPolicy      string      `env:"OVERFLOW_POLICY" flag:"overflow-policy"`
+	DeadLetterDir       string      `env:"DEAD_LETTER_DIR" flag:"dead-letter-dir"`
+	DeadLetterTopic     string      `env:"DEAD_LETTER_TOPIC" flag:"dead-letter-topic"`
+	APIKeysFile         string      `env:"API_KEYS_FILE" flag:"api-keys-file" json:"-"`
+	StreamConnLimit     int         `env:"MAX_STREAM_CONNECTIONS" flag:"max-stream-connections"`
+	ConnLimit           int         `env:"MAX_CONNECTIONS" flag:"max-connections"`
+	ConnRateLimit       int         `env:"MAX_CONNECTIONS_PER_MINUTE" flag:"max-connections-per-minute"`
+	TrustForwardedFor   bool        `env:"TRUST_FORWARDED_FOR" flag:"trust-forwarded-for"`
+	GRPCBindAddress     string      `env:"GRPC_BIND_ADDRESS" flag:"grpc-bind-address"`
+	AllowedOrigins      []string    `env:"ALLOWED_ORIGINS" flag:"allowed-origins"`
 }
 
 // ServiceConfig returns a ServiceConfig interface for Config.
@@ -45,7 +72,14 @@ var config *Config
 
 func Get() (*Config, error) {
 	if config == nil {
-		config = &Config{}
+		config = &Config{
+			HeartbeatInterval:   defaultHeartbeatInterval,
+			ShutdownGracePeriod: defaultShutdownGracePeriod,
+			BufferSize:          defaultBufferSize,
+			OverflowPolicy:      defaultOverflowPolicy,
+			SchemaDeadline:      defaultSchemaDeadline,
+			SchemaPollInterval:  defaultSchemaPollInterval,
+		}
 		if err := gofigure.Gofigure(config); err != nil {
 			return nil, err
 		}
@@ -18,6 +18,10 @@ const (
 	KEYFILECONST             = `KEY_FILE`
 	STREAMINGBROKERADDRCONST = `KAFKA_STREAMING_BROKER_ADDR`
 	SCHEMAREGISTRYURLCONST   = `SCHEMA_REGISTRY_URL`
+	HEARTBEATINTERVALCONST   = `HEARTBEAT_INTERVAL`
+	STREAMSFILECONST         = `STREAMS_FILE`
+	OVERFLOWPOLICYCONST      = `OVERFLOW_POLICY`
+	ALLOWEDORIGINSCONST      = `ALLOWED_ORIGINS`
 )
 
 // value constants
@@ -27,6 +31,10 @@ const (
 	keyFileConst             = `key-file`
 	streamingBrokerAddrConst = `streaming-broker-addr`
 	schemaRegistryURLConst   = `schema-registry-url`
+	heartbeatIntervalConst   = `15`
+	streamsFileConst         = `streams-file`
+	overflowPolicyConst      = `drop_oldest`
+	allowedOriginsConst      = `https://example.com`
 )
 
 func TestConfig(t *testing.T) {
@@ -41,13 +49,25 @@ func TestConfig(t *testing.T) {
 			STREAMINGBROKERADDRCONST: streamingBrokerAddrConst,
 			KEYFILECONST:             keyFileConst,
 			SCHEMAREGISTRYURLCONST:   schemaRegistryURLConst,
+			HEARTBEATINTERVALCONST:   heartbeatIntervalConst,
+			STREAMSFILECONST:         streamsFileConst,
+			OVERFLOWPOLICYCONST:      overflowPolicyConst,
+			ALLOWEDORIGINSCONST:      allowedOriginsConst,
 		}
 		builtConfig = config.Config{
-			BindAddress:       bindAddrConst,
-			CertFile:          certFileConst,
-			KafkaBroker:       []string{streamingBrokerAddrConst},
-			KeyFile:           keyFileConst,
-			SchemaRegistryURL: schemaRegistryURLConst,
+			BindAddress:         bindAddrConst,
+			CertFile:            certFileConst,
+			KafkaBroker:         []string{streamingBrokerAddrConst},
+			KeyFile:             keyFileConst,
+			SchemaRegistryURL:   schemaRegistryURLConst,
+			HeartbeatInterval:   15,
+			StreamsFile:         streamsFileConst,
+			ShutdownGracePeriod: 30,
+			BufferSize:          100,
+			OverflowPolicy:      overflowPolicyConst,
+			SchemaDeadline:      60,
+			SchemaPollInterval:  30,
+			AllowedOrigins:      []string{allowedOriginsConst},
 		}
 		bindAddrRegex            = regexp.MustCompile(bindAddrConst)
 		certFileRegex            = regexp.MustCompile(certFileConst)
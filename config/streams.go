@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+const companyNumberVariable = "{company_number}"
+
+// Matches the variables of a path template, which match a single segment of a path.
+var pathVariable = regexp.MustCompile(`\{[^}]*\}`)
+
+// The streams served by the application, together with the metadata needed to route requests for them to it.
+type StreamRegistry struct {
+	AppName           string   `yaml:"app_name"`
+	Group             string   `yaml:"group"`
+	Weight            int      `yaml:"weight"`
+	Prefix            string   `yaml:"prefix"`
+	WebSocketPath     string   `yaml:"websocket_path"`
+	MultiplexPath     string   `yaml:"multiplex_path"`
+	CompanyEventsPath string   `yaml:"company_events_path"`
+	Streams           []Stream `yaml:"streams"`
+}
+
+// A Kafka topic served to users on an HTTP path.
+type Stream struct {
+	Name    string        `yaml:"name"`
+	Topic   string        `yaml:"topic"`
+	Path    string        `yaml:"path"`
+	Schema  string        `yaml:"schema"`
+	Options StreamOptions `yaml:"options"`
+}
+
+// Settings that override the application configuration for a single stream.
+type StreamOptions struct {
+	HeartbeatInterval *int `yaml:"heartbeat_interval"`
+}
+
+// The routes file that directs requests for the application's paths to it.
+type routesFile struct {
+	AppName string         `yaml:"app_name"`
+	Group   string         `yaml:"group"`
+	Weight  int            `yaml:"weight"`
+	Routes  map[int]string `yaml:"routes"`
+}
+
+// Read and validate the stream registry held in the given file.
+func ReadStreamRegistry(path string) (*StreamRegistry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseStreamRegistry(data)
+}
+
+// Parse and validate a stream registry. Every stream must have a name, topic, path and schema subject, and no two
+// streams may share a name or path. Streams may not be served on the WebSocket, multiplexed or company events paths,
+// if any, and the company events path, if any, must carry the company number.
+func ParseStreamRegistry(data []byte) (*StreamRegistry, error) {
+	registry := &StreamRegistry{}
+	if err := yaml.Unmarshal(data, registry); err != nil {
+		return nil, err
+	}
+	if registry.CompanyEventsPath != "" && !strings.Contains(registry.CompanyEventsPath, companyNumberVariable) {
+		return nil, fmt.Errorf("company events path must contain %s: %s", companyNumberVariable, registry.CompanyEventsPath)
+	}
+	var companyEvents *regexp.Regexp
+	if registry.CompanyEventsPath != "" {
+		companyEvents = templatePattern(registry.CompanyEventsPath)
+	}
+	names := make(map[string]bool)
+	paths := make(map[string]bool)
+	for i, stream := range registry.Streams {
+		if stream.Name == "" || stream.Topic == "" || stream.Path == "" || stream.Schema == "" {
+			return nil, fmt.Errorf("stream %d must specify a name, topic, path and schema", i+1)
+		}
+		if names[stream.Name] {
+			return nil, fmt.Errorf("duplicate stream name: %s", stream.Name)
+		}
+		if paths[stream.Path] || stream.Path == registry.WebSocketPath || stream.Path == registry.MultiplexPath ||
+			(companyEvents != nil && companyEvents.MatchString(stream.Path)) {
+			return nil, fmt.Errorf("duplicate stream path: %s", stream.Path)
+		}
+		names[stream.Name] = true
+		paths[stream.Path] = true
+	}
+	return registry, nil
+}
+
+// Return a pattern matching the whole of any path the given path template matches.
+func templatePattern(template string) *regexp.Regexp {
+	literals := pathVariable.Split(template, -1)
+	for i, literal := range literals {
+		literals[i] = regexp.QuoteMeta(literal)
+	}
+	return regexp.MustCompile("^" + strings.Join(literals, "[^/]+") + "$")
+}
+
+// Return the distinct schema subjects used by the registered streams in the order they are first used.
+func (r *StreamRegistry) Schemas() []string {
+	seen := make(map[string]bool)
+	schemas := make([]string, 0)
+	for _, stream := range r.Streams {
+		if !seen[stream.Schema] {
+			seen[stream.Schema] = true
+			schemas = append(schemas, stream.Schema)
+		}
+	}
+	return schemas
+}
+
+// Return the contents of the routes file matching the path of every registered stream and the WebSocket, multiplexed
+// and company events paths, if any. Variables in path templates match any single segment of a path.
+func (r *StreamRegistry) Routes() ([]byte, error) {
+	routes := &routesFile{
+		AppName: r.AppName,
+		Group:   r.Group,
+		Weight:  r.Weight,
+		Routes:  make(map[int]string),
+	}
+	for i, stream := range r.Streams {
+		routes.Routes[i+1] = "^" + r.Prefix + stream.Path
+	}
+	for _, path := range []string{r.WebSocketPath, r.MultiplexPath, r.CompanyEventsPath} {
+		if path != "" {
+			routes.Routes[len(routes.Routes)+1] = "^" + r.Prefix + pathVariable.ReplaceAllString(path, "[^/]+")
+		}
+	}
+	var output bytes.Buffer
+	encoder := yaml.NewEncoder(&output)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(routes); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
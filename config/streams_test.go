@@ -0,0 +1,139 @@
+package config_test
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+const registryDefinition = `
+app_name: app
+group: internalapi
+weight: 100
+prefix: /prefix
+streams:
+  - name: filings
+    topic: stream-filing-history
+    path: /filings
+    schema: resource-changed-data
+  - name: officers
+    topic: stream-company-officers
+    path: /officers
+    schema: officers-data
+    options:
+      heartbeat_interval: 5
+  - name: charges
+    topic: stream-company-charges
+    path: /charges
+    schema: resource-changed-data
+`
+
+func TestParseStreamRegistry(t *testing.T) {
+	Convey("When a stream registry is parsed", t, func() {
+		actual, err := config.ParseStreamRegistry([]byte(registryDefinition))
+		Convey("Then every stream should be registered", func() {
+			heartbeatInterval := 5
+			So(err, ShouldBeNil)
+			So(actual.Prefix, ShouldEqual, "/prefix")
+			So(actual.Streams, ShouldHaveLength, 3)
+			So(actual.Streams[1], ShouldResemble, config.Stream{
+				Name:    "officers",
+				Topic:   "stream-company-officers",
+				Path:    "/officers",
+				Schema:  "officers-data",
+				Options: config.StreamOptions{HeartbeatInterval: &heartbeatInterval},
+			})
+			So(actual.Streams[0].Options.HeartbeatInterval, ShouldBeNil)
+			So(actual.Schemas(), ShouldResemble, []string{"resource-changed-data", "officers-data"})
+		})
+	})
+}
+
+func TestReturnErrorIfStreamRegistryInvalid(t *testing.T) {
+	Convey("When invalid stream registries are parsed", t, func() {
+		_, incompleteErr := config.ParseStreamRegistry([]byte("streams:\n  - name: filings\n    path: /filings\n"))
+		_, nameErr := config.ParseStreamRegistry([]byte("streams:\n" +
+			"  - {name: filings, topic: a, path: /a, schema: s}\n" +
+			"  - {name: filings, topic: b, path: /b, schema: s}\n"))
+		_, pathErr := config.ParseStreamRegistry([]byte("streams:\n" +
+			"  - {name: a, topic: a, path: /filings, schema: s}\n" +
+			"  - {name: b, topic: b, path: /filings, schema: s}\n"))
+		_, socketErr := config.ParseStreamRegistry([]byte("websocket_path: /filings\nstreams:\n" +
+			"  - {name: a, topic: a, path: /filings, schema: s}\n"))
+		_, multiplexErr := config.ParseStreamRegistry([]byte("multiplex_path: /filings\nstreams:\n" +
+			"  - {name: a, topic: a, path: /filings, schema: s}\n"))
+		_, companyErr := config.ParseStreamRegistry([]byte("company_events_path: /companies/events\nstreams: []\n"))
+		_, companyPathErr := config.ParseStreamRegistry([]byte("company_events_path: /companies/{company_number}/events\nstreams:\n" +
+			"  - {name: a, topic: a, path: /companies/all/events, schema: s}\n"))
+		_, syntaxErr := config.ParseStreamRegistry([]byte("streams: ["))
+		Convey("Then an error should be returned", func() {
+			So(incompleteErr.Error(), ShouldEqual, "stream 1 must specify a name, topic, path and schema")
+			So(nameErr.Error(), ShouldEqual, "duplicate stream name: filings")
+			So(pathErr.Error(), ShouldEqual, "duplicate stream path: /filings")
+			So(socketErr.Error(), ShouldEqual, "duplicate stream path: /filings")
+			So(multiplexErr.Error(), ShouldEqual, "duplicate stream path: /filings")
+			So(companyErr.Error(), ShouldEqual, "company events path must contain {company_number}: /companies/events")
+			So(companyPathErr.Error(), ShouldEqual, "duplicate stream path: /companies/all/events")
+			So(syntaxErr, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEmitRoutesFromStreamRegistry(t *testing.T) {
+	Convey("Given a stream registry", t, func() {
+		registry, _ := config.ParseStreamRegistry([]byte(registryDefinition))
+		Convey("When its routes are emitted", func() {
+			actual, err := registry.Routes()
+			Convey("Then a route should be emitted for the path of every stream", func() {
+				So(err, ShouldBeNil)
+				So(string(actual), ShouldEqual, "app_name: app\n"+
+					"group: internalapi\n"+
+					"weight: 100\n"+
+					"routes:\n"+
+					"  1: ^/prefix/filings\n"+
+					"  2: ^/prefix/officers\n"+
+					"  3: ^/prefix/charges\n")
+			})
+		})
+		Convey("When its routes are emitted with a WebSocket path", func() {
+			registry.WebSocketPath = "/socket"
+			actual, err := registry.Routes()
+			Convey("Then a route should also be emitted for the WebSocket path", func() {
+				So(err, ShouldBeNil)
+				So(string(actual), ShouldEndWith, "  3: ^/prefix/charges\n  4: ^/prefix/socket\n")
+			})
+		})
+		Convey("When its routes are emitted with a multiplexed path", func() {
+			registry.MultiplexPath = "/streams"
+			actual, err := registry.Routes()
+			Convey("Then a route should also be emitted for the multiplexed path", func() {
+				So(err, ShouldBeNil)
+				So(string(actual), ShouldEndWith, "  3: ^/prefix/charges\n  4: ^/prefix/streams\n")
+			})
+		})
+		Convey("When its routes are emitted with a company events path", func() {
+			registry.CompanyEventsPath = "/companies/{company_number}/events"
+			actual, err := registry.Routes()
+			Convey("Then a route matching the path for any company should also be emitted", func() {
+				So(err, ShouldBeNil)
+				So(string(actual), ShouldEndWith, "  3: ^/prefix/charges\n  4: ^/prefix/companies/[^/]+/events\n")
+			})
+		})
+	})
+}
+
+func TestRoutesFileMatchesStreamRegistry(t *testing.T) {
+	Convey("Given the stream registry built into the application", t, func() {
+		registry, err := config.ReadStreamRegistry("../streams.yaml")
+		So(err, ShouldBeNil)
+		Convey("When its routes are emitted", func() {
+			actual, err := registry.Routes()
+			routes, _ := ioutil.ReadFile("../routes.yaml")
+			Convey("Then they should match the routes file", func() {
+				So(err, ShouldBeNil)
+				So(string(actual), ShouldEqual, string(routes))
+			})
+		})
+	})
+}
@@ -1,23 +1,36 @@
 package consumer
 
 import (
+	"errors"
+	"github.com/Shopify/sarama"
 	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
 	"github.com/companieshouse/chs-streaming-api-backend/model"
 	"github.com/companieshouse/chs.go/kafka/consumer"
 	"github.com/companieshouse/chs.go/log"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Describes an object capable of transforming on given representation into another.
 type Transformable interface {
-	Transform(message *model.BackendEvent) (string, error)
+	Transform(message *model.BackendEvent) (*model.StreamEvent, error)
 }
 
 // Describes an object capable of publishing a message.
 type Publishable interface {
-	Publish(msg string)
+	Publish(event *model.StreamEvent)
 }
 
+// Describes an object capable of recording messages that could not be transformed.
+type Recordable interface {
+	Record(letter *model.DeadLetter) error
+}
+
+// Returned by a dead letter sink for a message that another consumer has already recorded.
+var ErrAlreadyRecorded = errors.New("dead letter has already been recorded")
+
 type Runnable interface {
 	Run()
 	HasStarted() bool
@@ -35,7 +48,10 @@ type KafkaMessageConsumer struct {
 	kafkaConsumer      KafkaPartitionConsumable
 	messageTransformer Transformable
 	publisher          Publishable
+	deadLetters        Recordable
 	shutdown           chan string
+	stopped            chan struct{}
+	invoked            atomic.Bool
 	logger             logger.Logger
 	wg                 *sync.WaitGroup
 	partition          int32
@@ -43,24 +59,29 @@ type KafkaMessageConsumer struct {
 	started            chan bool
 }
 
-// Create a new consumer wrapper instance.
-func NewConsumer(consumer KafkaPartitionConsumable, messageTransformer Transformable, publisher Publishable, partition int32, offset int64, logger logger.Logger) Runnable {
+// Create a new consumer wrapper instance. Messages that cannot be transformed are recorded to the given dead letter
+// sink, if any.
+func NewConsumer(consumer KafkaPartitionConsumable, messageTransformer Transformable, publisher Publishable, deadLetters Recordable, partition int32, offset int64, logger logger.Logger) Runnable {
 	return &KafkaMessageConsumer{
 		kafkaConsumer:      consumer,
 		messageTransformer: messageTransformer,
 		publisher:          publisher,
-		shutdown:           make(chan string),
+		deadLetters:        deadLetters,
+		shutdown:           make(chan string, 1),
+		stopped:            make(chan struct{}),
 		partition:          partition,
 		offset:             offset,
 		logger:             logger,
-		started:            make(chan bool),
+		started:            make(chan bool, 1),
 	}
 }
 
 // Run this consumer instance.
 func (c *KafkaMessageConsumer) Run() {
+	c.invoked.Store(true)
 	if err := c.kafkaConsumer.ConsumePartition(c.partition, c.offset); err != nil {
 		c.logger.Error(err)
+		close(c.stopped)
 		go c.notifyStarted(false)
 		return
 	}
@@ -68,12 +89,20 @@ func (c *KafkaMessageConsumer) Run() {
 	for {
 		select {
 		case message := <-c.kafkaConsumer.Messages():
+			metrics.MessagesConsumed.WithLabelValues(message.Topic).Inc()
+			start := time.Now()
 			result, err := c.messageTransformer.Transform(&model.BackendEvent{
-				Data:   message.Value,
-				Offset: message.Offset,
+				Data:      message.Value,
+				Offset:    message.Offset,
+				Partition: message.Partition,
 			})
+			metrics.TransformDuration.WithLabelValues(message.Topic).Observe(time.Since(start).Seconds())
 			if err != nil {
+				metrics.TransformErrors.WithLabelValues(message.Topic).Inc()
 				c.logger.Error(err, log.Data{})
+				c.recordDeadLetter(message, err)
+				// Tell clients the offset was skipped so that they can tell it apart from a lost message
+				c.publisher.Publish(&model.StreamEvent{Offset: message.Offset, Partition: message.Partition, Skipped: true})
 				if c.wg != nil {
 					c.wg.Done()
 				}
@@ -88,11 +117,13 @@ func (c *KafkaMessageConsumer) Run() {
 			if err := c.kafkaConsumer.Close(); err != nil {
 				c.logger.Error(err, log.Data{})
 			}
+			close(c.stopped)
 			if c.wg != nil {
 				c.wg.Done()
 			}
 			return
 		case err := <-c.kafkaConsumer.Errors():
+			metrics.KafkaErrors.WithLabelValues(err.Topic).Inc()
 			c.logger.Error(err, log.Data{"topic": err.Topic})
 			if c.wg != nil {
 				c.wg.Done()
@@ -105,8 +136,39 @@ func (c *KafkaMessageConsumer) HasStarted() bool {
 	return <-c.started
 }
 
+// Shut down this consumer instance, waiting until it has closed its connection to Kafka. A consumer that has not yet
+// been run shuts down as soon as it is, and shutting down a consumer that has already stopped has no effect.
 func (c *KafkaMessageConsumer) Shutdown(msg string) {
-	c.shutdown <- msg
+	select {
+	case c.shutdown <- msg:
+	default:
+		// The consumer is already shutting down
+	}
+	if c.invoked.Load() {
+		<-c.stopped
+	}
+}
+
+// Record a message that could not be transformed to the dead letter sink.
+func (c *KafkaMessageConsumer) recordDeadLetter(message *sarama.ConsumerMessage, transformErr error) {
+	if c.deadLetters == nil {
+		return
+	}
+	err := c.deadLetters.Record(&model.DeadLetter{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Data:      message.Value,
+		Error:     transformErr.Error(),
+	})
+	if errors.Is(err, ErrAlreadyRecorded) {
+		return
+	}
+	if err != nil {
+		c.logger.Error(err, log.Data{"topic": message.Topic, "partition": message.Partition, "offset": message.Offset})
+		return
+	}
+	metrics.DeadLetters.WithLabelValues(message.Topic).Inc()
 }
 
 func (c *KafkaMessageConsumer) notifyStarted(started bool) {
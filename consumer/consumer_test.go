@@ -3,13 +3,16 @@ package consumer
 import (
 	"errors"
 	"github.com/Shopify/sarama"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
 	"github.com/companieshouse/chs-streaming-api-backend/model"
 	"github.com/companieshouse/chs.go/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"sync"
 	"testing"
+	"time"
 )
 
 type mockKafkaConsumer struct {
@@ -24,19 +27,25 @@ type mockPublisher struct {
 	mock.Mock
 }
 
+type mockDeadLetters struct {
+	mock.Mock
+}
+
 type mockLogger struct {
 	mock.Mock
 }
 
 func TestCreateNewConsumer(t *testing.T) {
 	Convey("When a new consumer instance is created", t, func() {
-		actual := NewConsumer(&mockKafkaConsumer{}, &mockTransformer{}, &mockPublisher{}, 1, -1, &mockLogger{}).(*KafkaMessageConsumer)
+		actual := NewConsumer(&mockKafkaConsumer{}, &mockTransformer{}, &mockPublisher{}, nil, 1, -1, &mockLogger{}).(*KafkaMessageConsumer)
 		Convey("Then a new consumer instance should be returned", func() {
 			So(actual, ShouldNotBeNil)
 			So(actual.kafkaConsumer, ShouldNotBeNil)
 			So(actual.messageTransformer, ShouldNotBeNil)
 			So(actual.publisher, ShouldNotBeNil)
+			So(actual.deadLetters, ShouldBeNil)
 			So(actual.shutdown, ShouldNotBeNil)
+			So(actual.stopped, ShouldNotBeNil)
 			So(actual.wg, ShouldBeNil)
 			So(actual.partition, ShouldEqual, 1)
 			So(actual.offset, ShouldEqual, -1)
@@ -53,21 +62,24 @@ func TestReceiveMessageFromKafka(t *testing.T) {
 		mockKafkaConsumer.On("Messages").Return(msgChannel)
 		mockKafkaConsumer.On("Errors").Return(errorChannel)
 		mockTransformer := &mockTransformer{}
-		mockTransformer.On("Transform", mock.Anything).Return("123", nil)
+		event := &model.StreamEvent{Data: "123", Offset: 3, Partition: 2}
+		mockTransformer.On("Transform", mock.Anything).Return(event, nil)
 		mockPublisher := &mockPublisher{}
 		mockPublisher.On("Publish", mock.Anything).Return()
-		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, 0, -1, &mockLogger{}).(*KafkaMessageConsumer)
+		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, nil, 0, -1, &mockLogger{}).(*KafkaMessageConsumer)
 		consumer.wg = new(sync.WaitGroup)
 		consumer.wg.Add(1)
 		go consumer.Run()
 		Convey("When a message is consumed from Kafka", func() {
-			msgChannel <- &sarama.ConsumerMessage{Value: []byte("abc"), Offset: 3}
+			msgChannel <- &sarama.ConsumerMessage{Topic: "consumed-topic", Value: []byte("abc"), Offset: 3, Partition: 2}
 			consumer.wg.Wait()
 			Convey("Then the message should be transformed and published to the publisher", func() {
 				So(<-consumer.started, ShouldBeTrue)
 				So(mockKafkaConsumer.AssertCalled(t, "ConsumePartition", int32(0), int64(-1)), ShouldBeTrue)
-				So(mockPublisher.AssertCalled(t, "Publish", "123"), ShouldBeTrue)
-				So(mockTransformer.AssertCalled(t, "Transform", &model.BackendEvent{Data: []byte("abc"), Offset: 3}), ShouldBeTrue)
+				So(mockPublisher.AssertCalled(t, "Publish", event), ShouldBeTrue)
+				So(mockTransformer.AssertCalled(t, "Transform", &model.BackendEvent{Data: []byte("abc"), Offset: 3, Partition: 2}), ShouldBeTrue)
+				So(testutil.ToFloat64(metrics.MessagesConsumed.WithLabelValues("consumed-topic")), ShouldEqual, 1)
+				So(testutil.CollectAndCount(metrics.TransformDuration), ShouldBeGreaterThan, 0)
 			})
 		})
 	})
@@ -86,7 +98,7 @@ func TestReceiveShutdownSignal(t *testing.T) {
 		mockPublisher := &mockPublisher{}
 		mockLogger := &mockLogger{}
 		mockLogger.On("Info", mock.Anything, mock.Anything).Return()
-		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, 1, -1, mockLogger).(*KafkaMessageConsumer)
+		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, nil, 1, -1, mockLogger).(*KafkaMessageConsumer)
 		consumer.wg = new(sync.WaitGroup)
 		consumer.wg.Add(1)
 		go consumer.Run()
@@ -119,7 +131,7 @@ func TestLogErrorsReceivedFromKafka(t *testing.T) {
 		mockPublisher := &mockPublisher{}
 		logger := &mockLogger{}
 		logger.On("Error", mock.Anything, mock.Anything).Return()
-		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, 0, -1, logger).(*KafkaMessageConsumer)
+		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, nil, 0, -1, logger).(*KafkaMessageConsumer)
 		consumer.wg = new(sync.WaitGroup)
 		consumer.wg.Add(1)
 		go consumer.Run()
@@ -130,6 +142,7 @@ func TestLogErrorsReceivedFromKafka(t *testing.T) {
 				So(<-consumer.started, ShouldBeTrue)
 				So(mockKafkaConsumer.AssertCalled(t, "ConsumePartition", int32(0), int64(-1)), ShouldBeTrue)
 				So(logger.AssertCalled(t, "Error", theError, []log.Data{{"topic": "the-topic"}}), ShouldBeTrue)
+				So(testutil.ToFloat64(metrics.KafkaErrors.WithLabelValues("the-topic")), ShouldEqual, 1)
 			})
 		})
 	})
@@ -145,23 +158,130 @@ func TestSkipMessageIfTransformerReturnsError(t *testing.T) {
 		mockKafkaConsumer.On("Messages").Return(msgChannel)
 		mockKafkaConsumer.On("Errors").Return(errorChannel)
 		mockTransformer := &mockTransformer{}
-		mockTransformer.On("Transform", mock.Anything).Return("", theError)
+		mockTransformer.On("Transform", mock.Anything).Return((*model.StreamEvent)(nil), theError)
 		mockPublisher := &mockPublisher{}
+		mockPublisher.On("Publish", mock.Anything).Return()
 		mockLogger := &mockLogger{}
 		mockLogger.On("Error", mock.Anything, mock.Anything).Return()
-		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, 0, -1, mockLogger).(*KafkaMessageConsumer)
+		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, nil, 0, -1, mockLogger).(*KafkaMessageConsumer)
 		consumer.wg = new(sync.WaitGroup)
 		consumer.wg.Add(1)
 		go consumer.Run()
 		Convey("When an untransformable message is consumed from Kafka", func() {
-			msgChannel <- &sarama.ConsumerMessage{Value: []byte("abc"), Offset: 3}
+			msgChannel <- &sarama.ConsumerMessage{Topic: "untransformable-topic", Value: []byte("abc"), Offset: 3}
 			consumer.wg.Wait()
-			Convey("Then the error should be logged and the message should not be published", func() {
+			Convey("Then the error should be logged and the message should be published as skipped", func() {
 				So(<-consumer.started, ShouldBeTrue)
 				So(mockKafkaConsumer.AssertCalled(t, "ConsumePartition", int32(0), int64(-1)), ShouldBeTrue)
 				So(mockTransformer.AssertCalled(t, "Transform", &model.BackendEvent{Data: []byte("abc"), Offset: 3}), ShouldBeTrue)
-				So(mockPublisher.AssertNotCalled(t, "Publish", mock.Anything), ShouldBeTrue)
+				So(mockPublisher.AssertCalled(t, "Publish", &model.StreamEvent{Offset: 3, Skipped: true}), ShouldBeTrue)
 				So(mockLogger.AssertCalled(t, "Error", theError, []log.Data{{}}), ShouldBeTrue)
+				So(testutil.ToFloat64(metrics.TransformErrors.WithLabelValues("untransformable-topic")), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestRecordDeadLetterIfTransformerReturnsError(t *testing.T) {
+	Convey("Given a new consumer has been created with a dead letter sink", t, func() {
+		msgChannel := make(chan *sarama.ConsumerMessage)
+		errorChannel := make(chan *sarama.ConsumerError)
+		theError := errors.New("something went wrong")
+		mockKafkaConsumer := &mockKafkaConsumer{}
+		mockKafkaConsumer.On("ConsumePartition", mock.Anything, mock.Anything).Return(nil)
+		mockKafkaConsumer.On("Messages").Return(msgChannel)
+		mockKafkaConsumer.On("Errors").Return(errorChannel)
+		mockTransformer := &mockTransformer{}
+		mockTransformer.On("Transform", mock.Anything).Return((*model.StreamEvent)(nil), theError)
+		mockPublisher := &mockPublisher{}
+		mockPublisher.On("Publish", mock.Anything).Return()
+		mockDeadLetters := &mockDeadLetters{}
+		mockDeadLetters.On("Record", mock.Anything).Return(nil)
+		mockLogger := &mockLogger{}
+		mockLogger.On("Error", mock.Anything, mock.Anything).Return()
+		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, mockDeadLetters, 2, -1, mockLogger).(*KafkaMessageConsumer)
+		consumer.wg = new(sync.WaitGroup)
+		consumer.wg.Add(1)
+		go consumer.Run()
+		Convey("When an untransformable message is consumed from Kafka", func() {
+			msgChannel <- &sarama.ConsumerMessage{Topic: "dead-letter-topic", Value: []byte("abc"), Offset: 3, Partition: 2}
+			consumer.wg.Wait()
+			Convey("Then the message should be recorded with the error to the dead letter sink", func() {
+				So(<-consumer.started, ShouldBeTrue)
+				So(mockDeadLetters.AssertCalled(t, "Record", &model.DeadLetter{
+					Topic:     "dead-letter-topic",
+					Partition: 2,
+					Offset:    3,
+					Data:      []byte("abc"),
+					Error:     "something went wrong",
+				}), ShouldBeTrue)
+				So(mockPublisher.AssertCalled(t, "Publish", &model.StreamEvent{Offset: 3, Partition: 2, Skipped: true}), ShouldBeTrue)
+				So(testutil.ToFloat64(metrics.DeadLetters.WithLabelValues("dead-letter-topic")), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestLogErrorIfDeadLetterCannotBeRecorded(t *testing.T) {
+	Convey("Given a new consumer has been created with a dead letter sink that cannot be written to", t, func() {
+		msgChannel := make(chan *sarama.ConsumerMessage)
+		errorChannel := make(chan *sarama.ConsumerError)
+		recordError := errors.New("disk full")
+		mockKafkaConsumer := &mockKafkaConsumer{}
+		mockKafkaConsumer.On("ConsumePartition", mock.Anything, mock.Anything).Return(nil)
+		mockKafkaConsumer.On("Messages").Return(msgChannel)
+		mockKafkaConsumer.On("Errors").Return(errorChannel)
+		mockTransformer := &mockTransformer{}
+		mockTransformer.On("Transform", mock.Anything).Return((*model.StreamEvent)(nil), errors.New("something went wrong"))
+		mockPublisher := &mockPublisher{}
+		mockPublisher.On("Publish", mock.Anything).Return()
+		mockDeadLetters := &mockDeadLetters{}
+		mockDeadLetters.On("Record", mock.Anything).Return(recordError)
+		mockLogger := &mockLogger{}
+		mockLogger.On("Error", mock.Anything, mock.Anything).Return()
+		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, mockDeadLetters, 0, -1, mockLogger).(*KafkaMessageConsumer)
+		consumer.wg = new(sync.WaitGroup)
+		consumer.wg.Add(1)
+		go consumer.Run()
+		Convey("When an untransformable message is consumed from Kafka", func() {
+			msgChannel <- &sarama.ConsumerMessage{Topic: "unrecordable-topic", Value: []byte("abc"), Offset: 3}
+			consumer.wg.Wait()
+			Convey("Then the error should be logged and the message still published as skipped", func() {
+				So(mockLogger.AssertCalled(t, "Error", recordError, []log.Data{{"topic": "unrecordable-topic", "partition": int32(0), "offset": int64(3)}}), ShouldBeTrue)
+				So(mockPublisher.AssertCalled(t, "Publish", &model.StreamEvent{Offset: 3, Skipped: true}), ShouldBeTrue)
+				So(testutil.ToFloat64(metrics.DeadLetters.WithLabelValues("unrecordable-topic")), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestIgnoreDeadLetterAlreadyRecorded(t *testing.T) {
+	Convey("Given a new consumer has been created with a dead letter sink that another consumer has recorded to", t, func() {
+		msgChannel := make(chan *sarama.ConsumerMessage)
+		errorChannel := make(chan *sarama.ConsumerError)
+		mockKafkaConsumer := &mockKafkaConsumer{}
+		mockKafkaConsumer.On("ConsumePartition", mock.Anything, mock.Anything).Return(nil)
+		mockKafkaConsumer.On("Messages").Return(msgChannel)
+		mockKafkaConsumer.On("Errors").Return(errorChannel)
+		mockTransformer := &mockTransformer{}
+		mockTransformer.On("Transform", mock.Anything).Return((*model.StreamEvent)(nil), errors.New("something went wrong"))
+		mockPublisher := &mockPublisher{}
+		mockPublisher.On("Publish", mock.Anything).Return()
+		mockDeadLetters := &mockDeadLetters{}
+		mockDeadLetters.On("Record", mock.Anything).Return(ErrAlreadyRecorded)
+		mockLogger := &mockLogger{}
+		mockLogger.On("Error", mock.Anything, mock.Anything).Return()
+		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, mockDeadLetters, 0, -1, mockLogger).(*KafkaMessageConsumer)
+		consumer.wg = new(sync.WaitGroup)
+		consumer.wg.Add(1)
+		go consumer.Run()
+		Convey("When an untransformable message is consumed from Kafka", func() {
+			msgChannel <- &sarama.ConsumerMessage{Topic: "recorded-topic", Value: []byte("abc"), Offset: 3}
+			consumer.wg.Wait()
+			Convey("Then the message should be published as skipped without logging the sink error or counting it again", func() {
+				So(mockLogger.AssertNotCalled(t, "Error", ErrAlreadyRecorded, mock.Anything), ShouldBeTrue)
+				So(mockPublisher.AssertCalled(t, "Publish", &model.StreamEvent{Offset: 3, Skipped: true}), ShouldBeTrue)
+				So(testutil.ToFloat64(metrics.DeadLetters.WithLabelValues("recorded-topic")), ShouldEqual, 0)
 			})
 		})
 	})
@@ -182,7 +302,7 @@ func TestLogErrorWhenClosingKafkaConsumer(t *testing.T) {
 		logger := &mockLogger{}
 		logger.On("Info", mock.Anything, mock.Anything).Return()
 		logger.On("Error", mock.Anything, mock.Anything).Return()
-		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, 0, -1, logger).(*KafkaMessageConsumer)
+		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, nil, 0, -1, logger).(*KafkaMessageConsumer)
 		consumer.wg = new(sync.WaitGroup)
 		consumer.wg.Add(1)
 		go consumer.Run()
@@ -208,7 +328,7 @@ func TestNotifyNotStartedIfErrorReturnedWhenConsumingPartition(t *testing.T) {
 		mockPublisher := &mockPublisher{}
 		mockLogger := &mockLogger{}
 		mockLogger.On("Error", mock.Anything, []log.Data(nil)).Return()
-		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, 0, -1, mockLogger).(*KafkaMessageConsumer)
+		consumer := NewConsumer(mockKafkaConsumer, mockTransformer, mockPublisher, nil, 0, -1, mockLogger).(*KafkaMessageConsumer)
 		Convey("When the consumer is started", func() {
 			go consumer.Run()
 			Convey("Then a message should be published indicating the consumer hasn't started", func() {
@@ -220,6 +340,39 @@ func TestNotifyNotStartedIfErrorReturnedWhenConsumingPartition(t *testing.T) {
 	})
 }
 
+func TestShutdownConsumerThatHasNotRunOrHasStopped(t *testing.T) {
+	Convey("Given a consumer that has not been run and one whose partition consumer failed to start", t, func() {
+		failing := &mockKafkaConsumer{}
+		failing.On("ConsumePartition", mock.Anything, mock.Anything).Return(errors.New("something went wrong"))
+		mockLogger := &mockLogger{}
+		mockLogger.On("Error", mock.Anything, mock.Anything).Return()
+		unrun := NewConsumer(&mockKafkaConsumer{}, &mockTransformer{}, &mockPublisher{}, nil, 0, -1, mockLogger)
+		failed := NewConsumer(failing, &mockTransformer{}, &mockPublisher{}, nil, 0, -1, mockLogger)
+		go failed.Run()
+		So(failed.HasStarted(), ShouldBeFalse)
+		Convey("When each is shut down, twice", func() {
+			stopped := make(chan struct{})
+			go func() {
+				unrun.Shutdown("user disconnected")
+				unrun.Shutdown("user disconnected")
+				failed.Shutdown("user disconnected")
+				failed.Shutdown("user disconnected")
+				close(stopped)
+			}()
+			returned := false
+			select {
+			case <-stopped:
+				returned = true
+			case <-time.After(time.Second):
+			}
+			Convey("Then shutting down should return rather than wait for the consumers forever", func() {
+				So(returned, ShouldBeTrue)
+				So(failing.AssertNotCalled(t, "Close"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
 func (k *mockKafkaConsumer) ConsumePartition(partition int32, offset int64) error {
 	args := k.Called(partition, offset)
 	return args.Error(0)
@@ -240,13 +393,18 @@ func (k *mockKafkaConsumer) Errors() <-chan *sarama.ConsumerError {
 	return args.Get(0).(chan *sarama.ConsumerError)
 }
 
-func (t *mockTransformer) Transform(message *model.BackendEvent) (string, error) {
+func (t *mockTransformer) Transform(message *model.BackendEvent) (*model.StreamEvent, error) {
 	args := t.Called(message)
-	return args.String(0), args.Error(1)
+	return args.Get(0).(*model.StreamEvent), args.Error(1)
 }
 
-func (b *mockPublisher) Publish(msg string) {
-	b.Called(msg)
+func (b *mockPublisher) Publish(event *model.StreamEvent) {
+	b.Called(event)
+}
+
+func (d *mockDeadLetters) Record(letter *model.DeadLetter) error {
+	args := d.Called(letter)
+	return args.Error(0)
 }
 
 func (l *mockLogger) Error(err error, data ...log.Data) {
@@ -0,0 +1,40 @@
+// Package deadletter records messages that could not be transformed so that they can be investigated and replayed.
+package deadletter
+
+import (
+	"errors"
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs-streaming-api-backend/consumer"
+	"time"
+)
+
+const msgConflictingSinks = "DEAD_LETTER_DIR and DEAD_LETTER_TOPIC cannot both be specified"
+
+// A dead letter as recorded to a sink.
+type record struct {
+	Topic      string `json:"topic"`
+	Partition  int32  `json:"partition"`
+	Offset     int64  `json:"offset"`
+	Data       []byte `json:"data"`
+	Error      string `json:"error"`
+	RecordedAt string `json:"recorded_at"`
+}
+
+// Return the dead letter sink configured for the application, either a directory or a Kafka topic. Nil is returned
+// if no sink has been configured.
+func NewSink(cfg *config.Config) (consumer.Recordable, error) {
+	if cfg.DeadLetterDir != "" && cfg.DeadLetterTopic != "" {
+		return nil, errors.New(msgConflictingSinks)
+	}
+	if cfg.DeadLetterDir != "" {
+		return NewFileSink(cfg.DeadLetterDir)
+	}
+	if cfg.DeadLetterTopic != "" {
+		return NewKafkaSink(cfg.KafkaBroker, cfg.DeadLetterTopic)
+	}
+	return nil, nil
+}
+
+func recordedAt() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
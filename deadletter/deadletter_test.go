@@ -0,0 +1,24 @@
+package deadletter
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateNewSink(t *testing.T) {
+	Convey("When a dead letter sink is created from configuration", t, func() {
+		dir := filepath.Join(t.TempDir(), "dead-letters")
+		none, noneErr := NewSink(&config.Config{})
+		file, fileErr := NewSink(&config.Config{DeadLetterDir: dir})
+		_, conflictErr := NewSink(&config.Config{DeadLetterDir: dir, DeadLetterTopic: "dead-letters"})
+		Convey("Then the sink configured should be returned", func() {
+			So(none, ShouldBeNil)
+			So(noneErr, ShouldBeNil)
+			So(fileErr, ShouldBeNil)
+			So(file.(*FileSink).dir, ShouldEqual, dir)
+			So(conflictErr.Error(), ShouldEqual, "DEAD_LETTER_DIR and DEAD_LETTER_TOPIC cannot both be specified")
+		})
+	})
+}
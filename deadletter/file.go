@@ -0,0 +1,40 @@
+package deadletter
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Records each dead letter as a JSON file in a directory, named after the topic, partition and offset it was
+// consumed from. A message that fails again, e.g. when it is consumed by another instance, overwrites its file.
+type FileSink struct {
+	dir string
+}
+
+// Construct a new FileSink instance, creating the directory if it does not exist.
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+func (s *FileSink) Record(letter *model.DeadLetter) error {
+	data, err := jsonproducer.Instance().Marshal(&record{
+		Topic:      letter.Topic,
+		Partition:  letter.Partition,
+		Offset:     letter.Offset,
+		Data:       letter.Data,
+		Error:      letter.Error,
+		RecordedAt: recordedAt(),
+	})
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d-%d.json", letter.Topic, letter.Partition, letter.Offset)
+	return ioutil.WriteFile(filepath.Join(s.dir, name), data, 0644)
+}
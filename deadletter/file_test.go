@@ -0,0 +1,40 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordDeadLetterToFile(t *testing.T) {
+	Convey("Given a file sink has been created", t, func() {
+		dir := t.TempDir()
+		sink, err := NewFileSink(dir)
+		So(err, ShouldBeNil)
+		Convey("When a dead letter is recorded", func() {
+			err := sink.Record(&model.DeadLetter{
+				Topic:     "stream-company-profile",
+				Partition: 1,
+				Offset:    42,
+				Data:      []byte("abc"),
+				Error:     "something went wrong",
+			})
+			data, readErr := ioutil.ReadFile(filepath.Join(dir, "stream-company-profile-1-42.json"))
+			actual := &record{}
+			_ = json.Unmarshal(data, actual)
+			Convey("Then it should be written to a file named after where it was consumed from", func() {
+				So(err, ShouldBeNil)
+				So(readErr, ShouldBeNil)
+				So(actual.Topic, ShouldEqual, "stream-company-profile")
+				So(actual.Partition, ShouldEqual, 1)
+				So(actual.Offset, ShouldEqual, 42)
+				So(actual.Data, ShouldResemble, []byte("abc"))
+				So(actual.Error, ShouldEqual, "something went wrong")
+				So(actual.RecordedAt, ShouldNotBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,51 @@
+package deadletter
+
+import (
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"strconv"
+)
+
+// Produces each dead letter to a Kafka topic, keyed by the topic, partition and offset it was consumed from. The
+// message value holds the raw bytes of the dead letter and its headers say where it was consumed from and why it
+// could not be transformed.
+type KafkaSink struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// Construct a new KafkaSink instance producing to the given topic.
+func NewKafkaSink(brokerAddr []string, topic string) (*KafkaSink, error) {
+	config := sarama.NewConfig()
+	// Message headers are only supported from this version onwards
+	config.Version = sarama.V0_11_0_0
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	producer, err := sarama.NewSyncProducer(brokerAddr, config)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaSink{producer: producer, topic: topic}, nil
+}
+
+func (s *KafkaSink) Record(letter *model.DeadLetter) error {
+	_, _, err := s.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: s.topic,
+		Key:   sarama.StringEncoder(fmt.Sprintf("%s:%d:%d", letter.Topic, letter.Partition, letter.Offset)),
+		Value: sarama.ByteEncoder(letter.Data),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("topic"), Value: []byte(letter.Topic)},
+			{Key: []byte("partition"), Value: []byte(strconv.Itoa(int(letter.Partition)))},
+			{Key: []byte("offset"), Value: []byte(strconv.FormatInt(letter.Offset, 10))},
+			{Key: []byte("error"), Value: []byte(letter.Error)},
+			{Key: []byte("recorded_at"), Value: []byte(recordedAt())},
+		},
+	})
+	return err
+}
+
+// Close the connection to Kafka.
+func (s *KafkaSink) Close() error {
+	return s.producer.Close()
+}
@@ -0,0 +1,72 @@
+package deadletter
+
+import (
+	"errors"
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRecordDeadLetterToKafka(t *testing.T) {
+	Convey("Given a Kafka sink has been created", t, func() {
+		producer := mocks.NewSyncProducer(t, nil)
+		var sent *sarama.ProducerMessage
+		producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+			if string(val) != "abc" {
+				return errors.New("unexpected value: " + string(val))
+			}
+			return nil
+		})
+		sink := &KafkaSink{producer: &capturingProducer{SyncProducer: producer, sent: &sent}, topic: "dead-letters"}
+		Convey("When a dead letter is recorded", func() {
+			err := sink.Record(&model.DeadLetter{
+				Topic:     "stream-company-profile",
+				Partition: 1,
+				Offset:    42,
+				Data:      []byte("abc"),
+				Error:     "something went wrong",
+			})
+			Convey("Then it should be produced to the dead letter topic with headers saying where it came from", func() {
+				So(err, ShouldBeNil)
+				So(sent.Topic, ShouldEqual, "dead-letters")
+				key, _ := sent.Key.Encode()
+				So(string(key), ShouldEqual, "stream-company-profile:1:42")
+				So(sent.Headers[:4], ShouldResemble, []sarama.RecordHeader{
+					{Key: []byte("topic"), Value: []byte("stream-company-profile")},
+					{Key: []byte("partition"), Value: []byte("1")},
+					{Key: []byte("offset"), Value: []byte("42")},
+					{Key: []byte("error"), Value: []byte("something went wrong")},
+				})
+				So(sink.Close(), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfDeadLetterCannotBeProduced(t *testing.T) {
+	Convey("Given a Kafka sink whose producer will fail", t, func() {
+		producer := mocks.NewSyncProducer(t, nil)
+		producer.ExpectSendMessageAndFail(sarama.ErrNotLeaderForPartition)
+		sink := &KafkaSink{producer: producer, topic: "dead-letters"}
+		Convey("When a dead letter is recorded", func() {
+			err := sink.Record(&model.DeadLetter{Topic: "stream-company-profile"})
+			Convey("Then the error should be returned", func() {
+				So(err, ShouldEqual, sarama.ErrNotLeaderForPartition)
+				So(sink.Close(), ShouldBeNil)
+			})
+		})
+	})
+}
+
+// Keeps hold of the last message sent by the wrapped producer.
+type capturingProducer struct {
+	sarama.SyncProducer
+	sent **sarama.ProducerMessage
+}
+
+func (p *capturingProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	*p.sent = msg
+	return p.SyncProducer.SendMessage(msg)
+}
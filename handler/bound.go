@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"net/url"
+	"strconv"
+)
+
+const (
+	untilRequestParam      = "until"
+	untilTimeRequestParam  = "until_time"
+	limitRequestParam      = "limit"
+	endReasonUntil         = "until"
+	endReasonLimit         = "limit"
+	endReasonServerClosing = "server_closing"
+	endReasonSlowConsumer  = "slow_consumer"
+	msgConflictingEnd      = "until and until_time cannot both be specified"
+	msgEndInFuture         = "until_time cannot be in the future"
+)
+
+// The point at which a bounded replay of a stream ends, either once every partition has been streamed up to an end
+// offset or once a number of messages have been written.
+type bound struct {
+	end     model.Cursor
+	limit   int
+	written int
+}
+
+// Parse the limit on the number of messages to write from the limit parameter. Zero is returned if no limit has been
+// requested.
+func parseLimit(query url.Values) (int, error) {
+	input := query.Get(limitRequestParam)
+	if input == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(input)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid limit: %s", input)
+	}
+	return limit, nil
+}
+
+// Parse the last offset to stream from each partition from the until parameter, which takes the same form as a
+// cursor. The returned end cursor holds the first offset of each partition not to be streamed.
+func parseUntil(query url.Values) (model.Cursor, error) {
+	if query.Get(untilRequestParam) != "" && query.Get(untilTimeRequestParam) != "" {
+		return nil, errors.New(msgConflictingEnd)
+	}
+	until, err := model.ParseCursor(query.Get(untilRequestParam))
+	if err != nil || until == nil {
+		return nil, err
+	}
+	end := make(model.Cursor)
+	for partition, offset := range until {
+		end[partition] = offset + 1
+	}
+	return end, nil
+}
+
+// Return true if the message lies within the bound and should be considered for streaming. Messages on partitions
+// without an end offset are excluded once end offsets have been given.
+func (b *bound) includes(event *model.StreamEvent) bool {
+	if b == nil || b.end == nil {
+		return true
+	}
+	end, ok := b.end[event.Partition]
+	return ok && event.Offset < end
+}
+
+// Record that a message has been written to the user.
+func (b *bound) count() {
+	if b != nil {
+		b.written++
+	}
+}
+
+// Return the reason the stream has ended given the position the user has reached within each partition, or an empty
+// string if the bound has not yet been reached.
+func (b *bound) reached(position model.Cursor) string {
+	if b == nil {
+		return ""
+	}
+	if b.limit > 0 && b.written >= b.limit {
+		return endReasonLimit
+	}
+	if b.end == nil {
+		return ""
+	}
+	for partition, end := range b.end {
+		if offset, ok := position[partition]; !ok || offset < end {
+			return ""
+		}
+	}
+	return endReasonUntil
+}
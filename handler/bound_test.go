@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/url"
+	"testing"
+)
+
+func TestParseStreamBounds(t *testing.T) {
+	Convey("When the bounds of a stream are parsed", t, func() {
+		query, _ := url.ParseQuery("until=0:100,1:20&limit=50")
+		end, untilErr := parseUntil(query)
+		limit, limitErr := parseLimit(query)
+		Convey("Then the end cursor should hold the first offset of each partition not to be streamed", func() {
+			So(untilErr, ShouldBeNil)
+			So(limitErr, ShouldBeNil)
+			So(end, ShouldResemble, model.Cursor{0: 101, 1: 21})
+			So(limit, ShouldEqual, 50)
+		})
+	})
+}
+
+func TestReturnErrorIfStreamBoundsInvalid(t *testing.T) {
+	Convey("When invalid stream bounds are parsed", t, func() {
+		_, conflictErr := parseUntil(url.Values{"until": {"10"}, "until_time": {"2020-01-02T03:04:05Z"}})
+		_, untilErr := parseUntil(url.Values{"until": {"x"}})
+		_, limitErr := parseLimit(url.Values{"limit": {"0"}})
+		Convey("Then an error should be returned", func() {
+			So(conflictErr.Error(), ShouldEqual, "until and until_time cannot both be specified")
+			So(untilErr.Error(), ShouldEqual, "invalid cursor position: x")
+			So(limitErr.Error(), ShouldEqual, "invalid limit: 0")
+		})
+	})
+}
+
+func TestUnboundedStreamNeverEnds(t *testing.T) {
+	Convey("Given a stream without a bound", t, func() {
+		var unbounded *bound
+		Convey("Then every message should be included and the stream should never end", func() {
+			unbounded.count()
+			So(unbounded.includes(&model.StreamEvent{Offset: 1000}), ShouldBeTrue)
+			So(unbounded.reached(model.Cursor{0: 1000}), ShouldEqual, "")
+		})
+	})
+}
+
+func TestStreamEndsWhenEveryPartitionReachesEndOffset(t *testing.T) {
+	Convey("Given a stream bounded by end offsets on two partitions", t, func() {
+		streamBound := &bound{end: model.Cursor{0: 10, 1: 5}}
+		Convey("Then only messages before the end offsets should be included", func() {
+			So(streamBound.includes(&model.StreamEvent{Offset: 9, Partition: 0}), ShouldBeTrue)
+			So(streamBound.includes(&model.StreamEvent{Offset: 10, Partition: 0}), ShouldBeFalse)
+			So(streamBound.includes(&model.StreamEvent{Offset: 0, Partition: 2}), ShouldBeFalse)
+		})
+		Convey("Then the stream should end once both partitions reach their end offsets", func() {
+			So(streamBound.reached(model.Cursor{0: 10, 1: 4}), ShouldEqual, "")
+			So(streamBound.reached(model.Cursor{0: 10}), ShouldEqual, "")
+			So(streamBound.reached(model.Cursor{0: 10, 1: 5}), ShouldEqual, "until")
+		})
+	})
+}
+
+func TestStreamEndsWhenLimitReached(t *testing.T) {
+	Convey("Given a stream limited to two messages", t, func() {
+		streamBound := &bound{limit: 2}
+		Convey("When two messages are written", func() {
+			streamBound.count()
+			first := streamBound.reached(model.Cursor{0: 1})
+			streamBound.count()
+			second := streamBound.reached(model.Cursor{0: 2})
+			Convey("Then the stream should end after the second message", func() {
+				So(first, ShouldEqual, "")
+				So(second, ShouldEqual, "limit")
+			})
+		})
+	})
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	acceptEncodingHeader  = "Accept-Encoding"
+	contentEncodingHeader = "Content-Encoding"
+	encodingIdentity      = "identity"
+	encodingGzip          = "gzip"
+	encodingBrotli        = "br"
+	encodingZstd          = "zstd"
+	brotliQuality         = 5
+)
+
+// The content encodings the stream can be compressed with, most preferred first.
+var supportedEncodings = []string{encodingBrotli, encodingZstd, encodingGzip}
+
+// A streaming compressor that can be flushed so that each event reaches the user as soon as it has been written.
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// Writes the stream to the user through the compressor negotiated with them, counting the bytes written before and
+// after compression. Flushing the writer flushes the compressor before the underlying response.
+type encodedWriter struct {
+	http.ResponseWriter
+	encoding     string
+	encoder      encoder
+	uncompressed prometheus.Counter
+	compressed   prometheus.Counter
+}
+
+// Writes to the underlying response, counting the bytes written.
+type countingWriter struct {
+	writer  io.Writer
+	counter prometheus.Counter
+}
+
+// Wrap the response in a writer compressing the stream with the most preferred content encoding accepted by the user,
+// if any. The writer must be closed once the stream has ended.
+func newEncodedWriter(writer http.ResponseWriter, request *http.Request, topic string) *encodedWriter {
+	encoding := negotiateEncoding(request.Header.Get(acceptEncodingHeader))
+	encoded := &encodedWriter{
+		ResponseWriter: writer,
+		encoding:       encoding,
+		uncompressed:   metrics.UncompressedBytes.WithLabelValues(topic, encoding),
+		compressed:     metrics.CompressedBytes.WithLabelValues(topic, encoding),
+	}
+	writer.Header().Add("Vary", acceptEncodingHeader)
+	if encoding == encodingIdentity {
+		return encoded
+	}
+	writer.Header().Set(contentEncodingHeader, encoding)
+	output := &countingWriter{writer: writer, counter: encoded.compressed}
+	switch encoding {
+	case encodingBrotli:
+		encoded.encoder = brotli.NewWriterLevel(output, brotliQuality)
+	case encodingZstd:
+		// The encoder cannot fail with these options
+		encoded.encoder, _ = zstd.NewWriter(output, zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+	default:
+		encoded.encoder = gzip.NewWriter(output)
+	}
+	return encoded
+}
+
+func (w *encodedWriter) Write(data []byte) (int, error) {
+	w.uncompressed.Add(float64(len(data)))
+	if w.encoder == nil {
+		w.compressed.Add(float64(len(data)))
+		return w.ResponseWriter.Write(data)
+	}
+	return w.encoder.Write(data)
+}
+
+func (w *encodedWriter) Flush() {
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// Write any data held by the compressor and end the compressed stream.
+func (w *encodedWriter) Close() error {
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	w.ResponseWriter.(http.Flusher).Flush()
+	return err
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	written, err := w.writer.Write(data)
+	w.counter.Add(float64(written))
+	return written, err
+}
+
+// Return the most preferred supported content encoding accepted by the user given their Accept-Encoding header, or
+// identity if they accept none. Encodings given a zero quality value are not accepted.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := qualities(acceptEncoding)
+	best, bestQuality := encodingIdentity, 0.0
+	for _, encoding := range supportedEncodings {
+		quality, ok := accepted[encoding]
+		if !ok {
+			quality, ok = accepted["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// Return the quality value given to each value listed in an Accept or Accept-Encoding header, keyed by the lower case
+// value. Values without a quality value are given a quality of 1 and parameters other than the quality are ignored.
+func qualities(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if value == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		accepted[value] = quality
+	}
+	return accepted
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	Convey("When the content encoding is negotiated", t, func() {
+		Convey("Then the most preferred encoding accepted should be chosen", func() {
+			So(negotiateEncoding(""), ShouldEqual, "identity")
+			So(negotiateEncoding("deflate"), ShouldEqual, "identity")
+			So(negotiateEncoding("gzip"), ShouldEqual, "gzip")
+			So(negotiateEncoding("gzip, deflate, br, zstd"), ShouldEqual, "br")
+			So(negotiateEncoding("gzip, ZSTD"), ShouldEqual, "zstd")
+			So(negotiateEncoding("*"), ShouldEqual, "br")
+		})
+		Convey("Then the quality values given by the user should take precedence", func() {
+			So(negotiateEncoding("br;q=0.5, gzip"), ShouldEqual, "gzip")
+			So(negotiateEncoding("gzip;q=0, deflate"), ShouldEqual, "identity")
+			So(negotiateEncoding("*;q=0.1, zstd;q=0.2"), ShouldEqual, "zstd")
+			So(negotiateEncoding("*, br;q=0"), ShouldEqual, "zstd")
+		})
+	})
+}
+
+func TestFlushCompressedEvents(t *testing.T) {
+	decoders := map[string]func(io.Reader) io.Reader{
+		"gzip": func(r io.Reader) io.Reader {
+			reader, _ := gzip.NewReader(r)
+			return reader
+		},
+		"br": func(r io.Reader) io.Reader {
+			return brotli.NewReader(r)
+		},
+		"zstd": func(r io.Reader) io.Reader {
+			reader, _ := zstd.NewReader(r)
+			return reader
+		},
+	}
+	for encoding, decoder := range decoders {
+		Convey("Given a stream compressed with "+encoding, t, func() {
+			request := httptest.NewRequest("GET", "/endpoint", nil)
+			request.Header.Add("Accept-Encoding", encoding)
+			response := httptest.NewRecorder()
+			writer := newEncodedWriter(response, request, "topic")
+			Convey("When an event is written and flushed", func() {
+				_, _ = writer.Write([]byte("Hello world\n"))
+				writer.Flush()
+				Convey("Then the event should be readable before the stream has ended", func() {
+					So(response.Header().Get("Content-Encoding"), ShouldEqual, encoding)
+					actual := make([]byte, len("Hello world\n"))
+					_, err := io.ReadFull(decoder(bytes.NewReader(response.Body.Bytes())), actual)
+					So(err, ShouldBeNil)
+					So(string(actual), ShouldEqual, "Hello world\n")
+					So(writer.Close(), ShouldBeNil)
+				})
+			})
+		})
+	}
+	Convey("Given a stream the user has not asked to be compressed", t, func() {
+		response := httptest.NewRecorder()
+		writer := newEncodedWriter(response, httptest.NewRequest("GET", "/endpoint", nil), "topic")
+		Convey("When an event is written and flushed", func() {
+			_, _ = writer.Write([]byte("Hello world\n"))
+			writer.Flush()
+			Convey("Then the event should be written as it is", func() {
+				So(response.Header().Get("Content-Encoding"), ShouldBeEmpty)
+				So(response.Body.String(), ShouldEqual, "Hello world\n")
+				So(response.Flushed, ShouldBeTrue)
+				So(writer.Close(), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"net/http"
+)
+
+const (
+	formatRequestParam = "format"
+	fieldsRequestParam = "fields"
+	acceptHeader       = "Accept"
+	formatJSON         = "json"
+	formatNDJSON       = "ndjson"
+	formatEventStream  = "sse"
+	formatCSV          = "csv"
+	formatProtobuf     = "protobuf"
+)
+
+// A format a stream can be written in, requested by name with the format parameter or by media type in the Accept
+// header.
+type outputFormat struct {
+	name        string
+	mediaTypes  []string
+	contentType string
+	// Serialises each message, or nil if messages are written as they were transformed by the consumer
+	serialiser transformer.Serialisable
+	// Serialises heartbeats and other notices, or nil if they are written as server-sent events
+	notices transformer.NoticeSerialisable
+	// Written once at the start of the stream, e.g. the header row of CSV
+	header string
+	// Return a serialiser writing messages with the given resource serialiser, or nil if fields cannot be projected
+	project func(resourceDataSerialiser transformer.Marshallable) transformer.Serialisable
+}
+
+// Return the formats streams can be written in. The first is written to users who request none of the others, and
+// is the JSON record carrying the resource as a string of JSON that the consumer transforms each message to.
+func newOutputFormats() []*outputFormat {
+	csv := transformer.NewCSVSerialiser(jsonproducer.Instance())
+	protobuf := transformer.NewProtobufSerialiser()
+	ndjson := transformer.NewNDJSONSerialiser(jsonproducer.Instance(), jsonproducer.Instance())
+	return []*outputFormat{
+		{
+			name:       formatJSON,
+			mediaTypes: []string{"application/json"},
+			notices:    transformer.NewSerialiser(jsonproducer.Instance(), jsonproducer.Instance()),
+			project: func(resourceDataSerialiser transformer.Marshallable) transformer.Serialisable {
+				return transformer.NewSerialiser(resourceDataSerialiser, jsonproducer.Instance())
+			},
+		},
+		{
+			name:        formatNDJSON,
+			mediaTypes:  []string{"application/x-ndjson"},
+			contentType: "application/x-ndjson",
+			serialiser:  ndjson,
+			notices:     ndjson,
+			project: func(resourceDataSerialiser transformer.Marshallable) transformer.Serialisable {
+				return transformer.NewNDJSONSerialiser(resourceDataSerialiser, jsonproducer.Instance())
+			},
+		},
+		{
+			name:        formatEventStream,
+			mediaTypes:  []string{eventStreamMimeType},
+			contentType: eventStreamMimeType,
+			project: func(resourceDataSerialiser transformer.Marshallable) transformer.Serialisable {
+				return transformer.NewEventStreamSerialiser(resourceDataSerialiser)
+			},
+		},
+		{
+			name:        formatCSV,
+			mediaTypes:  []string{"text/csv"},
+			contentType: "text/csv; charset=utf-8",
+			serialiser:  csv,
+			notices:     csv,
+			header:      csv.Header(),
+		},
+		{
+			name:        formatProtobuf,
+			mediaTypes:  []string{"application/x-protobuf", "application/protobuf"},
+			contentType: "application/x-protobuf",
+			serialiser:  protobuf,
+			notices:     protobuf,
+		},
+	}
+}
+
+// Return the format the user has requested the stream in, by name with the format parameter or failing that as the
+// supported media type given the highest quality value in their Accept header. An error is returned if the format
+// parameter names a format that is not supported.
+func (h *RequestHandler) negotiateFormat(request *http.Request) (*outputFormat, error) {
+	if name := request.URL.Query().Get(formatRequestParam); name != "" {
+		for _, format := range h.formats {
+			if format.name == name {
+				return format, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid format: %s", name)
+	}
+	accepted := qualities(request.Header.Get(acceptHeader))
+	best, bestQuality := h.formats[0], 0.0
+	for _, format := range h.formats {
+		for _, mediaType := range format.mediaTypes {
+			if quality, ok := accepted[mediaType]; ok && quality > bestQuality {
+				best, bestQuality = format, quality
+			}
+		}
+	}
+	return best, nil
+}
+
+// Return the serialiser to write messages with in the format requested, keeping only the fields the user has
+// requested with the fields parameter if any, or nil if messages should be written as they were transformed by the
+// consumer. An error is returned if the fields are unknown or cannot be projected in the format requested.
+func (h *RequestHandler) messageSerialiser(request *http.Request, format *outputFormat) (transformer.Serialisable, error) {
+	projection, err := transformer.ParseProjection(request.URL.Query().Get(fieldsRequestParam))
+	if err != nil {
+		return nil, err
+	}
+	if projection == nil {
+		if format.eventStream() {
+			return h.eventStreamSerialiser, nil
+		}
+		return format.serialiser, nil
+	}
+	if format.project == nil {
+		return nil, fmt.Errorf("fields cannot be projected in %s format", format.name)
+	}
+	return format.project(projection), nil
+}
+
+func (f *outputFormat) eventStream() bool {
+	return f.name == formatEventStream
+}
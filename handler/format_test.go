@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	Convey("Given a request handler instance", t, func() {
+		requestHandler := NewRequestHandler(&mockConsumerRunner{}, &mockLogger{})
+		negotiate := func(target string, accept string) string {
+			request := httptest.NewRequest("GET", target, nil)
+			if accept != "" {
+				request.Header.Add("Accept", accept)
+			}
+			format, err := requestHandler.negotiateFormat(request)
+			So(err, ShouldBeNil)
+			return format.name
+		}
+		Convey("When the output format is negotiated", func() {
+			Convey("Then the format parameter should take precedence over the Accept header", func() {
+				So(negotiate("/endpoint?format=csv", "text/event-stream"), ShouldEqual, "csv")
+				So(negotiate("/endpoint?format=protobuf", ""), ShouldEqual, "protobuf")
+			})
+			Convey("Then the accepted media type with the highest quality value should be chosen", func() {
+				So(negotiate("/endpoint", "application/x-ndjson"), ShouldEqual, "ndjson")
+				So(negotiate("/endpoint", "text/html, text/event-stream"), ShouldEqual, "sse")
+				So(negotiate("/endpoint", "text/csv;q=0.5, application/protobuf"), ShouldEqual, "protobuf")
+				So(negotiate("/endpoint", "text/csv;q=0"), ShouldEqual, "json")
+			})
+			Convey("Then the JSON format should be chosen if no supported media type is accepted", func() {
+				So(negotiate("/endpoint", ""), ShouldEqual, "json")
+				So(negotiate("/endpoint", "*/*"), ShouldEqual, "json")
+			})
+		})
+		Convey("When an unsupported format is requested", func() {
+			_, err := requestHandler.negotiateFormat(httptest.NewRequest("GET", "/endpoint?format=xml", nil))
+			Convey("Then an error should be returned", func() {
+				So(err.Error(), ShouldEqual, "invalid format: xml")
+			})
+		})
+	})
+}
+
+func TestWriteMessagesInRequestedFormat(t *testing.T) {
+	Convey("Given a user requesting CSV is connected to the request handler", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint?format=csv", nil)
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		Convey("When a new message is published", func() {
+			resource := &rcd.ResourceChangedData{
+				ResourceKind: "company-profile",
+				ResourceURI:  "/company/00000001",
+				ResourceID:   "00000001",
+				Data:         map[string]interface{}{"company_name": "ACME LIMITED"},
+				Event:        rcd.Event{Timepoint: 7, Partition: 1, PublishedAt: "2021-01-01T00:00:00", Type: "changed"},
+			}
+			waitGroup.Add(1)
+			subscription <- &model.StreamEvent{Data: "Hello world", Resource: resource, Offset: 7, Partition: 1}
+			waitGroup.Wait()
+			Convey("Then a header row and a row for the message should be written", func() {
+				So(response.Code, ShouldEqual, 200)
+				So(response.Header().Get("Content-Type"), ShouldEqual, "text/csv; charset=utf-8")
+				So(response.Body.String(), ShouldEqual, "type,offset,partition,published_at,event_type,resource_kind,resource_id,resource_uri,company_number,fields_changed,data\r\n"+
+					"event,7,1,2021-01-01T00:00:00,changed,company-profile,00000001,/company/00000001,00000001,,\"{\"\"company_name\"\":\"\"ACME LIMITED\"\"}\"\r\n")
+			})
+		})
+	})
+}
+
+func TestHandlerReturnsBadRequestIfFormatUnsupported(t *testing.T) {
+	Convey("Given a request handler instance", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint?format=xml", nil)
+		response := httptest.NewRecorder()
+		Convey("When a format that is not supported is requested", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then a bad request response should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+				So(consumerManager.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestWriteProjectedFields(t *testing.T) {
+	Convey("Given a user requesting only some fields as newline delimited JSON is connected to the request handler", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint?format=ndjson&fields=data.company_number,event.type", nil)
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		Convey("When a new message is published", func() {
+			resource := &rcd.ResourceChangedData{
+				ResourceKind: "company-officers",
+				Data:         map[string]interface{}{"company_number": "00000001", "name": "SMITH, John"},
+				Event:        rcd.Event{Timepoint: 7, Partition: 1, Type: "changed"},
+			}
+			waitGroup.Add(1)
+			subscription <- &model.StreamEvent{Data: "Hello world", Resource: resource, Offset: 7, Partition: 1}
+			waitGroup.Wait()
+			Convey("Then only the requested fields should be written together with the offset", func() {
+				So(response.Code, ShouldEqual, 200)
+				So(response.Body.String(), ShouldEqual, `{"data":{"data":{"company_number":"00000001"},"event":{"type":"changed"}},"offset":7,"partition":1}`+"\n")
+			})
+		})
+	})
+}
+
+func TestHandlerReturnsBadRequestIfFieldsCannotBeProjected(t *testing.T) {
+	Convey("Given a request handler instance", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		unknown := httptest.NewRequest("GET", "/endpoint?fields=resource_id,company_number", nil)
+		unknownResponse := httptest.NewRecorder()
+		csv := httptest.NewRequest("GET", "/endpoint?format=csv&fields=resource_id", nil)
+		csvResponse := httptest.NewRecorder()
+		Convey("When unknown fields or fields in a format with fixed columns are requested", func() {
+			requestHandler.HandleRequest(unknownResponse, unknown)
+			requestHandler.HandleRequest(csvResponse, csv)
+			Convey("Then a bad request response should be returned", func() {
+				So(unknownResponse.Code, ShouldEqual, http.StatusBadRequest)
+				So(csvResponse.Code, ShouldEqual, http.StatusBadRequest)
+				So(consumerManager.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
@@ -1,63 +1,224 @@
 package handler
 
 import (
+	"errors"
 	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
 	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"github.com/companieshouse/chs.go/log"
 	"net/http"
-	"strconv"
 	"sync"
+	"time"
 )
 
 const (
 	offsetRequestParam  = "offset"
+	sinceRequestParam   = "since"
+	lastEventIDHeader   = "Last-Event-ID"
+	eventStreamMimeType = "text/event-stream"
 	msgUserConnected    = "user connected"
 	msgUserDisconnected = "user disconnected"
+	msgStreamEnded      = "stream ended"
+	msgServerClosing    = "server closing"
+	msgSlowConsumer     = "user too far behind stream"
+	msgMessagesDropped  = "messages dropped"
+	msgConflictingStart = "offset and since cannot both be specified"
 )
 
 type RequestHandler struct {
-	runner Controllable
-	logger logger.Logger
-	wg     *sync.WaitGroup
+	runner                Controllable
+	eventStreamSerialiser transformer.Serialisable
+	jsonSerialiser        transformer.Marshallable
+	formats               []*outputFormat
+	heartbeatInterval     time.Duration
+	closing               <-chan struct{}
+	logger                logger.Logger
+	wg                    *sync.WaitGroup
 }
 
 type Controllable interface {
-	StartConsumer(offset int64) (runner.Controllable, error)
+	Topic() string
+	StartConsumer(cursor model.Cursor) (runner.Controllable, error)
+	HighWaterMarks() (model.Cursor, error)
+	OffsetsAt(since time.Time) (model.Cursor, error)
+	OffsetsBefore(until time.Time) (model.Cursor, error)
 }
 
 func NewRequestHandler(runner Controllable, logger logger.Logger) *RequestHandler {
 	return &RequestHandler{
-		runner: runner,
-		logger: logger,
+		runner:                runner,
+		eventStreamSerialiser: transformer.NewEventStreamSerialiser(jsonproducer.Instance()),
+		jsonSerialiser:        jsonproducer.Instance(),
+		formats:               newOutputFormats(),
+		logger:                logger,
 	}
 }
 
+// Write a heartbeat carrying the high-water mark of the topic to connections that have been idle for the given
+// interval. Heartbeats are disabled if the interval is not positive.
+func (h *RequestHandler) WithHeartbeat(interval time.Duration) *RequestHandler {
+	h.heartbeatInterval = interval
+	return h
+}
+
+// Close every connection, telling users where to resume from, once the given channel is closed.
+func (h *RequestHandler) WithShutdown(closing <-chan struct{}) *RequestHandler {
+	h.closing = closing
+	return h
+}
+
 func (h *RequestHandler) HandleRequest(writer http.ResponseWriter, request *http.Request) {
-	var offset int64 = -1
-	var err error
 	h.logger.InfoR(request, msgUserConnected)
-	if offsetParam := request.URL.Query().Get(offsetRequestParam); offsetParam != "" {
-		offset, err = strconv.ParseInt(offsetParam, 10, 64)
-		if err != nil {
-			h.logger.ErrorR(request, err)
-			writer.WriteHeader(http.StatusBadRequest)
-			return
+	cursor, ok := h.startCursor(writer, request)
+	if !ok {
+		return
+	}
+	filter, err := model.ParseFilter(request.URL.Query())
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	format, err := h.negotiateFormat(request)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	serialiser, err := h.messageSerialiser(request, format)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	streamBound, ok := h.streamBound(writer, request)
+	if !ok {
+		return
+	}
+	resumeCursor := make(model.Cursor)
+	for partition, offset := range cursor {
+		resumeCursor[partition] = offset
+	}
+	// Partitions followed from the live head start from their high-water mark, which is read before subscribing so
+	// that users resuming before any message has been delivered on a partition miss nothing produced meanwhile
+	highWaterMarks, err := h.runner.HighWaterMarks()
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for partition, offset := range highWaterMarks {
+		if start, ok := resumeCursor[partition]; !ok || start < 0 {
+			resumeCursor[partition] = offset
 		}
 	}
-	controller, err := h.runner.StartConsumer(offset)
+	controller, err := h.runner.StartConsumer(cursor)
+	var outOfRange *runner.OffsetOutOfRangeError
+	if errors.As(err, &outOfRange) {
+		h.logger.ErrorR(request, err)
+		status := http.StatusRequestedRangeNotSatisfiable
+		if outOfRange.Expired() {
+			status = http.StatusGone
+		}
+		h.writeError(writer, request, status, &json.OffsetOutOfRange{
+			Error:          outOfRange.Error(),
+			Partition:      outOfRange.Partition,
+			Offset:         outOfRange.Offset,
+			EarliestOffset: outOfRange.Earliest,
+			LatestOffset:   outOfRange.Latest,
+		})
+		return
+	}
 	if err != nil {
 		h.logger.ErrorR(request, err)
 		writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	connections := metrics.Connections.WithLabelValues(h.runner.Topic())
+	connections.Inc()
+	defer connections.Dec()
+	published := metrics.MessagesPublished.WithLabelValues(h.runner.Topic())
+	encoded := newEncodedWriter(writer, request, h.runner.Topic())
+	defer func() {
+		_ = encoded.Close()
+	}()
+	writer = encoded
+	if format.contentType != "" {
+		writer.Header().Set("Content-Type", format.contentType)
+	}
+	if format.eventStream() {
+		writer.Header().Set("Cache-Control", "no-cache")
+	}
 	writer.WriteHeader(http.StatusOK)
+	if format.header != "" {
+		_, _ = writer.Write([]byte(format.header))
+	}
+	if reason := streamBound.reached(resumeCursor); reason != "" {
+		h.endStream(writer, request, controller, reason, resumeCursor, format)
+		return
+	}
+	heartbeat := newIdleTimer(h.heartbeatInterval)
+	defer heartbeat.stop()
 	for {
 		select {
-		case msg := <-controller.Data():
-			_, _ = writer.Write([]byte(msg))
+		case event := <-controller.Data():
+			if streamBound.includes(event) {
+				resumeCursor[event.Partition] = event.Offset + 1
+				if event.Skipped {
+					if filter.IncludeSkipped {
+						h.writeSkipped(writer, request, event, resumeCursor, format)
+						writer.(http.Flusher).Flush()
+						heartbeat.reset()
+					}
+				} else if filter.Matches(event.Resource) {
+					if format.eventStream() {
+						h.writeEvent(writer, request, event, resumeCursor, serialiser)
+					} else {
+						h.writeMessage(writer, request, event, serialiser)
+					}
+					writer.(http.Flusher).Flush()
+					published.Inc()
+					heartbeat.reset()
+					streamBound.count()
+				}
+			}
+			if reason := streamBound.reached(resumeCursor); reason != "" {
+				h.endStream(writer, request, controller, reason, resumeCursor, format)
+				if h.wg != nil {
+					h.wg.Done()
+				}
+				return
+			}
+			if h.wg != nil {
+				h.wg.Done()
+			}
+		case gaps := <-controller.Gaps():
+			h.writeGaps(writer, request, gaps, format)
 			writer.(http.Flusher).Flush()
+			heartbeat.reset()
+			if h.wg != nil {
+				h.wg.Done()
+			}
+		case <-controller.Overflowed():
+			h.endStream(writer, request, controller, endReasonSlowConsumer, resumeCursor, format)
 			if h.wg != nil {
 				h.wg.Done()
 			}
+			return
+		case <-heartbeat.expired():
+			h.writeHeartbeat(writer, request, format)
+			writer.(http.Flusher).Flush()
+			heartbeat.reset()
+		case <-h.closing:
+			h.endStream(writer, request, controller, endReasonServerClosing, resumeCursor, format)
+			if h.wg != nil {
+				h.wg.Done()
+			}
+			return
 		case <-request.Context().Done():
 			controller.Stop(msgUserDisconnected)
 			h.logger.InfoR(request, msgUserDisconnected)
@@ -68,3 +229,285 @@ func (h *RequestHandler) HandleRequest(writer http.ResponseWriter, request *http
 		}
 	}
 }
+
+// Write the message as a server-sent event identified by the cursor the user should resume from if they reconnect.
+func (h *RequestHandler) writeEvent(writer http.ResponseWriter, request *http.Request, event *model.StreamEvent, resumeCursor model.Cursor, serialiser transformer.Serialisable) {
+	data, err := serialiser.Serialise(event.Resource)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		return
+	}
+	_, _ = writer.Write([]byte("id: " + resumeCursor.String() + "\n" + data))
+}
+
+// Write the message with the given serialiser, or as it was transformed by the consumer if there is none.
+func (h *RequestHandler) writeMessage(writer http.ResponseWriter, request *http.Request, event *model.StreamEvent, serialiser transformer.Serialisable) {
+	if serialiser == nil {
+		_, _ = writer.Write([]byte(event.Data))
+		return
+	}
+	data, err := serialiser.Serialise(event.Resource)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		return
+	}
+	_, _ = writer.Write([]byte(data))
+}
+
+// Tell the user that a message could not be transformed, either as a server-sent event identified by the cursor to
+// resume from or as a record in the format requested.
+func (h *RequestHandler) writeSkipped(writer http.ResponseWriter, request *http.Request, event *model.StreamEvent, resumeCursor model.Cursor, format *outputFormat) {
+	skipped := &json.Skipped{Partition: event.Partition, Offset: event.Offset}
+	if format.eventStream() {
+		data, err := h.jsonSerialiser.Marshal(skipped)
+		if err != nil {
+			h.logger.ErrorR(request, err)
+			return
+		}
+		_, _ = writer.Write([]byte("id: " + resumeCursor.String() + "\nevent: skipped\ndata: " + string(data) + "\n\n"))
+		return
+	}
+	h.writeNotice(writer, request, skipped, format)
+}
+
+// Write a keepalive carrying the high-water mark of the topic, either as a server-sent event or as a record in the
+// format requested. A heartbeat is still written if the high-water mark cannot be retrieved so that the connection is
+// kept alive.
+func (h *RequestHandler) writeHeartbeat(writer http.ResponseWriter, request *http.Request, format *outputFormat) {
+	heartbeat := &json.Heartbeat{}
+	highWaterMarks, err := h.runner.HighWaterMarks()
+	if err != nil {
+		h.logger.ErrorR(request, err)
+	} else {
+		heartbeat.HighWaterMarks = highWaterMarks
+	}
+	if format.eventStream() {
+		data, err := h.jsonSerialiser.Marshal(heartbeat)
+		if err != nil {
+			h.logger.ErrorR(request, err)
+			return
+		}
+		_, _ = writer.Write([]byte("event: heartbeat\ndata: " + string(data) + "\n\n"))
+		return
+	}
+	h.writeNotice(writer, request, heartbeat, format)
+}
+
+// Tell the user which messages have been dropped because they have fallen too far behind the stream, either as
+// server-sent events or as records in the format requested.
+func (h *RequestHandler) writeGaps(writer http.ResponseWriter, request *http.Request, gaps []*runner.Gap, format *outputFormat) {
+	for _, gap := range gaps {
+		h.logger.InfoR(request, msgMessagesDropped, log.Data{"partition": gap.Partition, "dropped": gap.Dropped})
+		notice := &json.Gap{
+			Partition:   gap.Partition,
+			FirstOffset: gap.FirstOffset,
+			LastOffset:  gap.LastOffset,
+			Dropped:     gap.Dropped,
+		}
+		if format.eventStream() {
+			data, err := h.jsonSerialiser.Marshal(notice)
+			if err != nil {
+				h.logger.ErrorR(request, err)
+				continue
+			}
+			_, _ = writer.Write([]byte("event: gap\ndata: " + string(data) + "\n\n"))
+			continue
+		}
+		h.writeNotice(writer, request, notice, format)
+	}
+}
+
+// Return the cursor the user has requested to start streaming from. The cursor is either given directly or resolved
+// from the time given by the since parameter, which reconnecting EventSource clients override with the Last-Event-ID
+// header. An error response is written and false returned if the cursor cannot be determined.
+func (h *RequestHandler) startCursor(writer http.ResponseWriter, request *http.Request) (model.Cursor, bool) {
+	query := request.URL.Query()
+	since := query.Get(sinceRequestParam)
+	if since == "" || request.Header.Get(lastEventIDHeader) != "" {
+		cursor, err := model.ParseCursor(startPosition(request))
+		if err != nil {
+			h.logger.ErrorR(request, err)
+			writer.WriteHeader(http.StatusBadRequest)
+			return nil, false
+		}
+		return cursor, true
+	}
+	if query.Get(offsetRequestParam) != "" {
+		h.logger.ErrorR(request, errors.New(msgConflictingStart))
+		writer.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	sinceTime, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	return h.offsetsAt(writer, request, sinceTime)
+}
+
+// Return the bound at which the user has requested the stream to end, or nil if the stream should continue until the
+// user disconnects. An error response is written and false returned if the bound cannot be determined.
+func (h *RequestHandler) streamBound(writer http.ResponseWriter, request *http.Request) (*bound, bool) {
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	end, err := parseUntil(query)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	if untilTime := query.Get(untilTimeRequestParam); untilTime != "" {
+		endTime, err := time.Parse(time.RFC3339, untilTime)
+		if err != nil {
+			h.logger.ErrorR(request, err)
+			writer.WriteHeader(http.StatusBadRequest)
+			return nil, false
+		}
+		// The end of the stream can only be resolved to offsets once every message preceding it has been produced
+		if endTime.After(time.Now()) {
+			h.logger.ErrorR(request, errors.New(msgEndInFuture))
+			writer.WriteHeader(http.StatusBadRequest)
+			return nil, false
+		}
+		// Messages before the end having expired only means there is nothing to replay, so this is not checked
+		if end, err = h.runner.OffsetsBefore(endTime); err != nil {
+			h.logger.ErrorR(request, err)
+			writer.WriteHeader(http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+	if end == nil && limit == 0 {
+		return nil, true
+	}
+	return &bound{end: end, limit: limit}, true
+}
+
+// Resolve the time to the offset of the first message produced at or after it on each partition. An error response
+// is written and false returned if the offsets cannot be resolved.
+func (h *RequestHandler) offsetsAt(writer http.ResponseWriter, request *http.Request, at time.Time) (model.Cursor, bool) {
+	cursor, err := h.runner.OffsetsAt(at)
+	var expired *runner.ExpiredTimestampError
+	if errors.As(err, &expired) {
+		h.logger.ErrorR(request, err)
+		h.writeError(writer, request, http.StatusGone, &json.ExpiredTimestamp{
+			Error:          expired.Error(),
+			Partition:      expired.Partition,
+			Since:          expired.Since.Format(time.RFC3339),
+			EarliestOffset: expired.Earliest,
+		})
+		return nil, false
+	}
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	return cursor, true
+}
+
+// Stop the consumer once the bound requested by the user has been reached, the server is closing or the user has
+// fallen too far behind the stream and write a terminating marker telling the user why the stream ended and where to
+// resume from. EventSource clients receive a closing event rather than an end event when the stream was not ended by
+// the bound, as they should reconnect to resume the stream.
+func (h *RequestHandler) endStream(writer http.ResponseWriter, request *http.Request, controller runner.Controllable, reason string, resumeCursor model.Cursor, format *outputFormat) {
+	msg, eventType := msgStreamEnded, "end"
+	switch reason {
+	case endReasonServerClosing:
+		msg, eventType = msgServerClosing, "closing"
+	case endReasonSlowConsumer:
+		msg, eventType = msgSlowConsumer, "closing"
+	}
+	controller.Stop(msg)
+	h.logger.InfoR(request, msg, log.Data{"reason": reason})
+	end := &json.EndOfStream{Reason: reason, ResumeFrom: resumeCursor.String()}
+	if format.eventStream() {
+		data, err := h.jsonSerialiser.Marshal(end)
+		if err != nil {
+			h.logger.ErrorR(request, err)
+			return
+		}
+		_, _ = writer.Write([]byte("event: " + eventType + "\ndata: " + string(data) + "\n\n"))
+	} else {
+		h.writeNotice(writer, request, end, format)
+	}
+	writer.(http.Flusher).Flush()
+}
+
+// Write a notice, e.g. a heartbeat, in the format requested by the user.
+func (h *RequestHandler) writeNotice(writer http.ResponseWriter, request *http.Request, notice interface{}, format *outputFormat) {
+	data, err := format.notices.SerialiseNotice(notice)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		return
+	}
+	_, _ = writer.Write([]byte(data))
+}
+
+// Reject a request with a JSON body explaining how the user can recover, e.g. the range of offsets they can resume
+// from.
+func (h *RequestHandler) writeError(writer http.ResponseWriter, request *http.Request, status int, body interface{}) {
+	data, err := h.jsonSerialiser.Marshal(body)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(status)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_, _ = writer.Write(data)
+}
+
+// Return the position the user has requested to start streaming from. The Last-Event-ID header sent by reconnecting
+// EventSource clients takes precedence over the offset parameter as it reflects the last event the user received.
+func startPosition(request *http.Request) string {
+	if lastEventID := request.Header.Get(lastEventIDHeader); lastEventID != "" {
+		return lastEventID
+	}
+	return request.URL.Query().Get(offsetRequestParam)
+}
+
+// Fires once a connection has been idle for the given interval. A nil timer never fires.
+type idleTimer struct {
+	timer    *time.Timer
+	interval time.Duration
+}
+
+func newIdleTimer(interval time.Duration) *idleTimer {
+	if interval <= 0 {
+		return nil
+	}
+	return &idleTimer{timer: time.NewTimer(interval), interval: interval}
+}
+
+func (t *idleTimer) expired() <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+// Restart the interval, e.g. after data has been written to the connection.
+func (t *idleTimer) reset() {
+	if t == nil {
+		return
+	}
+	if !t.timer.Stop() {
+		select {
+		case <-t.timer.C:
+		default:
+		}
+	}
+	t.timer.Reset(t.interval)
+}
+
+func (t *idleTimer) stop() {
+	if t != nil {
+		t.timer.Stop()
+	}
+}
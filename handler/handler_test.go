@@ -1,11 +1,18 @@
 package handler
 
 import (
+	"compress/gzip"
+	"context"
 	"errors"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
 	"github.com/companieshouse/chs-streaming-api-backend/runner"
 	"github.com/companieshouse/chs.go/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/mock"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -19,6 +26,8 @@ type mockConsumerRunner struct {
 
 type mockController struct {
 	mock.Mock
+	gaps       chan []*runner.Gap
+	overflowed chan struct{}
 }
 
 type mockContext struct {
@@ -29,6 +38,10 @@ type mockLogger struct {
 	mock.Mock
 }
 
+type mockSerialiser struct {
+	mock.Mock
+}
+
 func TestCreateNewRequestHandler(t *testing.T) {
 	Convey("Given an existing consumer runner", t, func() {
 		consumerRunner := &mockConsumerRunner{}
@@ -38,6 +51,10 @@ func TestCreateNewRequestHandler(t *testing.T) {
 			Convey("Then a new request handler instance should be returned", func() {
 				So(actual, ShouldNotBeNil)
 				So(actual.runner, ShouldEqual, consumerRunner)
+				So(actual.eventStreamSerialiser, ShouldNotBeNil)
+				So(actual.jsonSerialiser, ShouldNotBeNil)
+				So(actual.formats, ShouldHaveLength, 5)
+				So(actual.heartbeatInterval, ShouldEqual, 0)
 				So(actual.logger, ShouldEqual, logger)
 				So(actual.wg, ShouldBeNil)
 			})
@@ -45,11 +62,33 @@ func TestCreateNewRequestHandler(t *testing.T) {
 	})
 }
 
+func TestConfigureRequestHandler(t *testing.T) {
+	Convey("Given a new request handler instance", t, func() {
+		requestHandler := NewRequestHandler(&mockConsumerRunner{}, &mockLogger{})
+		Convey("When a heartbeat interval is configured", func() {
+			actual := requestHandler.WithHeartbeat(30 * time.Second)
+			Convey("Then the interval should be applied to the request handler", func() {
+				So(actual, ShouldEqual, requestHandler)
+				So(actual.heartbeatInterval, ShouldEqual, 30*time.Second)
+			})
+		})
+		Convey("When a shutdown signal is configured", func() {
+			closing := make(chan struct{})
+			actual := requestHandler.WithShutdown(closing)
+			Convey("Then the signal should be applied to the request handler", func() {
+				So(actual, ShouldEqual, requestHandler)
+				So(actual.closing, ShouldEqual, (<-chan struct{})(closing))
+			})
+		})
+	})
+}
+
 func TestWritePublishedMessageToResponseWriter(t *testing.T) {
 	Convey("Given a user is connected to the request handler", t, func() {
 		consumerManager := &mockConsumerRunner{}
-		subscription := make(chan string)
+		subscription := make(chan *model.StreamEvent)
 		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
 		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
 		mockController.On("Data").Return(subscription)
 		logger := &mockLogger{}
@@ -63,28 +102,656 @@ func TestWritePublishedMessageToResponseWriter(t *testing.T) {
 		go requestHandler.HandleRequest(response, request)
 		Convey("When a new message is published", func() {
 			waitGroup.Add(1)
-			subscription <- "Hello world"
+			subscription <- &model.StreamEvent{Data: "Hello world", Offset: 1}
 			waitGroup.Wait()
 			output, _ := response.Body.ReadString('\n')
 			Convey("Then the message should be written to the response body", func() {
 				So(response.Code, ShouldEqual, 200)
 				So(output, ShouldEqual, "Hello world")
 				So(logger.AssertCalled(t, "InfoR", request, "user connected", []log.Data(nil)), ShouldBeTrue)
-				So(consumerManager.AssertCalled(t, "StartConsumer", int64(-1)), ShouldBeTrue)
+				So(consumerManager.AssertCalled(t, "StartConsumer", model.Cursor(nil)), ShouldBeTrue)
 				So(mockController.AssertCalled(t, "Data"), ShouldBeTrue)
 			})
 		})
 	})
 }
 
+func TestWriteServerSentEventIfEventStreamAccepted(t *testing.T) {
+	Convey("Given an EventSource client resuming from partition 0 is connected to the request handler", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		serialiser := &mockSerialiser{}
+		serialiser.On("Serialise", mock.Anything).Return("event: changed\ndata: {}\n\n", nil)
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		requestHandler.eventStreamSerialiser = serialiser
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint?offset=0:5", nil)
+		request.Header.Add("Accept", "text/event-stream")
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		Convey("When a new message is published on another partition", func() {
+			resource := &rcd.ResourceChangedData{Event: rcd.Event{Type: "changed"}}
+			waitGroup.Add(1)
+			subscription <- &model.StreamEvent{Data: "Hello world", Resource: resource, Offset: 7, Partition: 1}
+			waitGroup.Wait()
+			Convey("Then a server-sent event identified by the resume cursor should be written", func() {
+				So(response.Code, ShouldEqual, 200)
+				So(response.Header().Get("Content-Type"), ShouldEqual, "text/event-stream")
+				So(response.Body.String(), ShouldEqual, "id: 0:5,1:8\nevent: changed\ndata: {}\n\n")
+				So(serialiser.AssertCalled(t, "Serialise", resource), ShouldBeTrue)
+				So(consumerManager.AssertCalled(t, "StartConsumer", model.Cursor{0: 5}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestWriteOnlyMessagesMatchingFilter(t *testing.T) {
+	Convey("Given a user filtering on deleted events is connected to the request handler", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint?event_type=deleted", nil)
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		Convey("When a changed and then a deleted event are published", func() {
+			waitGroup.Add(2)
+			subscription <- &model.StreamEvent{Data: "changed\n", Resource: &rcd.ResourceChangedData{Event: rcd.Event{Type: "changed"}}, Offset: 1}
+			subscription <- &model.StreamEvent{Data: "deleted\n", Resource: &rcd.ResourceChangedData{Event: rcd.Event{Type: "deleted"}}, Offset: 2}
+			waitGroup.Wait()
+			Convey("Then only the deleted event should be written to the response body", func() {
+				So(response.Code, ShouldEqual, 200)
+				So(response.Body.String(), ShouldEqual, "deleted\n")
+			})
+		})
+	})
+}
+
+func TestWriteSkippedEventsOnlyIfRequested(t *testing.T) {
+	Convey("Given a user filtering on deleted events has asked to be told about skipped messages", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint?event_type=deleted&include_skipped=true", nil)
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		Convey("When a message that could not be transformed is published", func() {
+			waitGroup.Add(1)
+			subscription <- &model.StreamEvent{Offset: 5, Partition: 1, Skipped: true}
+			waitGroup.Wait()
+			Convey("Then a skipped record naming the offset should be written regardless of the filter", func() {
+				So(response.Body.String(), ShouldEqual, `{"skipped":{"partition":1,"offset":5}}`+"\n")
+			})
+		})
+	})
+	Convey("Given a user has not asked to be told about skipped messages", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint", nil)
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		Convey("When a message that could not be transformed is published", func() {
+			waitGroup.Add(2)
+			subscription <- &model.StreamEvent{Offset: 5, Skipped: true}
+			subscription <- &model.StreamEvent{Data: "Hello world\n", Offset: 6}
+			waitGroup.Wait()
+			Convey("Then nothing should be written in its place", func() {
+				So(response.Body.String(), ShouldEqual, "Hello world\n")
+			})
+		})
+	})
+}
+
+func TestWriteSkippedServerSentEvent(t *testing.T) {
+	Convey("Given an EventSource client has asked to be told about skipped messages", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint?include_skipped=true", nil)
+		request.Header.Add("Accept", "text/event-stream")
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		Convey("When a message that could not be transformed is published", func() {
+			waitGroup.Add(1)
+			subscription <- &model.StreamEvent{Offset: 5, Partition: 1, Skipped: true}
+			waitGroup.Wait()
+			Convey("Then a skipped event identified by the cursor to resume from should be written", func() {
+				So(response.Body.String(), ShouldEqual, "id: 1:6\nevent: skipped\ndata: {\"partition\":1,\"offset\":5}\n\n")
+			})
+		})
+	})
+}
+
+func TestHandlerReturnsBadRequestIfInvalidFilterSpecified(t *testing.T) {
+	Convey("Given a request handler instance", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint?event_type=created", nil)
+		response := httptest.NewRecorder()
+		Convey("When a user filters on an unknown event type", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then a bad request response should be returned without starting a consumer", func() {
+				So(response.Code, ShouldEqual, 400)
+				So(consumerManager.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestResumeFromLastEventID(t *testing.T) {
+	Convey("Given a reconnecting EventSource client supplies a Last-Event-ID header", t, func() {
+		expectedError := errors.New("something went wrong")
+		consumerManager := &mockConsumerRunner{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(&mockController{}, expectedError)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint?offset=3", nil)
+		request.Header.Add("Last-Event-ID", "0:12,1:4")
+		response := httptest.NewRecorder()
+		Convey("When the request is made", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then the stream should be resumed from the last event ID rather than the offset parameter", func() {
+				So(consumerManager.AssertCalled(t, "StartConsumer", model.Cursor{0: 12, 1: 4}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestStartFromTime(t *testing.T) {
+	Convey("Given a user requests the messages produced since a time", t, func() {
+		since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		consumerManager := &mockConsumerRunner{}
+		consumerManager.On("OffsetsAt", mock.Anything).Return(model.Cursor{0: 7, 1: 12}, nil)
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(&mockController{}, errors.New("something went wrong"))
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint?since=2020-01-02T03:04:05Z", nil)
+		response := httptest.NewRecorder()
+		Convey("When the request is made", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then the stream should be started from the offsets resolved from the time", func() {
+				So(consumerManager.AssertCalled(t, "OffsetsAt", since), ShouldBeTrue)
+				So(consumerManager.AssertCalled(t, "StartConsumer", model.Cursor{0: 7, 1: 12}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestResumeFromLastEventIDInPreferenceToTime(t *testing.T) {
+	Convey("Given a reconnecting EventSource client originally requested the messages produced since a time", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(&mockController{}, errors.New("something went wrong"))
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint?since=2020-01-02T03:04:05Z", nil)
+		request.Header.Add("Last-Event-ID", "0:8,1:12")
+		response := httptest.NewRecorder()
+		Convey("When the request is made", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then the stream should be resumed from the last event ID", func() {
+				So(consumerManager.AssertNotCalled(t, "OffsetsAt", mock.Anything), ShouldBeTrue)
+				So(consumerManager.AssertCalled(t, "StartConsumer", model.Cursor{0: 8, 1: 12}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestHandlerReturnsBadRequestIfStartTimeInvalid(t *testing.T) {
+	Convey("Given a request handler instance", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		malformed := httptest.NewRequest("GET", "/endpoint?since=yesterday", nil)
+		malformedResponse := httptest.NewRecorder()
+		conflicting := httptest.NewRequest("GET", "/endpoint?since=2020-01-02T03:04:05Z&offset=3", nil)
+		conflictingResponse := httptest.NewRecorder()
+		Convey("When a malformed time or both a time and an offset are requested", func() {
+			requestHandler.HandleRequest(malformedResponse, malformed)
+			requestHandler.HandleRequest(conflictingResponse, conflicting)
+			Convey("Then a bad request response should be returned", func() {
+				So(malformedResponse.Code, ShouldEqual, http.StatusBadRequest)
+				So(conflictingResponse.Code, ShouldEqual, http.StatusBadRequest)
+				So(logger.AssertCalled(t, "ErrorR", conflicting, errors.New("offset and since cannot both be specified"), []log.Data(nil)), ShouldBeTrue)
+				So(consumerManager.AssertNotCalled(t, "OffsetsAt", mock.Anything), ShouldBeTrue)
+				So(consumerManager.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestHandlerReturnsGoneIfStartTimePredatesRetention(t *testing.T) {
+	Convey("Given the messages produced since the time requested by a user have expired from the topic", t, func() {
+		since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		expectedError := &runner.ExpiredTimestampError{Partition: 1, Since: since, Earliest: 5}
+		consumerManager := &mockConsumerRunner{}
+		consumerManager.On("OffsetsAt", mock.Anything).Return(model.Cursor(nil), expectedError)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint?since=2020-01-02T03:04:05Z", nil)
+		response := httptest.NewRecorder()
+		Convey("When the request is made", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then the response should be HTTP 410 Gone with a body giving the earliest offset held", func() {
+				So(response.Code, ShouldEqual, http.StatusGone)
+				So(response.Body.String(), ShouldEqual, `{"error":"`+expectedError.Error()+`",`+
+					`"partition":1,"since":"2020-01-02T03:04:05Z","earliest_offset":5}`)
+				So(consumerManager.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestEndStreamWhenLimitReached(t *testing.T) {
+	Convey("Given a user has requested a single message from offset 3", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		mockController.On("Stop", mock.Anything).Return()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint?offset=3&limit=1", nil)
+		response := httptest.NewRecorder()
+		connections := testutil.ToFloat64(metrics.Connections.WithLabelValues("topic"))
+		published := testutil.ToFloat64(metrics.MessagesPublished.WithLabelValues("topic"))
+		finished := make(chan struct{})
+		go func() {
+			requestHandler.HandleRequest(response, request)
+			close(finished)
+		}()
+		Convey("When a message is published", func() {
+			waitGroup.Add(1)
+			subscription <- &model.StreamEvent{Data: "Hello world\n", Offset: 3}
+			waitGroup.Wait()
+			<-finished
+			Convey("Then the message and a terminating marker should be written and the consumer stopped", func() {
+				So(response.Code, ShouldEqual, 200)
+				So(response.Body.String(), ShouldEqual, "Hello world\n"+`{"end_of_stream":{"reason":"limit","resume_from":"0:4"}}`+"\n")
+				So(mockController.AssertCalled(t, "Stop", "stream ended"), ShouldBeTrue)
+				So(logger.AssertCalled(t, "InfoR", request, "stream ended", []log.Data{{"reason": "limit"}}), ShouldBeTrue)
+				So(consumerManager.AssertNumberOfCalls(t, "HighWaterMarks", 1), ShouldBeTrue)
+				So(testutil.ToFloat64(metrics.Connections.WithLabelValues("topic")), ShouldEqual, connections)
+				So(testutil.ToFloat64(metrics.MessagesPublished.WithLabelValues("topic")), ShouldEqual, published+1)
+			})
+		})
+	})
+}
+
+func TestCompressStreamIfEncodingAccepted(t *testing.T) {
+	Convey("Given a user accepting gzip has requested a single message from offset 3", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		mockController.On("Stop", mock.Anything).Return()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint?offset=3&limit=1", nil)
+		request.Header.Add("Accept-Encoding", "gzip, deflate")
+		response := httptest.NewRecorder()
+		uncompressed := testutil.ToFloat64(metrics.UncompressedBytes.WithLabelValues("topic", "gzip"))
+		compressed := testutil.ToFloat64(metrics.CompressedBytes.WithLabelValues("topic", "gzip"))
+		finished := make(chan struct{})
+		go func() {
+			requestHandler.HandleRequest(response, request)
+			close(finished)
+		}()
+		Convey("When a message is published", func() {
+			waitGroup.Add(1)
+			subscription <- &model.StreamEvent{Data: "Hello world\n", Offset: 3}
+			waitGroup.Wait()
+			<-finished
+			Convey("Then the stream should be compressed and the bytes written before and after compression counted", func() {
+				expected := "Hello world\n" + `{"end_of_stream":{"reason":"limit","resume_from":"0:4"}}` + "\n"
+				So(response.Code, ShouldEqual, 200)
+				So(response.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+				So(response.Header().Get("Vary"), ShouldEqual, "Accept-Encoding")
+				reader, err := gzip.NewReader(response.Body)
+				So(err, ShouldBeNil)
+				actual, err := ioutil.ReadAll(reader)
+				So(err, ShouldBeNil)
+				So(string(actual), ShouldEqual, expected)
+				So(testutil.ToFloat64(metrics.UncompressedBytes.WithLabelValues("topic", "gzip")), ShouldEqual, uncompressed+float64(len(expected)))
+				So(testutil.ToFloat64(metrics.CompressedBytes.WithLabelValues("topic", "gzip")), ShouldBeGreaterThan, compressed)
+			})
+		})
+	})
+}
+
+func TestEndServerSentEventStreamWhenEndOffsetReached(t *testing.T) {
+	Convey("Given an EventSource client has requested offsets 3 to 4 of partition 0 of a two partition topic", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{0: 10, 1: 7}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		mockController.On("Stop", mock.Anything).Return()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		serialiser := &mockSerialiser{}
+		serialiser.On("Serialise", mock.Anything).Return("data: {}\n\n", nil)
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		requestHandler.eventStreamSerialiser = serialiser
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint?offset=0:3&until=0:4", nil)
+		request.Header.Add("Accept", "text/event-stream")
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		Convey("When messages are published on both partitions", func() {
+			waitGroup.Add(3)
+			subscription <- &model.StreamEvent{Offset: 7, Partition: 1}
+			subscription <- &model.StreamEvent{Offset: 3}
+			subscription <- &model.StreamEvent{Offset: 4}
+			waitGroup.Wait()
+			Convey("Then only the requested offsets should be written followed by a terminating event", func() {
+				So(response.Body.String(), ShouldEqual, "id: 0:4,1:7\ndata: {}\n\n"+
+					"id: 0:5,1:7\ndata: {}\n\n"+
+					"event: end\ndata: {\"reason\":\"until\",\"resume_from\":\"0:5,1:7\"}\n\n")
+				So(mockController.AssertCalled(t, "Stop", "stream ended"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestEndStreamImmediatelyIfEndTimeAlreadyPassed(t *testing.T) {
+	Convey("Given a user following the live head requests the messages produced before a time that has passed", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		mockController := &mockController{}
+		consumerManager.On("OffsetsBefore", mock.Anything).Return(model.Cursor{0: 8}, nil)
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{0: 10}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Stop", mock.Anything).Return()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint?until_time=2020-01-02T03:04:05Z", nil)
+		response := httptest.NewRecorder()
+		Convey("When the request is made", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then the stream should end straight away", func() {
+				So(consumerManager.AssertCalled(t, "OffsetsBefore", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)), ShouldBeTrue)
+				So(response.Body.String(), ShouldEqual, `{"end_of_stream":{"reason":"until","resume_from":"0:10"}}`+"\n")
+				So(mockController.AssertCalled(t, "Stop", "stream ended"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestCloseStreamWhenServerClosing(t *testing.T) {
+	Convey("Given an EventSource client has received a message from partition 1 but none from partition 0", t, func() {
+		closing := make(chan struct{})
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{0: 12, 1: 5}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		mockController.On("Stop", mock.Anything).Return()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		serialiser := &mockSerialiser{}
+		serialiser.On("Serialise", mock.Anything).Return("data: {}\n\n", nil)
+		requestHandler := NewRequestHandler(consumerManager, logger).WithShutdown(closing)
+		requestHandler.eventStreamSerialiser = serialiser
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint", nil)
+		request.Header.Add("Accept", "text/event-stream")
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		waitGroup.Add(1)
+		subscription <- &model.StreamEvent{Offset: 7, Partition: 1}
+		waitGroup.Wait()
+		Convey("When the server starts closing", func() {
+			waitGroup.Add(1)
+			close(closing)
+			waitGroup.Wait()
+			Convey("Then a closing event giving the cursor to resume every partition from should be written and the consumer stopped", func() {
+				So(response.Body.String(), ShouldEqual, "id: 0:12,1:8\ndata: {}\n\n"+
+					"event: closing\ndata: {\"reason\":\"server_closing\",\"resume_from\":\"0:12,1:8\"}\n\n")
+				So(mockController.AssertCalled(t, "Stop", "server closing"), ShouldBeTrue)
+				So(logger.AssertCalled(t, "InfoR", request, "server closing", []log.Data{{"reason": "server_closing"}}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestWriteGapsWhenMessagesDropped(t *testing.T) {
+	Convey("Given a user is connected to a stream", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		mockController := &mockController{gaps: make(chan []*runner.Gap)}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(make(chan *model.StreamEvent))
+		mockController.On("Stop", mock.Anything).Return()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+		request := httptest.NewRequest("GET", "/endpoint", nil).WithContext(ctx)
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		Convey("When messages are dropped because the user has fallen behind", func() {
+			waitGroup.Add(1)
+			mockController.gaps <- []*runner.Gap{
+				{Partition: 0, FirstOffset: 3, LastOffset: 4, Dropped: 2},
+				{Partition: 1, FirstOffset: 8, LastOffset: 8, Dropped: 1},
+			}
+			waitGroup.Wait()
+			waitGroup.Add(1)
+			cancel()
+			waitGroup.Wait()
+			Convey("Then the user should be told which messages were dropped", func() {
+				So(response.Body.String(), ShouldEqual,
+					`{"gap":{"partition":0,"first_offset":3,"last_offset":4,"dropped":2}}`+"\n"+
+						`{"gap":{"partition":1,"first_offset":8,"last_offset":8,"dropped":1}}`+"\n")
+				So(logger.AssertCalled(t, "InfoR", request, "messages dropped", []log.Data{{"partition": int32(0), "dropped": 2}}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestCloseStreamWhenUserTooFarBehind(t *testing.T) {
+	Convey("Given an EventSource client has received a message from partition 1", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		subscription := make(chan *model.StreamEvent)
+		mockController := &mockController{overflowed: make(chan struct{})}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		mockController.On("Data").Return(subscription)
+		mockController.On("Stop", mock.Anything).Return()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		serialiser := &mockSerialiser{}
+		serialiser.On("Serialise", mock.Anything).Return("data: {}\n\n", nil)
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		requestHandler.eventStreamSerialiser = serialiser
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint", nil)
+		request.Header.Add("Accept", "text/event-stream")
+		response := httptest.NewRecorder()
+		go requestHandler.HandleRequest(response, request)
+		waitGroup.Add(1)
+		subscription <- &model.StreamEvent{Offset: 7, Partition: 1}
+		waitGroup.Wait()
+		Convey("When the user's queue overflows", func() {
+			waitGroup.Add(1)
+			close(mockController.overflowed)
+			waitGroup.Wait()
+			Convey("Then a closing event giving the cursor to resume from should be written and the consumer stopped", func() {
+				So(response.Body.String(), ShouldEqual, "id: 1:8\ndata: {}\n\n"+
+					"event: closing\ndata: {\"reason\":\"slow_consumer\",\"resume_from\":\"1:8\"}\n\n")
+				So(mockController.AssertCalled(t, "Stop", "user too far behind stream"), ShouldBeTrue)
+				So(logger.AssertCalled(t, "InfoR", request, "user too far behind stream", []log.Data{{"reason": "slow_consumer"}}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestHandlerReturnsBadRequestIfStreamBoundInvalid(t *testing.T) {
+	Convey("Given a request handler instance", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		Convey("When invalid bounds are requested", func() {
+			codes := make([]int, 0)
+			for _, query := range []string{"limit=none", "until=x", "until_time=yesterday", "until_time=" + future, "until=3&until_time=2020-01-02T03:04:05Z"} {
+				response := httptest.NewRecorder()
+				requestHandler.HandleRequest(response, httptest.NewRequest("GET", "/endpoint?"+query, nil))
+				codes = append(codes, response.Code)
+			}
+			Convey("Then a bad request response should be returned without starting a consumer", func() {
+				So(codes, ShouldResemble, []int{400, 400, 400, 400, 400})
+				So(consumerManager.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestWriteHeartbeatOnIdleConnection(t *testing.T) {
+	Convey("Given a user is connected to a request handler with heartbeats enabled", t, func() {
+		ctx, disconnect := context.WithCancel(context.Background())
+		consumerManager := &mockConsumerRunner{}
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil).Once()
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{0: 12, 1: 34}, nil).Run(func(mock.Arguments) { disconnect() })
+		mockController.On("Data").Return(make(chan *model.StreamEvent))
+		mockController.On("Stop", msgUserDisconnected).Return()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger).WithHeartbeat(time.Millisecond)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint", nil).WithContext(ctx)
+		response := httptest.NewRecorder()
+		Convey("When the connection is idle for the heartbeat interval before the user disconnects", func() {
+			waitGroup.Add(1)
+			go requestHandler.HandleRequest(response, request)
+			waitGroup.Wait()
+			output, _ := response.Body.ReadString('\n')
+			Convey("Then a JSON heartbeat carrying the high-water marks should be written", func() {
+				So(response.Code, ShouldEqual, 200)
+				So(output, ShouldEqual, `{"heartbeat":{"high_water_marks":{"0":12,"1":34}}}`+"\n")
+			})
+		})
+	})
+}
+
+func TestWriteServerSentHeartbeatOnIdleConnection(t *testing.T) {
+	Convey("Given an EventSource client is connected to a request handler with heartbeats enabled", t, func() {
+		ctx, disconnect := context.WithCancel(context.Background())
+		consumerManager := &mockConsumerRunner{}
+		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil).Once()
+		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
+		consumerManager.On("HighWaterMarks").Return(model.Cursor(nil), errors.New("something went wrong")).Run(func(mock.Arguments) { disconnect() })
+		mockController.On("Data").Return(make(chan *model.StreamEvent))
+		mockController.On("Stop", msgUserDisconnected).Return()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger).WithHeartbeat(time.Millisecond)
+		waitGroup := new(sync.WaitGroup)
+		requestHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/endpoint", nil).WithContext(ctx)
+		request.Header.Add("Accept", "text/event-stream")
+		response := httptest.NewRecorder()
+		Convey("When the connection is idle and the high-water marks cannot be retrieved", func() {
+			waitGroup.Add(1)
+			go requestHandler.HandleRequest(response, request)
+			waitGroup.Wait()
+			output := response.Body.String()
+			Convey("Then a heartbeat event should still be written and the error logged", func() {
+				So(output, ShouldStartWith, "event: heartbeat\ndata: {\"high_water_marks\":null}\n\n")
+				So(logger.AssertCalled(t, "ErrorR", request, mock.Anything, []log.Data(nil)), ShouldBeTrue)
+			})
+		})
+	})
+}
+
 func TestHandlerUnsubscribesIfUserDisconnects(t *testing.T) {
 	Convey("Given a user is connected to the request handler", t, func() {
 		requestComplete := make(chan struct{})
-		subscription := make(chan string)
+		subscription := make(chan *model.StreamEvent)
 		mockController := &mockController{}
 		mockController.On("Data").Return(subscription)
 		mockController.On("Stop", mock.Anything).Return()
 		consumerManager := &mockConsumerRunner{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
 		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, nil)
 		logger := &mockLogger{}
 		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
@@ -105,7 +772,7 @@ func TestHandlerUnsubscribesIfUserDisconnects(t *testing.T) {
 				So(response.Code, ShouldEqual, 200)
 				So(mockController.AssertCalled(t, "Stop", "user disconnected"), ShouldBeTrue)
 				So(logger.AssertCalled(t, "InfoR", request, "user connected", []log.Data(nil)), ShouldBeTrue)
-				So(consumerManager.AssertCalled(t, "StartConsumer", int64(-1)), ShouldBeTrue)
+				So(consumerManager.AssertCalled(t, "StartConsumer", model.Cursor(nil)), ShouldBeTrue)
 				So(logger.AssertCalled(t, "InfoR", request, "user disconnected", []log.Data(nil)), ShouldBeTrue)
 			})
 		})
@@ -136,11 +803,34 @@ func TestHandlerReturnsBadRequestIfInvalidOffsetFormatSpecified(t *testing.T) {
 	})
 }
 
+func TestHandlerReturnsInternalServerErrorIfHighWaterMarksCannotBeRetrieved(t *testing.T) {
+	Convey("Given the high-water marks of the topic cannot be retrieved", t, func() {
+		expectedError := errors.New("something went wrong")
+		consumerManager := &mockConsumerRunner{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor(nil), expectedError)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint", nil)
+		response := httptest.NewRecorder()
+		Convey("When a request is made", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then the response should be HTTP 500 Internal Server Error and no consumer started", func() {
+				So(logger.AssertCalled(t, "ErrorR", request, expectedError, []log.Data(nil)), ShouldBeTrue)
+				So(consumerManager.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+				So(response.Code, ShouldEqual, http.StatusInternalServerError)
+			})
+		})
+	})
+}
+
 func TestHandlerReturnsInternalServerErrorIfConsumerReturnsError(t *testing.T) {
 	Convey("Given an error will be raised when the consumer is launched by the request handler", t, func() {
 		expectedError := errors.New("something went wrong")
 		consumerManager := &mockConsumerRunner{}
 		mockController := &mockController{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
 		consumerManager.On("StartConsumer", mock.Anything).Return(mockController, expectedError)
 		logger := &mockLogger{}
 		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
@@ -155,7 +845,7 @@ func TestHandlerReturnsInternalServerErrorIfConsumerReturnsError(t *testing.T) {
 			requestHandler.HandleRequest(response, request)
 			Convey("Then the response should be HTTP 500 Internal Server Error", func() {
 				So(logger.AssertCalled(t, "InfoR", request, "user connected", []log.Data(nil)), ShouldBeTrue)
-				So(consumerManager.AssertCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+				So(consumerManager.AssertCalled(t, "StartConsumer", model.Cursor{0: 3}), ShouldBeTrue)
 				So(logger.AssertCalled(t, "ErrorR", request, expectedError, []log.Data(nil)), ShouldBeTrue)
 				So(response.Code, ShouldEqual, http.StatusInternalServerError)
 			})
@@ -163,17 +853,90 @@ func TestHandlerReturnsInternalServerErrorIfConsumerReturnsError(t *testing.T) {
 	})
 }
 
-func (s *mockConsumerRunner) StartConsumer(offset int64) (runner.Controllable, error) {
-	args := s.Called(offset)
+func TestHandlerReturnsGoneIfOffsetExpired(t *testing.T) {
+	Convey("Given the offset requested by a user has expired from the topic", t, func() {
+		expectedError := &runner.OffsetOutOfRangeError{Partition: 1, Offset: 3, Earliest: 5, Latest: 10}
+		consumerManager := &mockConsumerRunner{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(&mockController{}, expectedError)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint?offset=1:3", nil)
+		response := httptest.NewRecorder()
+		Convey("When a request is made", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then the response should be HTTP 410 Gone with a body giving the valid range", func() {
+				So(response.Code, ShouldEqual, http.StatusGone)
+				So(response.Header().Get("Content-Type"), ShouldEqual, "application/json")
+				So(response.Body.String(), ShouldEqual, `{"error":"offset 3 is outside the range 5 to 10 held on partition 1",`+
+					`"partition":1,"offset":3,"earliest_offset":5,"latest_offset":10}`)
+				So(logger.AssertCalled(t, "ErrorR", request, expectedError, []log.Data(nil)), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestHandlerReturnsRangeNotSatisfiableIfOffsetNotYetProduced(t *testing.T) {
+	Convey("Given the offset requested by a user is beyond the high-water mark of the topic", t, func() {
+		consumerManager := &mockConsumerRunner{}
+		consumerManager.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		consumerManager.On("StartConsumer", mock.Anything).Return(&mockController{}, &runner.OffsetOutOfRangeError{Offset: 11, Earliest: 5, Latest: 10})
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		requestHandler := NewRequestHandler(consumerManager, logger)
+		request := httptest.NewRequest("GET", "/endpoint?offset=11", nil)
+		response := httptest.NewRecorder()
+		Convey("When a request is made", func() {
+			requestHandler.HandleRequest(response, request)
+			Convey("Then the response should be HTTP 416 Requested Range Not Satisfiable", func() {
+				So(response.Code, ShouldEqual, http.StatusRequestedRangeNotSatisfiable)
+				So(response.Body.String(), ShouldContainSubstring, `"earliest_offset":5,"latest_offset":10`)
+			})
+		})
+	})
+}
+
+func (s *mockConsumerRunner) Topic() string {
+	return "topic"
+}
+
+func (s *mockConsumerRunner) StartConsumer(cursor model.Cursor) (runner.Controllable, error) {
+	args := s.Called(cursor)
 	return args.Get(0).(runner.Controllable), args.Error(1)
 }
 
+func (s *mockConsumerRunner) HighWaterMarks() (model.Cursor, error) {
+	args := s.Called()
+	return args.Get(0).(model.Cursor), args.Error(1)
+}
+
+func (s *mockConsumerRunner) OffsetsBefore(until time.Time) (model.Cursor, error) {
+	args := s.Called(until)
+	return args.Get(0).(model.Cursor), args.Error(1)
+}
+
+func (s *mockConsumerRunner) OffsetsAt(since time.Time) (model.Cursor, error) {
+	args := s.Called(since)
+	return args.Get(0).(model.Cursor), args.Error(1)
+}
+
 func (c *mockController) Stop(msg string) {
 	c.Called(msg)
 }
 
-func (c *mockController) Data() <-chan string {
-	return c.Called().Get(0).(chan string)
+func (c *mockController) Data() <-chan *model.StreamEvent {
+	return c.Called().Get(0).(chan *model.StreamEvent)
+}
+
+func (c *mockController) Gaps() <-chan []*runner.Gap {
+	return c.gaps
+}
+
+func (c *mockController) Overflowed() <-chan struct{} {
+	return c.overflowed
 }
 
 func (c *mockContext) Deadline() (deadline time.Time, ok bool) {
@@ -211,3 +974,8 @@ func (l *mockLogger) Error(err error, data ...log.Data) {
 func (l *mockLogger) ErrorR(req *http.Request, err error, data ...log.Data) {
 	l.Called(req, err, data)
 }
+
+func (s *mockSerialiser) Serialise(jsonData *rcd.ResourceChangedData) (string, error) {
+	args := s.Called(jsonData)
+	return args.String(0), args.Error(1)
+}
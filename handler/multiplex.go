@@ -0,0 +1,591 @@
+package handler
+
+import (
+	encoding "encoding/json"
+	"errors"
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/auth"
+	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"github.com/companieshouse/chs.go/log"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	namesRequestParam  = "names"
+	namesSeparator     = ","
+	multiplexedLabel   = "multiplexed"
+	msgNoStreams       = "names must specify at least one stream"
+	msgNotEntitled     = "API key not entitled to stream"
+	msgNoCompanyNumber = "company number must be given"
+
+	companyNumberPathVariable = "company_number"
+)
+
+// Serves several streams merged into a single response, in the order their messages are consumed, tagging each event
+// with the name of the stream it belongs to. Users resume the response from a composite cursor holding their position
+// within every partition of every stream.
+type MultiplexHandler struct {
+	streams           map[string]Controllable
+	names             []string
+	jsonSerialiser    transformer.Marshallable
+	heartbeatInterval time.Duration
+	closing           <-chan struct{}
+	logger            logger.Logger
+	wg                *sync.WaitGroup
+}
+
+// A stream a user is consuming as part of a multiplexed response.
+type multiplexedStream struct {
+	name       string
+	runner     Controllable
+	controller runner.Controllable
+}
+
+// A message consumed from one of the streams of a multiplexed response.
+type multiplexedEvent struct {
+	stream string
+	event  *model.StreamEvent
+}
+
+// Messages dropped from one of the streams of a multiplexed response.
+type multiplexedGaps struct {
+	stream string
+	gaps   []*runner.Gap
+}
+
+// Record written to multiplexed streams for each event and notice belonging to a single stream. Events carry the
+// message as it is written to the stream on its own.
+type streamRecord struct {
+	Stream     string              `json:"stream"`
+	ResumeFrom string              `json:"resume_from,omitempty"`
+	Event      encoding.RawMessage `json:"event,omitempty"`
+	Skipped    *json.Skipped       `json:"skipped,omitempty"`
+	Gap        *json.Gap           `json:"gap,omitempty"`
+}
+
+// Record written to multiplexed streams for heartbeats and end of stream markers, which concern every stream.
+type multiplexedNotice struct {
+	Heartbeat   *json.StreamsHeartbeat `json:"heartbeat,omitempty"`
+	EndOfStream *json.EndOfStream      `json:"end_of_stream,omitempty"`
+}
+
+// Construct a new MultiplexHandler instance.
+func NewMultiplexHandler(logger logger.Logger) *MultiplexHandler {
+	return &MultiplexHandler{
+		streams:        make(map[string]Controllable),
+		jsonSerialiser: jsonproducer.Instance(),
+		logger:         logger,
+	}
+}
+
+// Allow users to include the given stream by name in their responses.
+func (h *MultiplexHandler) WithStream(name string, stream Controllable) *MultiplexHandler {
+	if _, ok := h.streams[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.streams[name] = stream
+	return h
+}
+
+// Write a heartbeat carrying the high-water marks of every stream to connections that have been idle for the given
+// interval. Heartbeats are disabled if the interval is not positive.
+func (h *MultiplexHandler) WithHeartbeat(interval time.Duration) *MultiplexHandler {
+	h.heartbeatInterval = interval
+	return h
+}
+
+// Close every connection, telling users where to resume from, once the given channel is closed.
+func (h *MultiplexHandler) WithShutdown(closing <-chan struct{}) *MultiplexHandler {
+	h.closing = closing
+	return h
+}
+
+// Serve the streams named by the names parameter merged into a single response.
+func (h *MultiplexHandler) HandleRequest(writer http.ResponseWriter, request *http.Request) {
+	h.logger.InfoR(request, msgUserConnected)
+	names, err := h.streamNames(request.URL.Query().Get(namesRequestParam))
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	filter, err := model.ParseFilter(request.URL.Query())
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.serve(writer, request, names, filter)
+}
+
+// Serve the events of every stream the user is entitled to that belong to the company whose number is given in the
+// path, in the order they are consumed. Other filter parameters may narrow the events further, but the company_number
+// parameter is replaced by the company given in the path.
+func (h *MultiplexHandler) HandleCompanyRequest(writer http.ResponseWriter, request *http.Request) {
+	h.logger.InfoR(request, msgUserConnected)
+	companyNumber := strings.ToUpper(strings.TrimSpace(mux.Vars(request)[companyNumberPathVariable]))
+	if companyNumber == "" {
+		h.logger.ErrorR(request, errors.New(msgNoCompanyNumber))
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	filter, err := model.ParseFilter(request.URL.Query())
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	filter.CompanyNumbers = map[string]bool{companyNumber: true}
+	names := h.entitledNames(request)
+	if len(names) == 0 {
+		key := auth.KeyFromContext(request.Context())
+		h.logger.InfoR(request, msgNotEntitled, log.Data{"key_name": key.Name})
+		h.writeError(writer, request, http.StatusForbidden, &json.AuthError{Error: msgNotEntitled})
+		return
+	}
+	h.serve(writer, request, names, filter)
+}
+
+// Stream the named streams to the user, writing the messages matching the filter, until the user disconnects, the
+// server closes or the user falls too far behind one of the streams.
+func (h *MultiplexHandler) serve(writer http.ResponseWriter, request *http.Request, names []string, filter *model.Filter) {
+	if !h.entitled(writer, request, names) {
+		return
+	}
+	eventStream, err := multiplexedEventStream(request)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	cursor, ok := h.startCursor(writer, request, names)
+	if !ok {
+		return
+	}
+	resumeCursor, ok := h.resumeCursor(writer, request, names, cursor)
+	if !ok {
+		return
+	}
+	streams, ok := h.startConsumers(writer, request, names, cursor)
+	if !ok {
+		return
+	}
+	for _, stream := range streams {
+		connections := metrics.Connections.WithLabelValues(stream.runner.Topic())
+		connections.Inc()
+		defer connections.Dec()
+	}
+	events := make(chan *multiplexedEvent)
+	gaps := make(chan *multiplexedGaps)
+	overflowed := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	for _, stream := range streams {
+		go stream.forward(events, gaps, overflowed, done)
+	}
+	encoded := newEncodedWriter(writer, request, multiplexedLabel)
+	defer func() {
+		_ = encoded.Close()
+	}()
+	writer = encoded
+	if eventStream {
+		writer.Header().Set("Content-Type", eventStreamMimeType)
+		writer.Header().Set("Cache-Control", "no-cache")
+	}
+	writer.WriteHeader(http.StatusOK)
+	heartbeat := newIdleTimer(h.heartbeatInterval)
+	defer heartbeat.stop()
+	for {
+		select {
+		case consumed := <-events:
+			event := consumed.event
+			resumeCursor[consumed.stream][event.Partition] = event.Offset + 1
+			if event.Skipped {
+				if filter.IncludeSkipped {
+					h.writeRecord(writer, request, "skipped", resumeCursor, &streamRecord{
+						Stream:  consumed.stream,
+						Skipped: &json.Skipped{Partition: event.Partition, Offset: event.Offset},
+					}, eventStream)
+					writer.(http.Flusher).Flush()
+					heartbeat.reset()
+				}
+			} else if filter.Matches(event.Resource) {
+				h.writeRecord(writer, request, consumed.stream, resumeCursor, &streamRecord{
+					Stream: consumed.stream,
+					Event:  encoding.RawMessage(strings.TrimSpace(event.Data)),
+				}, eventStream)
+				writer.(http.Flusher).Flush()
+				metrics.MessagesPublished.WithLabelValues(h.streams[consumed.stream].Topic()).Inc()
+				heartbeat.reset()
+			}
+			if h.wg != nil {
+				h.wg.Done()
+			}
+		case dropped := <-gaps:
+			for _, gap := range dropped.gaps {
+				h.logger.InfoR(request, msgMessagesDropped, log.Data{"stream": dropped.stream, "partition": gap.Partition, "dropped": gap.Dropped})
+				h.writeRecord(writer, request, "gap", nil, &streamRecord{
+					Stream: dropped.stream,
+					Gap: &json.Gap{
+						Partition:   gap.Partition,
+						FirstOffset: gap.FirstOffset,
+						LastOffset:  gap.LastOffset,
+						Dropped:     gap.Dropped,
+					},
+				}, eventStream)
+			}
+			writer.(http.Flusher).Flush()
+			heartbeat.reset()
+			if h.wg != nil {
+				h.wg.Done()
+			}
+		case name := <-overflowed:
+			h.endStream(writer, request, streams, endReasonSlowConsumer, resumeCursor, eventStream, log.Data{"stream": name})
+			if h.wg != nil {
+				h.wg.Done()
+			}
+			return
+		case <-heartbeat.expired():
+			h.writeHeartbeat(writer, request, streams, eventStream)
+			writer.(http.Flusher).Flush()
+			heartbeat.reset()
+		case <-h.closing:
+			h.endStream(writer, request, streams, endReasonServerClosing, resumeCursor, eventStream, nil)
+			if h.wg != nil {
+				h.wg.Done()
+			}
+			return
+		case <-request.Context().Done():
+			for _, stream := range streams {
+				stream.controller.Stop(msgUserDisconnected)
+			}
+			h.logger.InfoR(request, msgUserDisconnected)
+			if h.wg != nil {
+				h.wg.Done()
+			}
+			return
+		}
+	}
+}
+
+// Return the distinct stream names listed in the names parameter, in the order given. An error is returned if no
+// names are given or a name is not that of a registered stream.
+func (h *MultiplexHandler) streamNames(input string) ([]string, error) {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(input, namesSeparator) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := h.streams[name]; !ok {
+			return nil, fmt.Errorf("unknown stream: %s", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New(msgNoStreams)
+	}
+	return names, nil
+}
+
+// Return the names of the streams the key the request was authenticated with is entitled to, which is every stream if
+// the request has not been authenticated.
+func (h *MultiplexHandler) entitledNames(request *http.Request) []string {
+	key := auth.KeyFromContext(request.Context())
+	if key == nil {
+		return h.names
+	}
+	var names []string
+	for _, name := range h.names {
+		if key.Entitled(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Return false, having rejected the request, if the request was authenticated with an API key that is not entitled to
+// every one of the named streams.
+func (h *MultiplexHandler) entitled(writer http.ResponseWriter, request *http.Request, names []string) bool {
+	key := auth.KeyFromContext(request.Context())
+	if key == nil {
+		return true
+	}
+	for _, name := range names {
+		if !key.Entitled(name) {
+			h.logger.InfoR(request, msgNotEntitled, log.Data{"stream": name, "key_name": key.Name})
+			h.writeError(writer, request, http.StatusForbidden, &json.AuthError{Error: msgNotEntitled, Stream: name})
+			return false
+		}
+	}
+	return true
+}
+
+// Return the position the user has requested to start each stream from. Positions are either given by a composite
+// cursor, which reconnecting EventSource clients give with the Last-Event-ID header, or resolved from the time given
+// by the since parameter. Streams without a position are streamed from their live head. An error response is written
+// and false returned if the positions cannot be determined.
+func (h *MultiplexHandler) startCursor(writer http.ResponseWriter, request *http.Request, names []string) (model.StreamCursor, bool) {
+	query := request.URL.Query()
+	since := query.Get(sinceRequestParam)
+	if since == "" || request.Header.Get(lastEventIDHeader) != "" {
+		cursor, err := model.ParseStreamCursor(startPosition(request))
+		if err != nil {
+			h.logger.ErrorR(request, err)
+			writer.WriteHeader(http.StatusBadRequest)
+			return nil, false
+		}
+		return cursor, true
+	}
+	if query.Get(offsetRequestParam) != "" {
+		h.logger.ErrorR(request, errors.New(msgConflictingStart))
+		writer.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	sinceTime, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	cursor := make(model.StreamCursor)
+	for _, name := range names {
+		offsets, err := h.streams[name].OffsetsAt(sinceTime)
+		var expired *runner.ExpiredTimestampError
+		if errors.As(err, &expired) {
+			h.logger.ErrorR(request, err, log.Data{"stream": name})
+			h.writeError(writer, request, http.StatusGone, &json.ExpiredTimestamp{
+				Error:          expired.Error(),
+				Stream:         name,
+				Partition:      expired.Partition,
+				Since:          expired.Since.Format(time.RFC3339),
+				EarliestOffset: expired.Earliest,
+			})
+			return nil, false
+		}
+		if err != nil {
+			h.logger.ErrorR(request, err, log.Data{"stream": name})
+			writer.WriteHeader(http.StatusInternalServerError)
+			return nil, false
+		}
+		cursor[name] = offsets
+	}
+	return cursor, true
+}
+
+// Return the cursor to resume each of the named streams from before any message has been delivered. Partitions
+// followed from the live head start from their high-water mark, which is read before subscribing so that users
+// resuming before any message has been delivered on a partition miss nothing produced meanwhile. An error response is
+// written and false returned if the high-water marks cannot be retrieved.
+func (h *MultiplexHandler) resumeCursor(writer http.ResponseWriter, request *http.Request, names []string, cursor model.StreamCursor) (model.StreamCursor, bool) {
+	resumeCursor := make(model.StreamCursor)
+	for _, name := range names {
+		highWaterMarks, err := h.streams[name].HighWaterMarks()
+		if err != nil {
+			h.logger.ErrorR(request, err, log.Data{"stream": name})
+			writer.WriteHeader(http.StatusInternalServerError)
+			return nil, false
+		}
+		resumeCursor[name] = make(model.Cursor)
+		for partition, offset := range cursor[name] {
+			resumeCursor[name][partition] = offset
+		}
+		for partition, offset := range highWaterMarks {
+			if start, ok := resumeCursor[name][partition]; !ok || start < 0 {
+				resumeCursor[name][partition] = offset
+			}
+		}
+	}
+	return resumeCursor, true
+}
+
+// Start a consumer for each of the named streams from the position given by the cursor. If a consumer cannot be
+// started those already started are stopped, an error response is written and false returned.
+func (h *MultiplexHandler) startConsumers(writer http.ResponseWriter, request *http.Request, names []string, cursor model.StreamCursor) ([]*multiplexedStream, bool) {
+	streams := make([]*multiplexedStream, 0, len(names))
+	for _, name := range names {
+		controller, err := h.streams[name].StartConsumer(cursor[name])
+		if err == nil {
+			streams = append(streams, &multiplexedStream{name: name, runner: h.streams[name], controller: controller})
+			continue
+		}
+		for _, stream := range streams {
+			stream.controller.Stop(msgUserDisconnected)
+		}
+		h.logger.ErrorR(request, err, log.Data{"stream": name})
+		var outOfRange *runner.OffsetOutOfRangeError
+		if errors.As(err, &outOfRange) {
+			status := http.StatusRequestedRangeNotSatisfiable
+			if outOfRange.Expired() {
+				status = http.StatusGone
+			}
+			h.writeError(writer, request, status, &json.OffsetOutOfRange{
+				Error:          outOfRange.Error(),
+				Stream:         name,
+				Partition:      outOfRange.Partition,
+				Offset:         outOfRange.Offset,
+				EarliestOffset: outOfRange.Earliest,
+				LatestOffset:   outOfRange.Latest,
+			})
+			return nil, false
+		}
+		writer.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	return streams, true
+}
+
+// Write a record belonging to a single stream, either as a server-sent event of the given type identified by the
+// cursor to resume from, if any, or as a JSON record. Server-sent events carry events as they are written to the
+// stream on its own and notices as records naming their stream.
+func (h *MultiplexHandler) writeRecord(writer http.ResponseWriter, request *http.Request, eventType string, resumeCursor model.StreamCursor, record *streamRecord, eventStream bool) {
+	if eventStream {
+		data := []byte(record.Event)
+		if record.Event == nil {
+			var err error
+			if data, err = h.jsonSerialiser.Marshal(record); err != nil {
+				h.logger.ErrorR(request, err)
+				return
+			}
+		}
+		var event strings.Builder
+		if resumeCursor != nil {
+			event.WriteString("id: " + resumeCursor.String() + "\n")
+		}
+		event.WriteString("event: " + eventType + "\ndata: " + string(data) + "\n\n")
+		_, _ = writer.Write([]byte(event.String()))
+		return
+	}
+	if resumeCursor != nil {
+		record.ResumeFrom = resumeCursor.String()
+	}
+	data, err := h.jsonSerialiser.Marshal(record)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		return
+	}
+	_, _ = writer.Write(append(data, '\n'))
+}
+
+// Write a keepalive carrying the high-water marks of every stream, either as a server-sent event or as a JSON record.
+// Streams whose high-water marks cannot be retrieved are left out so that the connection is still kept alive.
+func (h *MultiplexHandler) writeHeartbeat(writer http.ResponseWriter, request *http.Request, streams []*multiplexedStream, eventStream bool) {
+	heartbeat := &json.StreamsHeartbeat{HighWaterMarks: make(map[string]map[int32]int64)}
+	for _, stream := range streams {
+		highWaterMarks, err := stream.runner.HighWaterMarks()
+		if err != nil {
+			h.logger.ErrorR(request, err, log.Data{"stream": stream.name})
+			continue
+		}
+		heartbeat.HighWaterMarks[stream.name] = highWaterMarks
+	}
+	h.writeNotice(writer, request, "heartbeat", &multiplexedNotice{Heartbeat: heartbeat}, heartbeat, eventStream)
+}
+
+// Stop the consumer of every stream once the server is closing or the user has fallen too far behind one of the
+// streams and write a terminating marker telling the user why the response ended and where to resume from.
+func (h *MultiplexHandler) endStream(writer http.ResponseWriter, request *http.Request, streams []*multiplexedStream, reason string, resumeCursor model.StreamCursor, eventStream bool, data log.Data) {
+	msg := msgServerClosing
+	if reason == endReasonSlowConsumer {
+		msg = msgSlowConsumer
+	}
+	for _, stream := range streams {
+		stream.controller.Stop(msg)
+	}
+	if data == nil {
+		data = log.Data{}
+	}
+	data["reason"] = reason
+	h.logger.InfoR(request, msg, data)
+	end := &json.EndOfStream{Reason: reason, ResumeFrom: resumeCursor.String()}
+	h.writeNotice(writer, request, "closing", &multiplexedNotice{EndOfStream: end}, end, eventStream)
+	writer.(http.Flusher).Flush()
+}
+
+// Write a notice concerning every stream, either as a server-sent event of the given type carrying the notice or as
+// the given JSON record.
+func (h *MultiplexHandler) writeNotice(writer http.ResponseWriter, request *http.Request, eventType string, record *multiplexedNotice, notice interface{}, eventStream bool) {
+	if eventStream {
+		data, err := h.jsonSerialiser.Marshal(notice)
+		if err != nil {
+			h.logger.ErrorR(request, err)
+			return
+		}
+		_, _ = writer.Write([]byte("event: " + eventType + "\ndata: " + string(data) + "\n\n"))
+		return
+	}
+	data, err := h.jsonSerialiser.Marshal(record)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		return
+	}
+	_, _ = writer.Write(append(data, '\n'))
+}
+
+// Reject a request with a JSON body explaining how the user can recover.
+func (h *MultiplexHandler) writeError(writer http.ResponseWriter, request *http.Request, status int, body interface{}) {
+	data, err := h.jsonSerialiser.Marshal(body)
+	if err != nil {
+		h.logger.ErrorR(request, err)
+		writer.WriteHeader(status)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_, _ = writer.Write(data)
+}
+
+// Pass the messages, gaps and overflow of the stream on to the multiplexed response until it ends.
+func (s *multiplexedStream) forward(events chan<- *multiplexedEvent, gaps chan<- *multiplexedGaps, overflowed chan<- string, done <-chan struct{}) {
+	for {
+		select {
+		case event := <-s.controller.Data():
+			select {
+			case events <- &multiplexedEvent{stream: s.name, event: event}:
+			case <-done:
+				return
+			}
+		case dropped := <-s.controller.Gaps():
+			select {
+			case gaps <- &multiplexedGaps{stream: s.name, gaps: dropped}:
+			case <-done:
+				return
+			}
+		case <-s.controller.Overflowed():
+			select {
+			case overflowed <- s.name:
+			case <-done:
+			}
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// Return true if the user has requested the response as server-sent events, with the format parameter or the Accept
+// header. Multiplexed responses are written either as server-sent events or as JSON records.
+func multiplexedEventStream(request *http.Request) (bool, error) {
+	switch format := request.URL.Query().Get(formatRequestParam); format {
+	case "":
+		return qualities(request.Header.Get(acceptHeader))[eventStreamMimeType] > 0, nil
+	case formatEventStream:
+		return true, nil
+	case formatJSON:
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid format: %s", format)
+	}
+}
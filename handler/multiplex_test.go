@@ -0,0 +1,460 @@
+package handler
+
+import (
+	"context"
+	"github.com/companieshouse/chs-streaming-api-backend/auth"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	"github.com/companieshouse/chs.go/log"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockKeys struct {
+	key *auth.Key
+}
+
+func TestCreateNewMultiplexHandler(t *testing.T) {
+	Convey("Given a logger", t, func() {
+		logger := &mockLogger{}
+		Convey("When a new multiplex handler instance is created", func() {
+			actual := NewMultiplexHandler(logger)
+			Convey("Then a new multiplex handler instance should be returned", func() {
+				So(actual, ShouldNotBeNil)
+				So(actual.streams, ShouldBeEmpty)
+				So(actual.jsonSerialiser, ShouldNotBeNil)
+				So(actual.heartbeatInterval, ShouldEqual, 0)
+				So(actual.logger, ShouldEqual, logger)
+				So(actual.wg, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestConfigureMultiplexHandler(t *testing.T) {
+	Convey("Given a new multiplex handler instance", t, func() {
+		multiplexHandler := NewMultiplexHandler(&mockLogger{})
+		Convey("When a stream is configured", func() {
+			filings := &mockConsumerRunner{}
+			actual := multiplexHandler.WithStream("filings", filings)
+			Convey("Then the stream should be served by name", func() {
+				So(actual, ShouldEqual, multiplexHandler)
+				So(actual.streams["filings"], ShouldEqual, filings)
+				So(actual.names, ShouldResemble, []string{"filings"})
+			})
+		})
+		Convey("When a heartbeat interval and shutdown signal are configured", func() {
+			closing := make(chan struct{})
+			actual := multiplexHandler.WithHeartbeat(30 * time.Second).WithShutdown(closing)
+			Convey("Then they should be applied to the multiplex handler", func() {
+				So(actual, ShouldEqual, multiplexHandler)
+				So(actual.heartbeatInterval, ShouldEqual, 30*time.Second)
+				So(actual.closing, ShouldEqual, (<-chan struct{})(closing))
+			})
+		})
+	})
+}
+
+func TestWriteMessagesFromEveryStreamTaggedByStream(t *testing.T) {
+	Convey("Given a user resuming two streams is connected to the multiplex handler", t, func() {
+		filings, filingsController, filingsData := mockStream()
+		officers, officersController, officersData := mockStream()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithStream("officers", officers)
+		waitGroup := new(sync.WaitGroup)
+		multiplexHandler.wg = waitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+		request := httptest.NewRequest("GET", "/streams?names=filings,officers&offset=filings.0:3,officers.1:7", nil).WithContext(ctx)
+		response := httptest.NewRecorder()
+		go multiplexHandler.HandleRequest(response, request)
+		Convey("When messages are published on each stream", func() {
+			waitGroup.Add(1)
+			officersData <- &model.StreamEvent{Data: `{"resource_id":"a"}` + "\n", Resource: &rcd.ResourceChangedData{}, Offset: 7, Partition: 1}
+			waitGroup.Wait()
+			waitGroup.Add(1)
+			filingsData <- &model.StreamEvent{Data: `{"resource_id":"b"}` + "\n", Resource: &rcd.ResourceChangedData{}, Offset: 3}
+			waitGroup.Wait()
+			waitGroup.Add(1)
+			cancel()
+			waitGroup.Wait()
+			Convey("Then each should be written tagged with its stream and the composite cursor to resume from", func() {
+				So(response.Code, ShouldEqual, 200)
+				So(response.Body.String(), ShouldEqual,
+					`{"stream":"officers","resume_from":"filings.0:3,officers.1:8","event":{"resource_id":"a"}}`+"\n"+
+						`{"stream":"filings","resume_from":"filings.0:4,officers.1:8","event":{"resource_id":"b"}}`+"\n")
+				So(filings.AssertCalled(t, "StartConsumer", model.Cursor{0: 3}), ShouldBeTrue)
+				So(officers.AssertCalled(t, "StartConsumer", model.Cursor{1: 7}), ShouldBeTrue)
+				So(filingsController.AssertCalled(t, "Stop", "user disconnected"), ShouldBeTrue)
+				So(officersController.AssertCalled(t, "Stop", "user disconnected"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestWriteMultiplexedServerSentEvents(t *testing.T) {
+	Convey("Given an EventSource client resuming with the Last-Event-ID header is connected to the multiplex handler", t, func() {
+		filings, _, filingsData := mockStream()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings)
+		waitGroup := new(sync.WaitGroup)
+		multiplexHandler.wg = waitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+		request := httptest.NewRequest("GET", "/streams?names=filings&include_skipped=true", nil).WithContext(ctx)
+		request.Header.Add("Accept", "text/event-stream")
+		request.Header.Add("Last-Event-ID", "filings.0:3")
+		response := httptest.NewRecorder()
+		go multiplexHandler.HandleRequest(response, request)
+		Convey("When a message is published and another skipped", func() {
+			waitGroup.Add(1)
+			filingsData <- &model.StreamEvent{Data: "{}", Resource: &rcd.ResourceChangedData{}, Offset: 3}
+			waitGroup.Wait()
+			waitGroup.Add(1)
+			filingsData <- &model.StreamEvent{Offset: 4, Skipped: true}
+			waitGroup.Wait()
+			waitGroup.Add(1)
+			cancel()
+			waitGroup.Wait()
+			Convey("Then server-sent events named after the stream should be written identified by the composite cursor", func() {
+				So(response.Header().Get("Content-Type"), ShouldEqual, "text/event-stream")
+				So(response.Body.String(), ShouldEqual, "id: filings.0:4\nevent: filings\ndata: {}\n\n"+
+					"id: filings.0:5\nevent: skipped\ndata: {\"stream\":\"filings\",\"skipped\":{\"partition\":0,\"offset\":4}}\n\n")
+				So(filings.AssertCalled(t, "StartConsumer", model.Cursor{0: 3}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestStartMultiplexedStreamsFromTime(t *testing.T) {
+	Convey("Given a multiplex handler serving two streams", t, func() {
+		filings, _, _ := mockStream()
+		officers, _, _ := mockStream()
+		filings.On("OffsetsAt", mock.Anything).Return(model.Cursor{0: 3}, nil)
+		officers.On("OffsetsAt", mock.Anything).Return(model.Cursor{0: 9}, nil)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithStream("officers", officers)
+		waitGroup := new(sync.WaitGroup)
+		multiplexHandler.wg = waitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+		request := httptest.NewRequest("GET", "/streams?names=filings,officers&since=2020-01-02T03:04:05Z", nil).WithContext(ctx)
+		response := httptest.NewRecorder()
+		Convey("When a user requests the streams from a time", func() {
+			waitGroup.Add(1)
+			go multiplexHandler.HandleRequest(response, request)
+			cancel()
+			waitGroup.Wait()
+			Convey("Then each stream should be started from the offsets published since that time", func() {
+				since, _ := time.Parse(time.RFC3339, "2020-01-02T03:04:05Z")
+				So(filings.AssertCalled(t, "OffsetsAt", since), ShouldBeTrue)
+				So(filings.AssertCalled(t, "StartConsumer", model.Cursor{0: 3}), ShouldBeTrue)
+				So(officers.AssertCalled(t, "StartConsumer", model.Cursor{0: 9}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestWriteMultiplexedGapsTaggedByStream(t *testing.T) {
+	Convey("Given a user is connected to two streams", t, func() {
+		filings, filingsController, _ := mockStream()
+		filingsController.gaps = make(chan []*runner.Gap)
+		officers, _, _ := mockStream()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithStream("officers", officers)
+		waitGroup := new(sync.WaitGroup)
+		multiplexHandler.wg = waitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+		request := httptest.NewRequest("GET", "/streams?names=filings,officers", nil).WithContext(ctx)
+		response := httptest.NewRecorder()
+		go multiplexHandler.HandleRequest(response, request)
+		Convey("When messages are dropped from one stream because the user has fallen behind", func() {
+			waitGroup.Add(1)
+			filingsController.gaps <- []*runner.Gap{{Partition: 0, FirstOffset: 3, LastOffset: 4, Dropped: 2}}
+			waitGroup.Wait()
+			waitGroup.Add(1)
+			cancel()
+			waitGroup.Wait()
+			Convey("Then the user should be told which messages were dropped from which stream", func() {
+				So(response.Body.String(), ShouldEqual,
+					`{"stream":"filings","gap":{"partition":0,"first_offset":3,"last_offset":4,"dropped":2}}`+"\n")
+				So(logger.AssertCalled(t, "InfoR", request, "messages dropped", []log.Data{{"stream": "filings", "partition": int32(0), "dropped": 2}}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestWriteMultiplexedHeartbeatOnIdleConnection(t *testing.T) {
+	Convey("Given a user is connected to two streams with heartbeats enabled", t, func() {
+		ctx, disconnect := context.WithCancel(context.Background())
+		filings, _, _ := mockStream()
+		officers, _, _ := mockStream()
+		filings.On("HighWaterMarks").Return(model.Cursor{0: 10}, nil)
+		officers.On("HighWaterMarks").Return(model.Cursor{1: 20}, nil).Run(func(mock.Arguments) { disconnect() })
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithStream("officers", officers).WithHeartbeat(time.Millisecond)
+		waitGroup := new(sync.WaitGroup)
+		multiplexHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/streams?names=filings,officers", nil).WithContext(ctx)
+		response := httptest.NewRecorder()
+		Convey("When the connection is idle for the heartbeat interval before the user disconnects", func() {
+			waitGroup.Add(1)
+			go multiplexHandler.HandleRequest(response, request)
+			waitGroup.Wait()
+			output, _ := response.Body.ReadString('\n')
+			Convey("Then a heartbeat carrying the high-water marks of every stream should be written", func() {
+				So(output, ShouldEqual, `{"heartbeat":{"high_water_marks":{"filings":{"0":10},"officers":{"1":20}}}}`+"\n")
+			})
+		})
+	})
+}
+
+func TestCloseMultiplexedStreamWhenUserTooFarBehindAnyStream(t *testing.T) {
+	Convey("Given a user has received a message from one of two streams", t, func() {
+		filings, filingsController, filingsData := mockStream()
+		officers, officersController, _ := mockStream()
+		officersController.overflowed = make(chan struct{})
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithStream("officers", officers)
+		waitGroup := new(sync.WaitGroup)
+		multiplexHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/streams?names=filings,officers&format=sse", nil)
+		response := httptest.NewRecorder()
+		go multiplexHandler.HandleRequest(response, request)
+		waitGroup.Add(1)
+		filingsData <- &model.StreamEvent{Data: "{}", Resource: &rcd.ResourceChangedData{}, Offset: 7, Partition: 1}
+		waitGroup.Wait()
+		Convey("When the user's queue for the other stream overflows", func() {
+			waitGroup.Add(1)
+			close(officersController.overflowed)
+			waitGroup.Wait()
+			Convey("Then a closing event giving the composite cursor should be written and every consumer stopped", func() {
+				So(response.Body.String(), ShouldEqual, "id: filings.1:8\nevent: filings\ndata: {}\n\n"+
+					"event: closing\ndata: {\"reason\":\"slow_consumer\",\"resume_from\":\"filings.1:8\"}\n\n")
+				So(filingsController.AssertCalled(t, "Stop", "user too far behind stream"), ShouldBeTrue)
+				So(officersController.AssertCalled(t, "Stop", "user too far behind stream"), ShouldBeTrue)
+				So(logger.AssertCalled(t, "InfoR", request, "user too far behind stream", []log.Data{{"stream": "officers", "reason": "slow_consumer"}}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestCloseMultiplexedStreamWhenServerClosing(t *testing.T) {
+	Convey("Given a user is connected to the multiplex handler", t, func() {
+		closing := make(chan struct{})
+		filingsController := &mockController{}
+		filingsController.On("Data").Return(make(chan *model.StreamEvent))
+		filingsController.On("Stop", mock.Anything).Return()
+		filings := &mockConsumerRunner{}
+		filings.On("HighWaterMarks").Return(model.Cursor{0: 10, 1: 20}, nil)
+		filings.On("StartConsumer", mock.Anything).Return(filingsController, nil)
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithShutdown(closing)
+		waitGroup := new(sync.WaitGroup)
+		multiplexHandler.wg = waitGroup
+		request := httptest.NewRequest("GET", "/streams?names=filings&offset=filings.0:3", nil)
+		response := httptest.NewRecorder()
+		go multiplexHandler.HandleRequest(response, request)
+		Convey("When the server starts closing", func() {
+			waitGroup.Add(1)
+			close(closing)
+			waitGroup.Wait()
+			Convey("Then an end of stream marker giving the composite cursor of every partition should be written and the consumer stopped", func() {
+				So(response.Body.String(), ShouldEqual, `{"end_of_stream":{"reason":"server_closing","resume_from":"filings.0:3,filings.1:20"}}`+"\n")
+				So(filingsController.AssertCalled(t, "Stop", "server closing"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestMultiplexHandlerReturnsBadRequestIfRequestInvalid(t *testing.T) {
+	Convey("Given a multiplex handler serving the filings stream", t, func() {
+		filings := &mockConsumerRunner{}
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings)
+		Convey("When invalid requests are made", func() {
+			codes := make([]int, 0)
+			for _, query := range []string{"", "names=,", "names=officers", "names=filings&offset=0:3", "names=filings&offset=filings.0:3&since=2020-01-02T03:04:05Z",
+				"names=filings&since=yesterday", "names=filings&format=csv", "names=filings&event_type=x"} {
+				response := httptest.NewRecorder()
+				multiplexHandler.HandleRequest(response, httptest.NewRequest("GET", "/streams?"+query, nil))
+				codes = append(codes, response.Code)
+			}
+			Convey("Then each should be rejected with HTTP 400 Bad Request without starting a consumer", func() {
+				So(codes, ShouldResemble, []int{400, 400, 400, 400, 400, 400, 400, 400})
+				So(filings.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestMultiplexHandlerReturnsForbiddenIfKeyNotEntitledToEveryStream(t *testing.T) {
+	Convey("Given a user authenticated with a key entitled to the filings stream only", t, func() {
+		filings := &mockConsumerRunner{}
+		officers := &mockConsumerRunner{}
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithStream("officers", officers)
+		keys := &mockKeys{key: &auth.Key{Name: "acme", Key: "acme-key", Streams: []string{"filings"}}}
+		handler := auth.NewMiddleware(keys, logger).WithStreams("/streams").Handler(http.HandlerFunc(multiplexHandler.HandleRequest))
+		request := httptest.NewRequest("GET", "/streams?names=filings,officers", nil)
+		request.SetBasicAuth("acme-key", "")
+		response := httptest.NewRecorder()
+		Convey("When the user requests both the filings and officers streams", func() {
+			handler.ServeHTTP(response, request)
+			Convey("Then the response should be HTTP 403 Forbidden naming the stream without starting a consumer", func() {
+				So(response.Code, ShouldEqual, http.StatusForbidden)
+				So(response.Body.String(), ShouldEqual, `{"error":"API key not entitled to stream","stream":"officers"}`)
+				So(filings.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestMultiplexHandlerStopsStartedConsumersIfOffsetExpired(t *testing.T) {
+	Convey("Given the offset requested of the second of two streams has expired", t, func() {
+		filings, filingsController, _ := mockStream()
+		officers := &mockConsumerRunner{}
+		officers.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		officers.On("StartConsumer", mock.Anything).Return(&mockController{}, &runner.OffsetOutOfRangeError{Partition: 1, Offset: 3, Earliest: 5, Latest: 10})
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithStream("officers", officers)
+		request := httptest.NewRequest("GET", "/streams?names=filings,officers&offset=officers.1:3", nil)
+		response := httptest.NewRecorder()
+		Convey("When a request is made", func() {
+			multiplexHandler.HandleRequest(response, request)
+			Convey("Then the response should be HTTP 410 Gone naming the stream and the first consumer stopped", func() {
+				So(response.Code, ShouldEqual, http.StatusGone)
+				So(response.Body.String(), ShouldEqual, `{"error":"offset 3 is outside the range 5 to 10 held on partition 1",`+
+					`"stream":"officers","partition":1,"offset":3,"earliest_offset":5,"latest_offset":10}`)
+				So(filings.AssertCalled(t, "StartConsumer", model.Cursor(nil)), ShouldBeTrue)
+				So(filingsController.AssertCalled(t, "Stop", "user disconnected"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestWriteEventsOfEveryStreamBelongingToCompany(t *testing.T) {
+	Convey("Given a user is connected to the events of company 01234567", t, func() {
+		filings, _, filingsData := mockStream()
+		officers, _, officersData := mockStream()
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithStream("officers", officers)
+		waitGroup := new(sync.WaitGroup)
+		multiplexHandler.wg = waitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+		request := httptest.NewRequest("GET", "/companies/01234567/events?company_number=07654321&offset=officers.0:5", nil).WithContext(ctx)
+		request = mux.SetURLVars(request, map[string]string{"company_number": "01234567"})
+		response := httptest.NewRecorder()
+		go multiplexHandler.HandleCompanyRequest(response, request)
+		Convey("When events of that and other companies are published on each stream", func() {
+			for _, published := range []struct {
+				data  chan *model.StreamEvent
+				event *model.StreamEvent
+			}{
+				{officersData, &model.StreamEvent{Data: `{"id":1}`, Offset: 5, Resource: &rcd.ResourceChangedData{ResourceURI: "/company/01234567/officers/x"}}},
+				{filingsData, &model.StreamEvent{Data: `{"id":2}`, Offset: 8, Resource: &rcd.ResourceChangedData{ResourceURI: "/company/07654321/filing-history/y"}}},
+				{filingsData, &model.StreamEvent{Data: `{"id":3}`, Offset: 9, Resource: &rcd.ResourceChangedData{Data: map[string]interface{}{"company_number": "01234567"}}}},
+			} {
+				waitGroup.Add(1)
+				published.data <- published.event
+				waitGroup.Wait()
+			}
+			waitGroup.Add(1)
+			cancel()
+			waitGroup.Wait()
+			Convey("Then only the events belonging to the company should be written tagged with their stream", func() {
+				So(response.Body.String(), ShouldEqual,
+					`{"stream":"officers","resume_from":"officers.0:6","event":{"id":1}}`+"\n"+
+						`{"stream":"filings","resume_from":"filings.0:10,officers.0:6","event":{"id":3}}`+"\n")
+				So(filings.AssertCalled(t, "StartConsumer", model.Cursor(nil)), ShouldBeTrue)
+				So(officers.AssertCalled(t, "StartConsumer", model.Cursor{0: 5}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestWriteEventsOfEntitledStreamsBelongingToCompany(t *testing.T) {
+	Convey("Given a user authenticated with a key entitled to the filings stream only", t, func() {
+		filings, filingsController, _ := mockStream()
+		officers := &mockConsumerRunner{}
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings).WithStream("officers", officers)
+		keys := &mockKeys{key: &auth.Key{Name: "acme", Key: "acme-key", Streams: []string{"filings"}}}
+		route := mux.NewRouter()
+		route.Handle("/companies/{company_number}/events", http.HandlerFunc(multiplexHandler.HandleCompanyRequest))
+		handler := auth.NewMiddleware(keys, logger).WithStreamsPattern(regexp.MustCompile("^/companies/[^/]+/events$")).Handler(route)
+		ctx, cancel := context.WithCancel(context.Background())
+		request := httptest.NewRequest("GET", "/companies/01234567/events", nil).WithContext(ctx)
+		request.SetBasicAuth("acme-key", "")
+		response := httptest.NewRecorder()
+		Convey("When the user connects to the events of the company and then disconnects", func() {
+			cancel()
+			handler.ServeHTTP(response, request)
+			Convey("Then only the streams the key is entitled to should have been consumed", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(filings.AssertCalled(t, "StartConsumer", model.Cursor(nil)), ShouldBeTrue)
+				So(filingsController.AssertCalled(t, "Stop", "user disconnected"), ShouldBeTrue)
+				So(officers.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+	Convey("Given a user authenticated with a key entitled to none of the streams", t, func() {
+		filings := &mockConsumerRunner{}
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+		multiplexHandler := NewMultiplexHandler(logger).WithStream("filings", filings)
+		keys := &mockKeys{key: &auth.Key{Name: "acme", Key: "acme-key", Streams: []string{"charges"}}}
+		route := mux.NewRouter()
+		route.Handle("/companies/{company_number}/events", http.HandlerFunc(multiplexHandler.HandleCompanyRequest))
+		handler := auth.NewMiddleware(keys, logger).WithStreamsPattern(regexp.MustCompile("^/companies/[^/]+/events$")).Handler(route)
+		request := httptest.NewRequest("GET", "/companies/01234567/events", nil)
+		request.SetBasicAuth("acme-key", "")
+		response := httptest.NewRecorder()
+		Convey("When the user connects to the events of a company", func() {
+			handler.ServeHTTP(response, request)
+			Convey("Then the response should be HTTP 403 Forbidden without starting a consumer", func() {
+				So(response.Code, ShouldEqual, http.StatusForbidden)
+				So(response.Body.String(), ShouldEqual, `{"error":"API key not entitled to stream"}`)
+				So(filings.AssertNotCalled(t, "StartConsumer", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+// Return a consumer runner whose consumer reads messages from the returned channel.
+func mockStream() (*mockConsumerRunner, *mockController, chan *model.StreamEvent) {
+	data := make(chan *model.StreamEvent)
+	controller := &mockController{}
+	controller.On("Data").Return(data)
+	controller.On("Stop", mock.Anything).Return()
+	consumerRunner := &mockConsumerRunner{}
+	consumerRunner.On("HighWaterMarks").Return(model.Cursor{}, nil).Once()
+	consumerRunner.On("StartConsumer", mock.Anything).Return(controller, nil)
+	return consumerRunner, controller, data
+}
+
+func (k *mockKeys) Lookup(value string) *auth.Key {
+	if value == k.key.Key {
+		return k.key
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Package health reports the health of the dependencies of the application to orchestrators.
+package health
+
+import (
+	"errors"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+	checkTimeout      = 5 * time.Second
+	msgTimedOut       = "timed out"
+)
+
+// A named check of a dependency of the application, returning an error if the dependency is unhealthy.
+type Check struct {
+	Name string
+	Run  func() error
+}
+
+// Reports the health of the dependencies of the application. Readiness handlers report the application as unavailable
+// if any dependency is unhealthy; liveness handlers report the health of each dependency but always succeed so that
+// the application is not restarted while a dependency is unavailable.
+type Handler struct {
+	checks    []Check
+	readiness bool
+	timeout   time.Duration
+}
+
+// The health of the application and each of its dependencies.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// The outcome of a single check, including how long the dependency took to respond.
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Construct a handler reporting whether the application is alive.
+func NewLivenessHandler(checks ...Check) *Handler {
+	return &Handler{checks: checks, timeout: checkTimeout}
+}
+
+// Construct a handler reporting whether the application is ready to receive traffic.
+func NewReadinessHandler(checks ...Check) *Handler {
+	return &Handler{checks: checks, readiness: true, timeout: checkTimeout}
+}
+
+func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	report := h.Run()
+	status := http.StatusOK
+	if h.readiness && report.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	data, err := jsonproducer.Instance().Marshal(report)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_, _ = writer.Write(data)
+}
+
+// Run every check concurrently and report the outcome. A check that does not complete within the timeout is
+// reported as unhealthy.
+func (h *Handler) Run() *Report {
+	report := &Report{Status: statusOK, Checks: make([]CheckResult, len(h.checks))}
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = h.run(check)
+		}(i, check)
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Status != statusOK {
+			report.Status = statusUnavailable
+		}
+	}
+	return report
+}
+
+func (h *Handler) run(check Check) CheckResult {
+	start := time.Now()
+	outcome := make(chan error, 1)
+	go func() {
+		outcome <- check.Run()
+	}()
+	var err error
+	select {
+	case err = <-outcome:
+	case <-time.After(h.timeout):
+		err = errors.New(msgTimedOut)
+	}
+	result := CheckResult{
+		Name:      check.Name,
+		Status:    statusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = statusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
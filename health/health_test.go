@@ -0,0 +1,76 @@
+package health
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportHealthyDependencies(t *testing.T) {
+	Convey("Given every dependency of the application is healthy", t, func() {
+		handler := NewReadinessHandler(
+			Check{Name: "kafka", Run: func() error { return nil }},
+			Check{Name: "schema", Run: func() error { return nil }})
+		Convey("When readiness is requested", func() {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/healthcheck/ready", nil))
+			report := handler.Run()
+			Convey("Then the application should be reported as ready", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(response.Header().Get("Content-Type"), ShouldEqual, "application/json")
+				So(response.Body.String(), ShouldStartWith, `{"status":"ok","checks":[{"name":"kafka","status":"ok","latency_ms":`)
+				So(report.Status, ShouldEqual, "ok")
+				So(report.Checks, ShouldHaveLength, 2)
+				So(report.Checks[1].Name, ShouldEqual, "schema")
+			})
+		})
+	})
+}
+
+func TestReportUnhealthyDependencies(t *testing.T) {
+	Convey("Given a dependency of the application is unhealthy", t, func() {
+		checks := []Check{
+			{Name: "kafka", Run: func() error { return errors.New("something went wrong") }},
+			{Name: "schema", Run: func() error { return nil }},
+		}
+		readiness := NewReadinessHandler(checks...)
+		liveness := NewLivenessHandler(checks...)
+		Convey("When readiness and liveness are requested", func() {
+			readinessResponse := httptest.NewRecorder()
+			readiness.ServeHTTP(readinessResponse, httptest.NewRequest("GET", "/healthcheck/ready", nil))
+			livenessResponse := httptest.NewRecorder()
+			liveness.ServeHTTP(livenessResponse, httptest.NewRequest("GET", "/healthcheck/live", nil))
+			Convey("Then the application should be reported as unavailable but alive", func() {
+				So(readinessResponse.Code, ShouldEqual, http.StatusServiceUnavailable)
+				So(livenessResponse.Code, ShouldEqual, http.StatusOK)
+				So(readinessResponse.Body.String(), ShouldStartWith, `{"status":"unavailable",`)
+				So(readinessResponse.Body.String(), ShouldContainSubstring, `"error":"something went wrong"`)
+				So(livenessResponse.Body.String(), ShouldStartWith, `{"status":"unavailable",`)
+				So(strings.Count(livenessResponse.Body.String(), `"status":"ok"`), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestReportUnresponsiveDependencies(t *testing.T) {
+	Convey("Given a dependency of the application does not respond", t, func() {
+		blocked := make(chan struct{})
+		defer close(blocked)
+		handler := NewReadinessHandler(Check{Name: "kafka", Run: func() error {
+			<-blocked
+			return nil
+		}})
+		handler.timeout = time.Millisecond
+		Convey("When readiness is requested", func() {
+			report := handler.Run()
+			Convey("Then the dependency should be reported as having timed out", func() {
+				So(report.Status, ShouldEqual, "unavailable")
+				So(report.Checks[0].Error, ShouldEqual, "timed out")
+			})
+		})
+	})
+}
@@ -0,0 +1,258 @@
+// Package limit restricts the number of connections each client may hold open to streams and how often they may open
+// them.
+package limit
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/auth"
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"github.com/companieshouse/chs.go/log"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rateWindow             = time.Minute
+	connectionRetryAfter   = 30 * time.Second
+	keyIdentityPrefix      = "key:"
+	addressIdentityPrefix  = "ip:"
+	forwardedForHeader     = "X-Forwarded-For"
+	msgStreamLimitExceeded = "too many connections to stream"
+	msgTotalLimitExceeded  = "too many connections"
+	msgRateLimitExceeded   = "too many new connections"
+)
+
+// Rejects requests for streams from clients that already hold too many connections open, either to the stream
+// requested or in total, or that have opened too many connections within the last minute. Clients are identified by
+// the API key they were authenticated with or, failing that, by their source IP address. Requests for paths that are
+// not streams are passed through unchanged.
+type Limiter struct {
+	lock              sync.Mutex
+	perStream         int
+	total             int
+	perMinute         int
+	trustForwardedFor bool
+	streams           map[string]string
+	patterns          []*streamPattern
+	clients           map[string]*usage
+	swept             time.Time
+	now               func() time.Time
+	serialiser        transformer.Marshallable
+	logger            logger.Logger
+}
+
+// The connections held open and recently opened by a client.
+type usage struct {
+	connections int
+	streams     map[string]int
+	opened      []time.Time
+}
+
+// A stream served on every path matching a pattern, e.g. a path carrying a company number.
+type streamPattern struct {
+	pattern *regexp.Regexp
+	name    string
+}
+
+// Construct a new Limiter instance. Limits that are not positive are not enforced.
+func NewLimiter(cfg *config.Config, logger logger.Logger) *Limiter {
+	return &Limiter{
+		perStream:         cfg.StreamConnLimit,
+		total:             cfg.ConnLimit,
+		perMinute:         cfg.ConnRateLimit,
+		trustForwardedFor: cfg.TrustForwardedFor,
+		streams:           make(map[string]string),
+		clients:           make(map[string]*usage),
+		now:               time.Now,
+		serialiser:        jsonproducer.Instance(),
+		logger:            logger,
+	}
+}
+
+// Limit the connections to the named stream served on the given path.
+func (l *Limiter) WithStream(path string, name string) *Limiter {
+	l.streams[path] = name
+	return l
+}
+
+// Limit the connections to the named stream served on every path matching the given pattern.
+func (l *Limiter) WithStreamPattern(pattern *regexp.Regexp, name string) *Limiter {
+	l.patterns = append(l.patterns, &streamPattern{pattern: pattern, name: name})
+	return l
+}
+
+// Wrap the given handler so that it is only called for requests within the limits of the client, which hold a
+// connection until the handler returns.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		stream, ok := l.stream(request.URL.Path)
+		if !ok {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		identity := l.identify(request)
+		if msg, retryAfter := l.Acquire(identity, stream); msg != "" {
+			l.reject(writer, request, identity, stream, msg, retryAfter)
+			return
+		}
+		defer l.Release(identity, stream)
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// Return the usage of every client holding a connection or that has opened one within the last minute.
+func (l *Limiter) Usage() []*json.ClientUsage {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	clients := make([]*json.ClientUsage, 0, len(l.clients))
+	for identity, client := range l.clients {
+		client.prune(now)
+		if client.idle() {
+			continue
+		}
+		streams := make(map[string]int, len(client.streams))
+		for stream, connections := range client.streams {
+			streams[stream] = connections
+		}
+		clients = append(clients, &json.ClientUsage{
+			Identity:         identity,
+			Connections:      client.connections,
+			Streams:          streams,
+			OpenedLastMinute: len(client.opened),
+		})
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Identity < clients[j].Identity
+	})
+	return clients
+}
+
+// Return the name of the stream served on the given path, and false if the path does not serve a stream.
+func (l *Limiter) stream(path string) (string, bool) {
+	if name, ok := l.streams[path]; ok {
+		return name, true
+	}
+	for _, pattern := range l.patterns {
+		if pattern.pattern.MatchString(path) {
+			return pattern.name, true
+		}
+	}
+	return "", false
+}
+
+// Take a connection for the client if it is within its limits. Otherwise return the reason the connection has been
+// refused and how long the client should wait before trying again. Transports other than HTTP, e.g. gRPC, take their
+// connections here, so that each client's limits span every transport.
+func (l *Limiter) Acquire(identity string, stream string) (string, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	l.sweep(now)
+	client, ok := l.clients[identity]
+	if !ok {
+		client = &usage{streams: make(map[string]int)}
+		l.clients[identity] = client
+	}
+	client.prune(now)
+	if l.perMinute > 0 && len(client.opened) >= l.perMinute {
+		return msgRateLimitExceeded, client.opened[len(client.opened)-l.perMinute].Add(rateWindow).Sub(now)
+	}
+	if l.total > 0 && client.connections >= l.total {
+		return msgTotalLimitExceeded, connectionRetryAfter
+	}
+	if l.perStream > 0 && client.streams[stream] >= l.perStream {
+		return msgStreamLimitExceeded, connectionRetryAfter
+	}
+	client.connections++
+	client.streams[stream]++
+	client.opened = append(client.opened, now)
+	return "", 0
+}
+
+// Give up a connection held by the client.
+func (l *Limiter) Release(identity string, stream string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	client := l.clients[identity]
+	client.connections--
+	if client.streams[stream]--; client.streams[stream] == 0 {
+		delete(client.streams, stream)
+	}
+}
+
+// Forget clients that neither hold a connection nor have opened one within the last minute, at most once a minute.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateWindow {
+		return
+	}
+	l.swept = now
+	for identity, client := range l.clients {
+		if client.prune(now); client.idle() {
+			delete(l.clients, identity)
+		}
+	}
+}
+
+// Return the identity of the client making the request: the name of its API key if it has been authenticated,
+// otherwise its source IP address.
+func (l *Limiter) identify(request *http.Request) string {
+	key := auth.KeyFromContext(request.Context())
+	if key == nil && l.trustForwardedFor {
+		if forwarded := request.Header.Get(forwardedForHeader); forwarded != "" {
+			return addressIdentityPrefix + strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	return Identity(key, request.RemoteAddr)
+}
+
+// Return the identity a client is limited under: the name of the API key it was authenticated with, if any, otherwise
+// the IP address of the given host and port.
+func Identity(key *auth.Key, address string) string {
+	if key != nil {
+		return keyIdentityPrefix + key.Name
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return addressIdentityPrefix + host
+}
+
+func (l *Limiter) reject(writer http.ResponseWriter, request *http.Request, identity string, stream string, msg string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	l.logger.InfoR(request, msg, log.Data{"identity": identity, "stream": stream, "retry_after": seconds})
+	writer.Header().Set("Retry-After", strconv.Itoa(seconds))
+	body, err := l.serialiser.Marshal(&json.LimitExceeded{Error: msg, Stream: stream, RetryAfter: seconds})
+	if err != nil {
+		l.logger.ErrorR(request, err)
+		writer.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusTooManyRequests)
+	_, _ = writer.Write(body)
+}
+
+// Forget the connections opened before the last minute.
+func (u *usage) prune(now time.Time) {
+	expired := 0
+	for expired < len(u.opened) && now.Sub(u.opened[expired]) >= rateWindow {
+		expired++
+	}
+	u.opened = u.opened[expired:]
+}
+
+func (u *usage) idle() bool {
+	return u.connections == 0 && len(u.opened) == 0
+}
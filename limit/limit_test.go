@@ -0,0 +1,256 @@
+package limit
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/auth"
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs.go/log"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type mockLogger struct {
+	mock.Mock
+}
+
+func TestCreateNewLimiter(t *testing.T) {
+	Convey("When a new limiter instance is constructed", t, func() {
+		logger := &mockLogger{}
+		actual := NewLimiter(&config.Config{StreamConnLimit: 2, ConnLimit: 5, ConnRateLimit: 10, TrustForwardedFor: true}, logger).
+			WithStream("/filings", "filings")
+		Convey("Then a new limiter instance should be returned", func() {
+			So(actual.perStream, ShouldEqual, 2)
+			So(actual.total, ShouldEqual, 5)
+			So(actual.perMinute, ShouldEqual, 10)
+			So(actual.trustForwardedFor, ShouldBeTrue)
+			So(actual.streams, ShouldResemble, map[string]string{"/filings": "filings"})
+			So(actual.clients, ShouldBeEmpty)
+			So(actual.now, ShouldNotBeNil)
+			So(actual.serialiser, ShouldNotBeNil)
+			So(actual.logger, ShouldEqual, logger)
+		})
+	})
+}
+
+// Serves requests for streams through the limiter, holding every connection accepted open until it is released.
+type server struct {
+	handler  http.Handler
+	accepted chan struct{}
+	release  chan struct{}
+}
+
+func newServer(limiter *Limiter) *server {
+	s := &server{accepted: make(chan struct{}), release: make(chan struct{})}
+	s.handler = limiter.Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		s.accepted <- struct{}{}
+		<-s.release
+	}))
+	return s
+}
+
+// Open a connection, returning the response if it was refused or nil once it is being held open.
+func (s *server) open(request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	refused := make(chan struct{})
+	go func() {
+		s.handler.ServeHTTP(recorder, request)
+		select {
+		case <-s.release:
+		default:
+			close(refused)
+		}
+	}()
+	select {
+	case <-s.accepted:
+		return nil
+	case <-refused:
+		return recorder
+	}
+}
+
+func request(path string, remoteAddr string) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.RemoteAddr = remoteAddr
+	return request
+}
+
+func TestLimitConnectionsPerClient(t *testing.T) {
+	Convey("Given a limiter allowing two connections to each stream and three in total", t, func() {
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything)
+		limiter := NewLimiter(&config.Config{StreamConnLimit: 2, ConnLimit: 3}, logger).
+			WithStream("/filings", "filings").
+			WithStream("/officers", "officers")
+		s := newServer(limiter)
+		defer close(s.release)
+		So(s.open(request("/filings", "10.0.0.1:1234")), ShouldBeNil)
+		So(s.open(request("/filings", "10.0.0.1:1235")), ShouldBeNil)
+		Convey("When a client opens a third connection to the same stream", func() {
+			actual := s.open(request("/filings", "10.0.0.1:1236"))
+			Convey("Then the connection should be refused", func() {
+				So(actual.Code, ShouldEqual, http.StatusTooManyRequests)
+				So(actual.Header().Get("Retry-After"), ShouldEqual, "30")
+				So(actual.Header().Get("Content-Type"), ShouldEqual, "application/json")
+				So(actual.Body.String(), ShouldEqual, `{"error":"too many connections to stream","stream":"filings","retry_after":30}`)
+				logger.AssertCalled(t, "InfoR", mock.Anything, msgStreamLimitExceeded, []log.Data{{"identity": "ip:10.0.0.1", "stream": "filings", "retry_after": 30}})
+			})
+		})
+		Convey("When a client opens connections to another stream beyond its total limit", func() {
+			first := s.open(request("/officers", "10.0.0.1:1237"))
+			second := s.open(request("/officers", "10.0.0.1:1238"))
+			Convey("Then only the connections within the total limit should be accepted", func() {
+				So(first, ShouldBeNil)
+				So(second.Code, ShouldEqual, http.StatusTooManyRequests)
+				So(second.Body.String(), ShouldContainSubstring, msgTotalLimitExceeded)
+			})
+		})
+		Convey("When another client connects to the same stream", func() {
+			actual := s.open(request("/filings", "10.0.0.2:1234"))
+			Convey("Then the connection should be accepted", func() {
+				So(actual, ShouldBeNil)
+			})
+		})
+		Convey("When a request for a path that is not a stream is received", func() {
+			recorder := httptest.NewRecorder()
+			called := false
+			limiter.Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				called = true
+			})).ServeHTTP(recorder, request("/healthcheck", "10.0.0.1:1239"))
+			Convey("Then the request should be passed on", func() {
+				So(called, ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestLimitConnectionsToPathsMatchingPattern(t *testing.T) {
+	Convey("Given a limiter allowing one connection to each stream, including one served on paths matching a pattern", t, func() {
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything)
+		limiter := NewLimiter(&config.Config{StreamConnLimit: 1}, logger).
+			WithStreamPattern(regexp.MustCompile("^/companies/[^/]+/events$"), "company-events")
+		s := newServer(limiter)
+		defer close(s.release)
+		So(s.open(request("/companies/01234567/events", "10.0.0.1:1234")), ShouldBeNil)
+		Convey("When a client opens a connection to another path matching the pattern", func() {
+			actual := s.open(request("/companies/07654321/events", "10.0.0.1:1235"))
+			Convey("Then the connection should be refused as it is to the same stream", func() {
+				So(actual.Code, ShouldEqual, http.StatusTooManyRequests)
+				So(actual.Body.String(), ShouldContainSubstring, `"stream":"company-events"`)
+			})
+		})
+	})
+}
+
+func TestReleaseConnectionsOnceClosed(t *testing.T) {
+	Convey("Given a limiter allowing one connection in total", t, func() {
+		limiter := NewLimiter(&config.Config{ConnLimit: 1}, &mockLogger{}).WithStream("/filings", "filings")
+		handler := limiter.Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+		Convey("When a client opens and closes connections one after another", func() {
+			first := httptest.NewRecorder()
+			handler.ServeHTTP(first, request("/filings", "10.0.0.1:1234"))
+			second := httptest.NewRecorder()
+			handler.ServeHTTP(second, request("/filings", "10.0.0.1:1235"))
+			Convey("Then every connection should be accepted", func() {
+				So(first.Code, ShouldEqual, http.StatusOK)
+				So(second.Code, ShouldEqual, http.StatusOK)
+				So(limiter.clients["ip:10.0.0.1"].connections, ShouldEqual, 0)
+				So(limiter.clients["ip:10.0.0.1"].streams, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestLimitNewConnectionsPerMinute(t *testing.T) {
+	Convey("Given a limiter allowing two new connections a minute", t, func() {
+		logger := &mockLogger{}
+		logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything)
+		now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		limiter := NewLimiter(&config.Config{ConnRateLimit: 2}, logger).WithStream("/filings", "filings")
+		limiter.now = func() time.Time { return now }
+		handler := limiter.Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+		serve := func() *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request("/filings", "10.0.0.1:1234"))
+			return recorder
+		}
+		So(serve().Code, ShouldEqual, http.StatusOK)
+		now = now.Add(20 * time.Second)
+		So(serve().Code, ShouldEqual, http.StatusOK)
+		Convey("When a third connection is opened within the minute", func() {
+			now = now.Add(10 * time.Second)
+			actual := serve()
+			Convey("Then it should be refused until the first connection is a minute old", func() {
+				So(actual.Code, ShouldEqual, http.StatusTooManyRequests)
+				So(actual.Header().Get("Retry-After"), ShouldEqual, "30")
+				So(actual.Body.String(), ShouldEqual, `{"error":"too many new connections","stream":"filings","retry_after":30}`)
+			})
+		})
+		Convey("When a third connection is opened once the first is a minute old", func() {
+			now = now.Add(40 * time.Second)
+			actual := serve()
+			Convey("Then it should be accepted", func() {
+				So(actual.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestIdentifyClients(t *testing.T) {
+	Convey("Given a limiter", t, func() {
+		limiter := NewLimiter(&config.Config{}, &mockLogger{})
+		Convey("When a request that has not been authenticated is identified", func() {
+			actual := limiter.identify(request("/filings", "10.0.0.1:1234"))
+			Convey("Then it should be identified by its source IP address", func() {
+				So(actual, ShouldEqual, "ip:10.0.0.1")
+			})
+		})
+		Convey("When a request forwarded by a proxy is identified", func() {
+			forwarded := request("/filings", "10.0.0.1:1234")
+			forwarded.Header.Set("X-Forwarded-For", "192.168.0.1, 10.0.0.1")
+			Convey("Then it should be identified by the forwarded address only if forwarded addresses are trusted", func() {
+				So(limiter.identify(forwarded), ShouldEqual, "ip:10.0.0.1")
+				limiter.trustForwardedFor = true
+				So(limiter.identify(forwarded), ShouldEqual, "ip:192.168.0.1")
+			})
+		})
+	})
+	Convey("Given a limiter behind API key authentication", t, func() {
+		keys, _ := auth.ParseKeyStore([]byte("keys:\n  - name: acme\n    key: acme-key\n    streams: [filings]\n"))
+		logger := &mockLogger{}
+		var identity string
+		limiter := NewLimiter(&config.Config{}, logger)
+		handler := auth.NewMiddleware(keys, logger).WithStream("/filings", "filings").Handler(
+			http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				identity = limiter.identify(request)
+			}))
+		Convey("When an authenticated request is identified", func() {
+			authenticated := request("/filings", "10.0.0.1:1234")
+			authenticated.Header.Set("Authorization", "acme-key")
+			handler.ServeHTTP(httptest.NewRecorder(), authenticated)
+			Convey("Then it should be identified by the name of its API key", func() {
+				So(identity, ShouldEqual, "key:acme")
+			})
+		})
+	})
+}
+
+func (l *mockLogger) Error(err error, data ...log.Data) {
+	l.Called(err, data)
+}
+
+func (l *mockLogger) Info(msg string, data ...log.Data) {
+	l.Called(msg, data)
+}
+
+func (l *mockLogger) InfoR(req *http.Request, msg string, data ...log.Data) {
+	l.Called(req, msg, data)
+}
+
+func (l *mockLogger) ErrorR(req *http.Request, err error, data ...log.Data) {
+	l.Called(req, err, data)
+}
@@ -0,0 +1,38 @@
+package limit
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"net/http"
+)
+
+// Returns the connections held open and recently opened by each client.
+type Reportable interface {
+	Usage() []*json.ClientUsage
+}
+
+// Reports the current usage of each client to administrators.
+type UsageHandler struct {
+	limiter Reportable
+}
+
+// The usage of every client holding a connection or that has opened one within the last minute.
+type UsageReport struct {
+	Clients []*json.ClientUsage `json:"clients"`
+}
+
+// Construct a new UsageHandler instance.
+func NewUsageHandler(limiter Reportable) *UsageHandler {
+	return &UsageHandler{limiter: limiter}
+}
+
+func (h *UsageHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	data, err := jsonproducer.Instance().Marshal(&UsageReport{Clients: h.limiter.Usage()})
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(data)
+}
@@ -0,0 +1,27 @@
+package limit
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReportClientUsage(t *testing.T) {
+	Convey("Given a limiter with a client holding a connection open", t, func() {
+		limiter := NewLimiter(&config.Config{}, &mockLogger{}).WithStream("/filings", "filings")
+		s := newServer(limiter)
+		defer close(s.release)
+		So(s.open(request("/filings", "10.0.0.1:1234")), ShouldBeNil)
+		Convey("When the usage of each client is requested", func() {
+			recorder := httptest.NewRecorder()
+			NewUsageHandler(limiter).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/connections", nil))
+			Convey("Then the connections held by the client should be reported", func() {
+				So(recorder.Code, ShouldEqual, http.StatusOK)
+				So(recorder.Header().Get("Content-Type"), ShouldEqual, "application/json")
+				So(recorder.Body.String(), ShouldEqual, `{"clients":[{"identity":"ip:10.0.0.1","connections":1,"streams":{"filings":1},"opened_last_minute":1}]}`)
+			})
+		})
+	})
+}
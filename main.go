@@ -1,61 +1,258 @@
 package main
 
 import (
+	_ "embed"
 	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/auth"
 	chsconfig "github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs-streaming-api-backend/deadletter"
+	"github.com/companieshouse/chs-streaming-api-backend/handler"
+	"github.com/companieshouse/chs-streaming-api-backend/health"
+	"github.com/companieshouse/chs-streaming-api-backend/limit"
+	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/companieshouse/chs-streaming-api-backend/rpc"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	"github.com/companieshouse/chs-streaming-api-backend/schemaregistry"
 	"github.com/companieshouse/chs-streaming-api-backend/service"
-	"github.com/companieshouse/chs.go/avro"
-	"github.com/companieshouse/chs.go/avro/schema"
+	"github.com/companieshouse/chs-streaming-api-backend/socket"
 	chslog "github.com/companieshouse/chs.go/log"
 	chsservice "github.com/companieshouse/chs.go/service"
 	chshandler "github.com/companieshouse/chs.go/service/handlers/requestID"
 	"github.com/justinas/alice"
-	"net/http"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
 )
 
 const (
-	schemaName              = "resource-changed-data"
-	filingHistoryStream     = "stream-filing-history"
-	companyProfileStream    = "stream-company-profile"
-	companyInsolvencyStream = "stream-company-insolvency"
-	companyChargesStream    = "stream-company-charges"
-	companyOfficersStream   = "stream-company-officers"
-	companyPSCStream        = "stream-company-psc"
-	servicePrefix           = "/streaming-api-backend"
+	// The name connections to the WebSocket endpoint are limited under, as several streams are served on each.
+	socketStreamName = "websocket"
+	// The name connections to the multiplexed endpoint are limited under, as several streams are served on each.
+	multiplexStreamName = "streams"
+	// The name connections to the company events endpoint are limited under, whichever company is requested.
+	companyEventsStreamName = "company-events"
+	// Administrative paths, which require an admin key if API keys are configured.
+	metricsPath     = "/metrics"
+	connectionsPath = "/admin/connections"
 )
 
+// The streams served when no stream registry file has been configured.
+//
+//go:embed streams.yaml
+var defaultStreams []byte
+
 func main() {
 	chsservice.DefaultMiddleware = []alice.Constructor{chshandler.Handler(20), chslog.Handler}
 	config, err := chsconfig.Get()
 	if err != nil {
 		panic(err)
 	}
-	svc := chsservice.New(config.ServiceConfig())
-	chslog.Info("fetching avro schema from schema registry", chslog.Data{"schema_name": schemaName})
-	s, err := schema.Get(config.SchemaRegistryURL, schemaName)
+	if _, err := runner.ParseOverflowPolicy(config.OverflowPolicy); err != nil {
+		chslog.Error(err)
+		panic(err)
+	}
+	registry, err := streamRegistry(config)
+	if err != nil {
+		chslog.Error(fmt.Errorf("error loading stream registry: %s", err))
+		panic(err)
+	}
+	if config.EmitRoutes {
+		routes, err := registry.Routes()
+		if err != nil {
+			panic(err)
+		}
+		_, _ = os.Stdout.Write(routes)
+		return
+	}
+	deadLetters, err := deadletter.NewSink(config)
+	if err != nil {
+		chslog.Error(fmt.Errorf("error creating dead letter sink: %s", err))
+		panic(err)
+	}
+	keys, err := apiKeys(config)
 	if err != nil {
-		chslog.Error(fmt.Errorf("error receiving %s schema: %s", schemaName, err))
+		chslog.Error(fmt.Errorf("error loading API keys: %s", err))
+		panic(err)
+	}
+	var authentication *auth.Middleware
+	if keys != nil {
+		authentication = auth.NewMiddleware(keys, logger.NewLogger())
+	}
+	limiter := limit.NewLimiter(config, logger.NewLogger())
+	svc := chsservice.New(config.ServiceConfig())
+	server := service.NewServer(config)
+	bootstrap := schemaregistry.NewBootstrap(config)
+	schemas := make(map[string]*schemaregistry.Schema)
+	for _, schemaName := range registry.Schemas() {
+		s, err := bootstrap.Load(schemaName)
+		if err != nil {
+			chslog.Error(err)
+			panic(err)
+		}
+		schemas[schemaName] = s
+	}
+
+	// Messages are resolved from the schema they were written with to the schema fetched above
+	registryClient := schemaregistry.NewClient(config.SchemaRegistryURL)
+
+	sockets := socket.NewHandler(logger.NewLogger()).
+		WithAllowedOrigins(config.AllowedOrigins).
+		WithHeartbeat(time.Duration(config.HeartbeatInterval) * time.Second).
+		WithShutdown(server.Closing())
+	multiplexer := handler.NewMultiplexHandler(logger.NewLogger()).
+		WithHeartbeat(time.Duration(config.HeartbeatInterval) * time.Second).
+		WithShutdown(server.Closing())
+
+	var grpcServer *rpc.Server
+	if config.GRPCBindAddress != "" {
+		grpcServer = rpc.NewServer(config, logger.NewLogger()).WithLimiter(limiter).WithShutdown(server.Closing())
+		if keys != nil {
+			grpcServer.WithKeys(keys)
+		}
+		server.RegisterTransport(grpcServer)
+	}
+
+	checks := make([]health.Check, 0)
+	for _, schemaName := range registry.Schemas() {
+		checks = append(checks, health.Check{Name: "schema:" + schemaName, Run: schemaLoaded(schemas, schemaName)})
+	}
+	for _, stream := range registry.Streams {
+		backendService := service.NewBackendService(&service.BackendConfiguration{
+			Configuration: config,
+			Schema:        schemas[stream.Schema],
+			Registry:      registryClient,
+			Router:        svc.Router(),
+			Prefix:        registry.Prefix,
+			Closing:       server.Closing(),
+			DeadLetters:   deadLetters,
+		}).WithTopic(stream.Topic)
+		if stream.Options.HeartbeatInterval != nil {
+			backendService.WithHeartbeat(time.Duration(*stream.Options.HeartbeatInterval) * time.Second)
+		}
+		backendService.WithPath(stream.Path)
+		if authentication != nil {
+			authentication.WithStream(registry.Prefix+stream.Path, stream.Name)
+		}
+		limiter.WithStream(registry.Prefix+stream.Path, stream.Name)
+		sockets.WithStream(stream.Name, backendService.Runner())
+		multiplexer.WithStream(stream.Name, backendService.Runner())
+		if grpcServer != nil {
+			grpcServer.WithStream(stream.Name, backendService.Runner())
+		}
+		server.Register(backendService)
+		checks = append(checks, health.Check{Name: "kafka:" + stream.Topic, Run: backendService.CheckBrokers})
+		chslog.Info("registered stream", chslog.Data{"stream": stream.Name, "topic": stream.Topic, "path": registry.Prefix + stream.Path})
+	}
+
+	if registry.WebSocketPath != "" {
+		svc.Router().Path(registry.Prefix + registry.WebSocketPath).Methods("GET").HandlerFunc(sockets.HandleRequest)
+		if authentication != nil {
+			authentication.WithStreams(registry.Prefix + registry.WebSocketPath)
+		}
+		limiter.WithStream(registry.Prefix+registry.WebSocketPath, socketStreamName)
+		chslog.Info("registered WebSocket endpoint", chslog.Data{"path": registry.Prefix + registry.WebSocketPath})
+	}
+
+	if registry.MultiplexPath != "" {
+		svc.Router().Path(registry.Prefix + registry.MultiplexPath).Methods("GET").HandlerFunc(multiplexer.HandleRequest)
+		if authentication != nil {
+			authentication.WithStreams(registry.Prefix + registry.MultiplexPath)
+		}
+		limiter.WithStream(registry.Prefix+registry.MultiplexPath, multiplexStreamName)
+		chslog.Info("registered multiplexed endpoint", chslog.Data{"path": registry.Prefix + registry.MultiplexPath})
+	}
+
+	if registry.CompanyEventsPath != "" {
+		route := svc.Router().Path(registry.Prefix + registry.CompanyEventsPath).Methods("GET").HandlerFunc(multiplexer.HandleCompanyRequest)
+		pathRegexp, err := route.GetPathRegexp()
+		if err != nil {
+			chslog.Error(fmt.Errorf("error registering company events endpoint: %s", err))
+			panic(err)
+		}
+		pattern := regexp.MustCompile(pathRegexp)
+		if authentication != nil {
+			authentication.WithStreamsPattern(pattern)
+		}
+		limiter.WithStreamPattern(pattern, companyEventsStreamName)
+		chslog.Info("registered company events endpoint", chslog.Data{"path": registry.Prefix + registry.CompanyEventsPath})
+	}
+
+	svc.Router().Path(metricsPath).Methods("GET").Handler(metrics.Handler())
+	svc.Router().Path("/healthcheck").Methods("GET").Handler(health.NewLivenessHandler(checks...))
+	svc.Router().Path("/healthcheck/live").Methods("GET").Handler(health.NewLivenessHandler(checks...))
+	svc.Router().Path("/healthcheck/ready").Methods("GET").Handler(health.NewReadinessHandler(checks...))
+	svc.Router().Path(connectionsPath).Methods("GET").Handler(limit.NewUsageHandler(limiter))
+	if authentication != nil {
+		authentication.WithAdminPath(metricsPath).WithAdminPath(connectionsPath)
+	}
+
+	shutdownComplete := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+		chslog.Info("shutting down", chslog.Data{"signal": sig.String(), "grace_period": config.ShutdownGracePeriod})
+		if err := server.Shutdown(); err != nil {
+			chslog.Error(fmt.Errorf("error shutting down gracefully: %s", err))
+		}
+		close(shutdownComplete)
+	}()
+	if grpcServer != nil {
+		go func() {
+			chslog.Info("serving gRPC streams", chslog.Data{"address": config.GRPCBindAddress})
+			if err := grpcServer.Start(); err != nil {
+				chslog.Error(fmt.Errorf("error serving gRPC streams: %s", err))
+				panic(err)
+			}
+		}()
+	}
+	chain := alice.New(chsservice.DefaultMiddleware...)
+	if authentication != nil {
+		chain = chain.Append(authentication.Handler)
+	}
+	// Clients are limited after authentication so that they can be identified by their API key
+	chain = chain.Append(limiter.Handler)
+	if err := server.Start(chain.Then(svc.Router())); err != nil {
+		chslog.Error(err)
 		panic(err)
 	}
-	rcdAvroSchema := &avro.Schema{
-		Definition: s,
+	<-shutdownComplete
+	if closer, ok := deadLetters.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			chslog.Error(fmt.Errorf("error closing dead letter sink: %s", err))
+		}
 	}
-	backendConfiguration := &service.BackendConfiguration{
-		Configuration: config,
-		Schema:        rcdAvroSchema,
-		Router:        svc.Router(),
-		Prefix:        servicePrefix,
+}
+
+// Return a check that the named Avro schema has been loaded from the schema registry.
+func schemaLoaded(schemas map[string]*schemaregistry.Schema, schemaName string) func() error {
+	return func() error {
+		if schema := schemas[schemaName]; schema == nil || schema.Definition() == "" {
+			return fmt.Errorf("schema %s has not been loaded", schemaName)
+		}
+		return nil
 	}
+}
 
-	service.NewBackendService(backendConfiguration).WithTopic(filingHistoryStream).WithPath("/filings")
-	service.NewBackendService(backendConfiguration).WithTopic(companyProfileStream).WithPath("/companies")
-	service.NewBackendService(backendConfiguration).WithTopic(companyInsolvencyStream).WithPath("/insolvency-cases")
-	service.NewBackendService(backendConfiguration).WithTopic(companyChargesStream).WithPath("/charges")
-	service.NewBackendService(backendConfiguration).WithTopic(companyOfficersStream).WithPath("/officers")
-	service.NewBackendService(backendConfiguration).WithTopic(companyPSCStream).WithPath("/persons-with-significant-control")
+// Return the API keys streams are restricted to, held in the configured file, or nil if no file has been configured
+// and streams may be consumed without a key.
+func apiKeys(config *chsconfig.Config) (*auth.KeyStore, error) {
+	if config.APIKeysFile == "" {
+		chslog.Info("no API keys file configured, streams can be consumed without an API key")
+		return nil, nil
+	}
+	return auth.ReadKeyStore(config.APIKeysFile)
+}
 
-	svc.Router().Path("/healthcheck").Methods("GET").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
-	})
-	svc.Start()
+// Return the stream registry held in the configured file, or the registry built into the application if no file has
+// been configured.
+func streamRegistry(config *chsconfig.Config) (*chsconfig.StreamRegistry, error) {
+	if config.StreamsFile == "" {
+		return chsconfig.ParseStreamRegistry(defaultStreams)
+	}
+	return chsconfig.ReadStreamRegistry(config.StreamsFile)
 }
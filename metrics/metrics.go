@@ -0,0 +1,109 @@
+// Package metrics holds the Prometheus metrics describing the streams served by the application.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const (
+	namespace     = "chs_streaming_api_backend"
+	topicLabel    = "topic"
+	policyLabel   = "policy"
+	encodingLabel = "encoding"
+)
+
+var (
+	// The number of users currently connected to each stream.
+	Connections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connections",
+		Help:      "The number of users currently connected to the stream.",
+	}, []string{topicLabel})
+
+	// The number of messages consumed from each topic by live and catch-up consumers.
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_consumed_total",
+		Help:      "The number of messages consumed from the topic.",
+	}, []string{topicLabel})
+
+	// The number of messages written to users of each stream.
+	MessagesPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_published_total",
+		Help:      "The number of messages written to users of the stream.",
+	}, []string{topicLabel})
+
+	// The number of messages consumed from each topic that could not be transformed.
+	TransformErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transform_errors_total",
+		Help:      "The number of messages consumed from the topic that could not be transformed.",
+	}, []string{topicLabel})
+
+	// The number of messages consumed from each topic that could not be transformed and were recorded as dead letters.
+	DeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dead_letters_total",
+		Help:      "The number of messages consumed from the topic that were recorded as dead letters.",
+	}, []string{topicLabel})
+
+	// The number of errors raised by Kafka while consuming each topic, including consumers that failed to start.
+	KafkaErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_errors_total",
+		Help:      "The number of errors raised by Kafka while consuming the topic.",
+	}, []string{topicLabel})
+
+	// The number of catch-up consumers started for users resuming each stream from an older offset.
+	CatchUpConsumers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "catch_up_consumers_total",
+		Help:      "The number of catch-up consumers started for users resuming the stream from an older offset.",
+	}, []string{topicLabel})
+
+	// The time taken to transform each message consumed from each topic.
+	TransformDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transform_duration_seconds",
+		Help:      "The time taken to transform a message consumed from the topic.",
+		Buckets:   []float64{.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1},
+	}, []string{topicLabel})
+
+	// The number of messages queued for a user of each stream, observed each time a message is queued.
+	QueueDepth = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "The number of messages queued for a user of the stream.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+	}, []string{topicLabel})
+
+	// The number of messages published to users of each stream whose queue was full, by the overflow policy applied.
+	Overflows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_overflows_total",
+		Help:      "The number of messages published to users of the stream whose queue was full.",
+	}, []string{topicLabel, policyLabel})
+
+	// The number of bytes written to users of each stream before compression, by the content encoding negotiated.
+	UncompressedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uncompressed_bytes_total",
+		Help:      "The number of bytes written to users of the stream before compression.",
+	}, []string{topicLabel, encodingLabel})
+
+	// The number of bytes sent to users of each stream after compression, by the content encoding negotiated.
+	CompressedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "compressed_bytes_total",
+		Help:      "The number of bytes sent to users of the stream after compression.",
+	}, []string{topicLabel, encodingLabel})
+)
+
+// Return a handler exposing the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
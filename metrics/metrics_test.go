@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExposeMetrics(t *testing.T) {
+	Convey("Given a user has connected to a stream", t, func() {
+		Connections.WithLabelValues("stream-company-profile").Inc()
+		Convey("When the metrics are requested", func() {
+			response := httptest.NewRecorder()
+			Handler().ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+			Convey("Then the metrics should be exposed in the Prometheus text format", func() {
+				So(response.Code, ShouldEqual, 200)
+				So(response.Body.String(), ShouldContainSubstring, `chs_streaming_api_backend_connections{topic="stream-company-profile"} 1`)
+			})
+		})
+	})
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	cursorPartitionSeparator = ","
+	cursorOffsetSeparator    = ":"
+	cursorStreamSeparator    = "."
+)
+
+// The position a user has reached within each partition of a topic, keyed by partition.
+type Cursor map[int32]int64
+
+// Parse a cursor of the form "partition:offset,partition:offset". A plain offset is treated as a position within
+// partition 0 so that users of single partition topics can continue to resume from an offset alone.
+func ParseCursor(input string) (Cursor, error) {
+	if input == "" {
+		return nil, nil
+	}
+	if offset, err := strconv.ParseInt(input, 10, 64); err == nil {
+		return Cursor{0: offset}, nil
+	}
+	cursor := make(Cursor)
+	for _, position := range strings.Split(input, cursorPartitionSeparator) {
+		parts := strings.Split(position, cursorOffsetSeparator)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid cursor position: %s", position)
+		}
+		partition, err := strconv.ParseInt(parts[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor partition: %s", parts[0])
+		}
+		offset, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor offset: %s", parts[1])
+		}
+		cursor[int32(partition)] = offset
+	}
+	return cursor, nil
+}
+
+// Format the cursor as "partition:offset,partition:offset" ordered by partition.
+func (c Cursor) String() string {
+	partitions := make([]int32, 0, len(c))
+	for partition := range c {
+		partitions = append(partitions, partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	positions := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		positions = append(positions, fmt.Sprintf("%d%s%d", partition, cursorOffsetSeparator, c[partition]))
+	}
+	return strings.Join(positions, cursorPartitionSeparator)
+}
+
+// The position a user has reached within each of several streams, keyed by stream name.
+type StreamCursor map[string]Cursor
+
+// Parse a composite cursor of the form "stream.partition:offset,stream.partition:offset", holding the position reached
+// within each partition of each stream.
+func ParseStreamCursor(input string) (StreamCursor, error) {
+	if input == "" {
+		return nil, nil
+	}
+	cursor := make(StreamCursor)
+	for _, position := range strings.Split(input, cursorPartitionSeparator) {
+		separator := strings.LastIndex(position, cursorStreamSeparator)
+		if separator < 1 {
+			return nil, fmt.Errorf("invalid cursor position: %s", position)
+		}
+		name, partitionPosition := position[:separator], position[separator+1:]
+		// Unlike cursors for a single stream, plain offsets are not accepted
+		if !strings.Contains(partitionPosition, cursorOffsetSeparator) {
+			return nil, fmt.Errorf("invalid cursor position: %s", position)
+		}
+		partitionCursor, err := ParseCursor(partitionPosition)
+		if err != nil {
+			return nil, err
+		}
+		if cursor[name] == nil {
+			cursor[name] = make(Cursor)
+		}
+		for partition, offset := range partitionCursor {
+			cursor[name][partition] = offset
+		}
+	}
+	return cursor, nil
+}
+
+// Format the cursor as "stream.partition:offset,stream.partition:offset" ordered by stream name and partition.
+func (c StreamCursor) String() string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	positions := make([]string, 0)
+	for _, name := range names {
+		for _, position := range strings.Split(c[name].String(), cursorPartitionSeparator) {
+			if position != "" {
+				positions = append(positions, name+cursorStreamSeparator+position)
+			}
+		}
+	}
+	return strings.Join(positions, cursorPartitionSeparator)
+}
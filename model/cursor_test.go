@@ -0,0 +1,96 @@
+package model
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseEmptyCursor(t *testing.T) {
+	Convey("When an empty cursor is parsed", t, func() {
+		actual, err := ParseCursor("")
+		Convey("Then no positions should be returned", func() {
+			So(err, ShouldBeNil)
+			So(actual, ShouldBeNil)
+		})
+	})
+}
+
+func TestParsePlainOffsetAsFirstPartition(t *testing.T) {
+	Convey("When a plain offset is parsed as a cursor", t, func() {
+		actual, err := ParseCursor("123")
+		Convey("Then the offset should be treated as a position within partition 0", func() {
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, Cursor{0: 123})
+		})
+	})
+}
+
+func TestParseMultiplePartitionCursor(t *testing.T) {
+	Convey("When a cursor spanning several partitions is parsed", t, func() {
+		actual, err := ParseCursor("0:123,2:45")
+		Convey("Then a position should be returned for each partition", func() {
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, Cursor{0: 123, 2: 45})
+		})
+	})
+}
+
+func TestReturnErrorIfCursorMalformed(t *testing.T) {
+	Convey("When malformed cursors are parsed", t, func() {
+		_, positionErr := ParseCursor("0:1:2")
+		_, partitionErr := ParseCursor("a:1")
+		_, offsetErr := ParseCursor("0:b")
+		Convey("Then an error should be returned", func() {
+			So(positionErr.Error(), ShouldEqual, "invalid cursor position: 0:1:2")
+			So(partitionErr.Error(), ShouldEqual, "invalid cursor partition: a")
+			So(offsetErr.Error(), ShouldEqual, "invalid cursor offset: b")
+		})
+	})
+}
+
+func TestFormatCursor(t *testing.T) {
+	Convey("When a cursor is formatted", t, func() {
+		actual := Cursor{2: 45, 0: 123}.String()
+		Convey("Then its positions should be listed in partition order", func() {
+			So(actual, ShouldEqual, "0:123,2:45")
+		})
+	})
+}
+
+func TestParseStreamCursor(t *testing.T) {
+	Convey("When a composite cursor spanning several streams is parsed", t, func() {
+		actual, err := ParseStreamCursor("filings.0:123,filings.1:45,persons-with-significant-control.0:6")
+		Convey("Then a cursor should be returned for each stream", func() {
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, StreamCursor{
+				"filings":                          Cursor{0: 123, 1: 45},
+				"persons-with-significant-control": Cursor{0: 6},
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfStreamCursorMalformed(t *testing.T) {
+	Convey("When malformed composite cursors are parsed", t, func() {
+		empty, emptyErr := ParseStreamCursor("")
+		_, nameErr := ParseStreamCursor("0:123")
+		_, plainErr := ParseStreamCursor("filings.123")
+		_, offsetErr := ParseStreamCursor("filings.0:b")
+		Convey("Then an error should be returned", func() {
+			So(emptyErr, ShouldBeNil)
+			So(empty, ShouldBeNil)
+			So(nameErr.Error(), ShouldEqual, "invalid cursor position: 0:123")
+			So(plainErr.Error(), ShouldEqual, "invalid cursor position: filings.123")
+			So(offsetErr.Error(), ShouldEqual, "invalid cursor offset: b")
+		})
+	})
+}
+
+func TestFormatStreamCursor(t *testing.T) {
+	Convey("When a composite cursor is formatted", t, func() {
+		actual := StreamCursor{"officers": Cursor{0: 7}, "filings": Cursor{2: 45, 0: 123}, "charges": Cursor{}}.String()
+		Convey("Then its positions should be listed in stream and partition order", func() {
+			So(actual, ShouldEqual, "filings.0:123,filings.2:45,officers.0:7")
+		})
+	})
+}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	resourceKindParam    = "resource_kind"
+	eventTypeParam       = "event_type"
+	companyNumberParam   = "company_number"
+	includeSkippedParam  = "include_skipped"
+	filterValueSeparator = ","
+	companyURISegment    = "company"
+	companyNumberField   = "company_number"
+)
+
+// The event types a user may filter a stream by.
+var eventTypes = map[string]bool{
+	"changed": true,
+	"deleted": true,
+}
+
+// Restricts the events streamed to a user to those matching every criterion the user has specified. Each criterion
+// matches an event if any of its values match, and a criterion with no values matches every event. Messages that
+// could not be transformed are only streamed, as skipped events, to users who have asked for them.
+type Filter struct {
+	ResourceKinds  map[string]bool
+	EventTypes     map[string]bool
+	CompanyNumbers map[string]bool
+	IncludeSkipped bool
+}
+
+// Parse a filter from the resource_kind, event_type, company_number and include_skipped query parameters. Each
+// criterion may be repeated or given as a comma separated list of values. Company numbers are matched case
+// insensitively.
+func ParseFilter(query url.Values) (*Filter, error) {
+	filter := &Filter{
+		ResourceKinds:  filterValues(query, resourceKindParam, strings.TrimSpace),
+		EventTypes:     filterValues(query, eventTypeParam, strings.TrimSpace),
+		CompanyNumbers: filterValues(query, companyNumberParam, strings.ToUpper),
+	}
+	for eventType := range filter.EventTypes {
+		if !eventTypes[eventType] {
+			return nil, fmt.Errorf("invalid event type: %s", eventType)
+		}
+	}
+	if input := query.Get(includeSkippedParam); input != "" {
+		includeSkipped, err := strconv.ParseBool(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include_skipped: %s", input)
+		}
+		filter.IncludeSkipped = includeSkipped
+	}
+	return filter, nil
+}
+
+// Return true if the resource should be streamed to the user.
+func (f *Filter) Matches(resource *json.ResourceChangedData) bool {
+	if f == nil || (len(f.ResourceKinds) == 0 && len(f.EventTypes) == 0 && len(f.CompanyNumbers) == 0) {
+		return true
+	}
+	if resource == nil {
+		return false
+	}
+	return matches(f.ResourceKinds, resource.ResourceKind) &&
+		matches(f.EventTypes, resource.Event.Type) &&
+		matches(f.CompanyNumbers, strings.ToUpper(CompanyNumber(resource)))
+}
+
+// Return the number of the company the resource belongs to, taken from the "/company/{company_number}" prefix of
+// its URI or failing that from the company_number field of its data. An empty string is returned if the resource
+// does not belong to a company.
+func CompanyNumber(resource *json.ResourceChangedData) string {
+	segments := strings.Split(strings.Trim(resource.ResourceURI, "/"), "/")
+	if len(segments) > 1 && segments[0] == companyURISegment {
+		return segments[1]
+	}
+	if companyNumber, ok := resource.Data[companyNumberField].(string); ok {
+		return companyNumber
+	}
+	return ""
+}
+
+func filterValues(query url.Values, param string, normalise func(string) string) map[string]bool {
+	values := make(map[string]bool)
+	for _, value := range query[param] {
+		for _, item := range strings.Split(value, filterValueSeparator) {
+			if item = normalise(strings.TrimSpace(item)); item != "" {
+				values[item] = true
+			}
+		}
+	}
+	return values
+}
+
+func matches(values map[string]bool, value string) bool {
+	return len(values) == 0 || values[value]
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/url"
+	"testing"
+)
+
+func TestParseFilterFromQueryParameters(t *testing.T) {
+	Convey("When a filter is parsed from repeated and comma separated query parameters", t, func() {
+		query, _ := url.ParseQuery("resource_kind=company-officers,company-profile&event_type=deleted&company_number=sc123456&company_number=00000001")
+		actual, err := ParseFilter(query)
+		Convey("Then each criterion should hold every value given", func() {
+			So(err, ShouldBeNil)
+			So(actual.ResourceKinds, ShouldResemble, map[string]bool{"company-officers": true, "company-profile": true})
+			So(actual.EventTypes, ShouldResemble, map[string]bool{"deleted": true})
+			So(actual.CompanyNumbers, ShouldResemble, map[string]bool{"SC123456": true, "00000001": true})
+		})
+	})
+}
+
+func TestReturnErrorIfEventTypeFilterInvalid(t *testing.T) {
+	Convey("When a filter on an unknown event type is parsed", t, func() {
+		query, _ := url.ParseQuery("event_type=changed,created")
+		actual, err := ParseFilter(query)
+		Convey("Then an error should be returned", func() {
+			So(actual, ShouldBeNil)
+			So(err.Error(), ShouldEqual, "invalid event type: created")
+		})
+	})
+}
+
+func TestParseIncludeSkippedFromQueryParameters(t *testing.T) {
+	Convey("When filters are parsed with and without the include_skipped parameter", t, func() {
+		included, _ := url.ParseQuery("include_skipped=true")
+		invalid, _ := url.ParseQuery("include_skipped=sometimes")
+		withSkipped, err := ParseFilter(included)
+		withoutSkipped, _ := ParseFilter(url.Values{})
+		_, invalidErr := ParseFilter(invalid)
+		Convey("Then skipped events should only be included when asked for", func() {
+			So(err, ShouldBeNil)
+			So(withSkipped.IncludeSkipped, ShouldBeTrue)
+			So(withoutSkipped.IncludeSkipped, ShouldBeFalse)
+			So(invalidErr.Error(), ShouldEqual, "invalid include_skipped: sometimes")
+		})
+	})
+}
+
+func TestEmptyFilterMatchesEveryEvent(t *testing.T) {
+	Convey("Given a filter without any criteria", t, func() {
+		filter, _ := ParseFilter(url.Values{})
+		Convey("Then every event should be matched", func() {
+			So(filter.Matches(&json.ResourceChangedData{ResourceKind: "company-profile"}), ShouldBeTrue)
+			So(filter.Matches(nil), ShouldBeTrue)
+		})
+	})
+}
+
+func TestFilterMatchesEventsMeetingEveryCriterion(t *testing.T) {
+	Convey("Given a filter on resource kind, event type and company number", t, func() {
+		query, _ := url.ParseQuery("resource_kind=company-officers&event_type=changed&company_number=sc123456")
+		filter, _ := ParseFilter(query)
+		matching := &json.ResourceChangedData{
+			ResourceKind: "company-officers",
+			ResourceURI:  "/company/SC123456/appointments/abc",
+			Event:        json.Event{Type: "changed"},
+		}
+		Convey("Then only events meeting every criterion should be matched", func() {
+			So(filter.Matches(matching), ShouldBeTrue)
+			So(filter.Matches(&json.ResourceChangedData{
+				ResourceKind: "company-profile",
+				ResourceURI:  "/company/SC123456",
+				Event:        json.Event{Type: "changed"},
+			}), ShouldBeFalse)
+			So(filter.Matches(&json.ResourceChangedData{
+				ResourceKind: "company-officers",
+				ResourceURI:  "/company/SC123456/appointments/abc",
+				Event:        json.Event{Type: "deleted"},
+			}), ShouldBeFalse)
+			So(filter.Matches(&json.ResourceChangedData{
+				ResourceKind: "company-officers",
+				ResourceURI:  "/company/00000001/appointments/abc",
+				Event:        json.Event{Type: "changed"},
+			}), ShouldBeFalse)
+			So(filter.Matches(nil), ShouldBeFalse)
+		})
+	})
+}
+
+func TestCompanyNumberOfResource(t *testing.T) {
+	Convey("When the company number of resources is requested", t, func() {
+		fromURI := CompanyNumber(&json.ResourceChangedData{ResourceURI: "/company/00000001/charges/xyz"})
+		fromData := CompanyNumber(&json.ResourceChangedData{
+			ResourceURI: "/disqualified-officers/natural/abc",
+			Data:        map[string]interface{}{"company_number": "00000002"},
+		})
+		none := CompanyNumber(&json.ResourceChangedData{ResourceURI: "/disqualified-officers/natural/abc"})
+		Convey("Then it should be taken from the resource URI or data", func() {
+			So(fromURI, ShouldEqual, "00000001")
+			So(fromData, ShouldEqual, "00000002")
+			So(none, ShouldEqual, "")
+		})
+	})
+}
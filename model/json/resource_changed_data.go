@@ -13,6 +13,83 @@ type ResourceChangedData struct {
 type Event struct {
 	FieldsChanged []string `json:"fields_changed,omitempty"`
 	Timepoint     int64    `json:"timepoint"`
+	Partition     int32    `json:"partition"`
 	PublishedAt   string   `json:"published_at"`
 	Type          string   `json:"type"`
 }
+
+// Body of the response returned to users requesting an offset that is not held on the topic, giving the range of
+// offsets they can resume from and, if several streams were requested, the stream concerned
+type OffsetOutOfRange struct {
+	Error          string `json:"error"`
+	Stream         string `json:"stream,omitempty"`
+	Partition      int32  `json:"partition"`
+	Offset         int64  `json:"offset"`
+	EarliestOffset int64  `json:"earliest_offset"`
+	LatestOffset   int64  `json:"latest_offset"`
+}
+
+// Body of the response returned to users requesting the messages produced since a time that has expired from the
+// topic, giving the earliest offset they can resume from and, if several streams were requested, the stream concerned
+type ExpiredTimestamp struct {
+	Error          string `json:"error"`
+	Stream         string `json:"stream,omitempty"`
+	Partition      int32  `json:"partition"`
+	Since          string `json:"since"`
+	EarliestOffset int64  `json:"earliest_offset"`
+}
+
+// Marker written at the end of a bounded stream, giving the reason the stream ended and the cursor to resume from
+type EndOfStream struct {
+	Reason     string `json:"reason"`
+	ResumeFrom string `json:"resume_from"`
+}
+
+// Keepalive record written to idle connections so that streaming API users can tell a quiet stream from a dead
+// connection and see how far the stream extends
+type Heartbeat struct {
+	HighWaterMarks map[int32]int64 `json:"high_water_marks"`
+}
+
+// Keepalive record written to idle connections to several streams, giving the high-water marks of each stream by name
+type StreamsHeartbeat struct {
+	HighWaterMarks map[string]map[int32]int64 `json:"high_water_marks"`
+}
+
+// Notice written to users who have fallen too far behind the stream that messages on a partition have been dropped
+type Gap struct {
+	Partition   int32 `json:"partition"`
+	FirstOffset int64 `json:"first_offset"`
+	LastOffset  int64 `json:"last_offset"`
+	Dropped     int   `json:"dropped"`
+}
+
+// Notice written to users who have asked to be told about messages that could not be transformed, so that they can
+// tell a deliberately skipped offset from a lost message
+type Skipped struct {
+	Partition int32 `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
+
+// Body of the response returned to users whose API key is missing, invalid or not entitled to the stream requested
+type AuthError struct {
+	Error  string `json:"error"`
+	Stream string `json:"stream,omitempty"`
+}
+
+// Body of the response returned to users who have exceeded a limit on their connections, giving the number of
+// seconds to wait before reconnecting
+type LimitExceeded struct {
+	Error      string `json:"error"`
+	Stream     string `json:"stream"`
+	RetryAfter int    `json:"retry_after"`
+}
+
+// The connections held open by a client, in total and to each stream, and the number it has opened within the last
+// minute
+type ClientUsage struct {
+	Identity         string         `json:"identity"`
+	Connections      int            `json:"connections"`
+	Streams          map[string]int `json:"streams"`
+	OpenedLastMinute int            `json:"opened_last_minute"`
+}
@@ -1,7 +1,30 @@
 package model
 
+import "github.com/companieshouse/chs-streaming-api-backend/model/json"
+
 // Encapsulates information about a new offset that has been consumed by Kafka
 type BackendEvent struct {
-	Data   []byte
-	Offset int64
+	Data      []byte
+	Offset    int64
+	Partition int32
+}
+
+// Encapsulates a transformed message, the resource it was serialised from and the partition and offset it was
+// consumed from. Messages that could not be transformed are marked as skipped and carry no data
+type StreamEvent struct {
+	Data      string
+	Resource  *json.ResourceChangedData
+	Offset    int64
+	Partition int32
+	Skipped   bool
+}
+
+// Encapsulates a message that could not be transformed, where it was consumed from and why it could not be
+// transformed
+type DeadLetter struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Data      []byte
+	Error     string
 }
@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	pb "github.com/companieshouse/chs-streaming-api-backend/streamingpb"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Return the filters of a call in the form of the query parameters taken by the HTTP streams, so that they are
+// validated and applied in the same way.
+func filterQuery(filters *pb.Filters) url.Values {
+	query := make(url.Values)
+	if filters == nil {
+		return query
+	}
+	if len(filters.ResourceKinds) > 0 {
+		query.Set("resource_kind", strings.Join(filters.ResourceKinds, ","))
+	}
+	if len(filters.EventTypes) > 0 {
+		query.Set("event_type", strings.Join(filters.EventTypes, ","))
+	}
+	if len(filters.CompanyNumbers) > 0 {
+		query.Set("company_number", strings.Join(filters.CompanyNumbers, ","))
+	}
+	if filters.IncludeSkipped {
+		query.Set("include_skipped", strconv.FormatBool(filters.IncludeSkipped))
+	}
+	return query
+}
+
+// Convert a transformed message to a response carrying the resource it was serialised from.
+func eventResponse(event *model.StreamEvent) (*pb.SubscribeResponse, error) {
+	resource, err := pb.NewResourceChangedData(event.Resource)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SubscribeResponse{
+		Payload: &pb.SubscribeResponse_Event{Event: &pb.ResourceEvent{
+			Partition: event.Partition,
+			Offset:    event.Offset,
+			Resource:  resource,
+		}},
+	}, nil
+}
+
+func skippedResponse(event *model.StreamEvent) *pb.SubscribeResponse {
+	return &pb.SubscribeResponse{
+		Payload: &pb.SubscribeResponse_Skipped{Skipped: &pb.Skipped{Partition: event.Partition, Offset: event.Offset}},
+	}
+}
+
+func gapResponse(stream string, gap *runner.Gap) *pb.SubscribeResponse {
+	return &pb.SubscribeResponse{
+		Stream: stream,
+		Payload: &pb.SubscribeResponse_Gap{Gap: &pb.Gap{
+			Partition:   gap.Partition,
+			FirstOffset: gap.FirstOffset,
+			LastOffset:  gap.LastOffset,
+			Dropped:     int32(gap.Dropped),
+		}},
+	}
+}
+
+func endResponse(stream string, resumeFrom model.Cursor, reason string) *pb.SubscribeResponse {
+	return &pb.SubscribeResponse{
+		Stream:     stream,
+		ResumeFrom: resumeFrom.String(),
+		Payload:    &pb.SubscribeResponse_EndOfStream{EndOfStream: &pb.EndOfStream{Reason: reason}},
+	}
+}
@@ -0,0 +1,312 @@
+// Package rpc serves the streams to internal services over gRPC, using the contract defined in the streamingpb
+// package, on a port separate to that of the HTTP streams.
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/auth"
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs-streaming-api-backend/limit"
+	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	pb "github.com/companieshouse/chs-streaming-api-backend/streamingpb"
+	"github.com/companieshouse/chs.go/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"math"
+	"net"
+	"time"
+)
+
+const (
+	authorizationMetadata  = "authorization"
+	endReasonServerClosing = "server_closing"
+	endReasonSlowConsumer  = "slow_consumer"
+	msgUserConnected       = "user connected"
+	msgUserDisconnected    = "user disconnected"
+	msgServerClosing       = "server closing"
+	msgSlowConsumer        = "user too far behind stream"
+	msgMessagesDropped     = "messages dropped"
+	msgMissingKey          = "API key missing"
+	msgInvalidKey          = "API key invalid"
+	msgNotEntitled         = "API key not entitled to stream"
+)
+
+// A stream that can be subscribed to over gRPC.
+type Subscribable interface {
+	Topic() string
+	StartConsumer(cursor model.Cursor) (runner.Controllable, error)
+	HighWaterMarks() (model.Cursor, error)
+}
+
+// Limits the connections each client may hold open and open within a minute.
+type Limitable interface {
+	Acquire(identity string, stream string) (string, time.Duration)
+	Release(identity string, stream string)
+}
+
+// Serves the Subscribe RPC of the Streaming service, streaming the events of each registered stream through the same
+// consumers as the HTTP streams.
+type Server struct {
+	pb.UnimplementedStreamingServer
+	server   *grpc.Server
+	address  string
+	certFile string
+	keyFile  string
+	streams  map[string]Subscribable
+	keys     auth.Authenticatable
+	limiter  Limitable
+	closing  <-chan struct{}
+	logger   logger.Logger
+}
+
+// Construct a new Server instance listening on the configured gRPC address.
+func NewServer(cfg *config.Config, logger logger.Logger) *Server {
+	server := &Server{
+		server:   grpc.NewServer(),
+		address:  cfg.GRPCBindAddress,
+		certFile: cfg.CertFile,
+		keyFile:  cfg.KeyFile,
+		streams:  make(map[string]Subscribable),
+		logger:   logger,
+	}
+	pb.RegisterStreamingServer(server.server, server)
+	return server
+}
+
+// Allow users to subscribe to the given stream by name.
+func (s *Server) WithStream(name string, stream Subscribable) *Server {
+	s.streams[name] = stream
+	return s
+}
+
+// Require calls to carry an API key entitled to the stream requested in their authorization metadata.
+func (s *Server) WithKeys(keys auth.Authenticatable) *Server {
+	s.keys = keys
+	return s
+}
+
+// Refuse calls from clients that already hold too many connections or have opened too many within the last minute.
+// Calls count towards the same limits as the HTTP connections of the client.
+func (s *Server) WithLimiter(limiter Limitable) *Server {
+	s.limiter = limiter
+	return s
+}
+
+// End every call, telling users where to resume each stream from, once the given channel is closed.
+func (s *Server) WithShutdown(closing <-chan struct{}) *Server {
+	s.closing = closing
+	return s
+}
+
+// Serve calls on the configured address until the server is shut down.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+	if s.certFile != "" && s.keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+		if err != nil {
+			_ = listener.Close()
+			return err
+		}
+		listener = tls.NewListener(listener, &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			NextProtos:   []string{"h2"},
+		})
+	}
+	return s.serve(listener)
+}
+
+// Stop accepting calls and wait for those in progress to end, forcing them to end if they have not done so before
+// the given context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// Stream the events of the requested stream to the user until they cancel the call, the server closes or they fall
+// too far behind the stream.
+func (s *Server) Subscribe(request *pb.SubscribeRequest, responses pb.Streaming_SubscribeServer) error {
+	ctx := responses.Context()
+	data := log.Data{"stream": request.Stream}
+	address := ""
+	if client, ok := peer.FromContext(ctx); ok {
+		address = client.Addr.String()
+		data["peer"] = address
+	}
+	stream, ok := s.streams[request.Stream]
+	if !ok {
+		return s.fail(codes.NotFound, fmt.Errorf("unknown stream: %s", request.Stream), data)
+	}
+	key, err := s.authenticate(ctx, request.Stream, data)
+	if err != nil {
+		return err
+	}
+	cursor, err := model.ParseCursor(request.StartOffset)
+	if err != nil {
+		return s.fail(codes.InvalidArgument, err, data)
+	}
+	filter, err := model.ParseFilter(filterQuery(request.Filters))
+	if err != nil {
+		return s.fail(codes.InvalidArgument, err, data)
+	}
+	if s.limiter != nil {
+		identity := limit.Identity(key, address)
+		if msg, retryAfter := s.limiter.Acquire(identity, request.Stream); msg != "" {
+			return s.exhausted(msg, retryAfter, data)
+		}
+		defer s.limiter.Release(identity, request.Stream)
+	}
+	// Partitions followed from the live head resume from their high-water mark, which is read before subscribing so
+	// that users resuming before any message has been delivered on a partition miss nothing produced meanwhile
+	highWaterMarks, err := stream.HighWaterMarks()
+	if err != nil {
+		return s.fail(codes.Internal, err, data)
+	}
+	controller, err := stream.StartConsumer(cursor)
+	if err != nil {
+		var outOfRange *runner.OffsetOutOfRangeError
+		if errors.As(err, &outOfRange) {
+			return s.fail(codes.OutOfRange, err, data)
+		}
+		return s.fail(codes.Internal, err, data)
+	}
+	s.logger.Info(msgUserConnected, data)
+	connections := metrics.Connections.WithLabelValues(stream.Topic())
+	connections.Inc()
+	defer connections.Dec()
+	published := metrics.MessagesPublished.WithLabelValues(stream.Topic())
+	resumeFrom := make(model.Cursor)
+	for partition, offset := range cursor {
+		resumeFrom[partition] = offset
+	}
+	for partition, offset := range highWaterMarks {
+		if start, ok := resumeFrom[partition]; !ok || start < 0 {
+			resumeFrom[partition] = offset
+		}
+	}
+	for {
+		select {
+		case event := <-controller.Data():
+			resumeFrom[event.Partition] = event.Offset + 1
+			var response *pb.SubscribeResponse
+			if event.Skipped {
+				if filter.IncludeSkipped {
+					response = skippedResponse(event)
+				}
+			} else if filter.Matches(event.Resource) {
+				if response, err = eventResponse(event); err != nil {
+					controller.Stop(msgUserDisconnected)
+					return s.fail(codes.Internal, err, data)
+				}
+			}
+			if response == nil {
+				continue
+			}
+			response.Stream = request.Stream
+			response.ResumeFrom = resumeFrom.String()
+			if err := responses.Send(response); err != nil {
+				controller.Stop(msgUserDisconnected)
+				s.logger.Info(msgUserDisconnected, data)
+				return err
+			}
+			if !event.Skipped {
+				published.Inc()
+			}
+		case gaps := <-controller.Gaps():
+			for _, gap := range gaps {
+				s.logger.Info(msgMessagesDropped, log.Data{"stream": request.Stream, "partition": gap.Partition, "dropped": gap.Dropped})
+				if err := responses.Send(gapResponse(request.Stream, gap)); err != nil {
+					controller.Stop(msgUserDisconnected)
+					s.logger.Info(msgUserDisconnected, data)
+					return err
+				}
+			}
+		case <-controller.Overflowed():
+			controller.Stop(msgSlowConsumer)
+			s.logger.Info(msgSlowConsumer, data)
+			return responses.Send(endResponse(request.Stream, resumeFrom, endReasonSlowConsumer))
+		case <-s.closing:
+			controller.Stop(msgServerClosing)
+			s.logger.Info(msgServerClosing, data)
+			return responses.Send(endResponse(request.Stream, resumeFrom, endReasonServerClosing))
+		case <-ctx.Done():
+			controller.Stop(msgUserDisconnected)
+			s.logger.Info(msgUserDisconnected, data)
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// Serve calls accepted by the given listener until the server is shut down.
+func (s *Server) serve(listener net.Listener) error {
+	if err := s.server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// Return the key the call carries, or an error if keys are required and the call does not carry a key entitled to the
+// named stream.
+func (s *Server) authenticate(ctx context.Context, stream string, data log.Data) (*auth.Key, error) {
+	if s.keys == nil {
+		return nil, nil
+	}
+	value := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(authorizationMetadata); len(values) > 0 {
+			value = auth.KeyFromAuthorization(values[0])
+		}
+	}
+	if value == "" {
+		return nil, s.fail(codes.Unauthenticated, errors.New(msgMissingKey), data)
+	}
+	key := s.keys.Lookup(value)
+	if key == nil {
+		return nil, s.fail(codes.Unauthenticated, errors.New(msgInvalidKey), data)
+	}
+	data["key_name"] = key.Name
+	if !key.Entitled(stream) {
+		return nil, s.fail(codes.PermissionDenied, errors.New(msgNotEntitled), data)
+	}
+	return key, nil
+}
+
+// Return a status refusing the call because the client has exceeded a limit, telling it when to retry in the details.
+func (s *Server) exhausted(msg string, retryAfter time.Duration, data log.Data) error {
+	retryAfter = time.Duration(math.Ceil(retryAfter.Seconds())) * time.Second
+	data["retry_after"] = int(retryAfter.Seconds())
+	s.logger.Info(msg, data)
+	refused := status.New(codes.ResourceExhausted, msg)
+	if detailed, err := refused.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+		refused = detailed
+	}
+	return refused.Err()
+}
+
+func (s *Server) fail(code codes.Code, err error, data log.Data) error {
+	s.logger.Error(err, data)
+	return status.Error(code, err.Error())
+}
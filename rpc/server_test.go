@@ -0,0 +1,397 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"github.com/companieshouse/chs-streaming-api-backend/auth"
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs-streaming-api-backend/limit"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	pb "github.com/companieshouse/chs-streaming-api-backend/streamingpb"
+	"github.com/companieshouse/chs.go/log"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const keyStoreDefinition = `
+keys:
+  - name: acme
+    key: acme-key
+    streams: [officers]
+`
+
+type mockStream struct {
+	mock.Mock
+}
+
+type mockController struct {
+	mock.Mock
+	data       chan *model.StreamEvent
+	gaps       chan []*runner.Gap
+	overflowed chan struct{}
+}
+
+type mockLogger struct {
+	mock.Mock
+}
+
+func newMockController() *mockController {
+	controller := &mockController{
+		data:       make(chan *model.StreamEvent),
+		gaps:       make(chan []*runner.Gap),
+		overflowed: make(chan struct{}),
+	}
+	controller.On("Stop", mock.Anything).Return()
+	return controller
+}
+
+func newMockLogger() *mockLogger {
+	logger := &mockLogger{}
+	logger.On("Info", mock.Anything, mock.Anything).Return()
+	logger.On("Error", mock.Anything, mock.Anything).Return()
+	return logger
+}
+
+// Serve the server over an in-memory listener, returning a client connected to it and a function that closes both.
+func connect(server *Server) (pb.StreamingClient, func()) {
+	listener := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = server.serve(listener)
+	}()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	So(err, ShouldBeNil)
+	return pb.NewStreamingClient(conn), func() {
+		_ = conn.Close()
+		server.server.Stop()
+	}
+}
+
+func subscribe(client pb.StreamingClient, ctx context.Context, request *pb.SubscribeRequest) pb.Streaming_SubscribeClient {
+	call, err := client.Subscribe(ctx, request)
+	So(err, ShouldBeNil)
+	return call
+}
+
+func receive(call pb.Streaming_SubscribeClient) (*pb.SubscribeResponse, error) {
+	received := make(chan *pb.SubscribeResponse, 1)
+	failed := make(chan error, 1)
+	go func() {
+		response, err := call.Recv()
+		if err != nil {
+			failed <- err
+			return
+		}
+		received <- response
+	}()
+	select {
+	case response := <-received:
+		return response, nil
+	case err := <-failed:
+		return nil, err
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("timed out waiting for response")
+	}
+}
+
+func TestCreateNewServer(t *testing.T) {
+	Convey("When a new server instance is constructed", t, func() {
+		logger := newMockLogger()
+		stream := &mockStream{}
+		keys := &auth.KeyStore{}
+		closing := make(chan struct{})
+		actual := NewServer(&config.Config{GRPCBindAddress: ":6001", CertFile: "cert", KeyFile: "key"}, logger).
+			WithStream("filings", stream).
+			WithKeys(keys).
+			WithShutdown(closing)
+		Convey("Then a new server instance should be returned", func() {
+			So(actual.server, ShouldNotBeNil)
+			So(actual.address, ShouldEqual, ":6001")
+			So(actual.certFile, ShouldEqual, "cert")
+			So(actual.keyFile, ShouldEqual, "key")
+			So(actual.streams["filings"], ShouldEqual, stream)
+			So(actual.keys, ShouldEqual, keys)
+			So(actual.closing, ShouldEqual, (<-chan struct{})(closing))
+			So(actual.logger, ShouldEqual, logger)
+		})
+	})
+}
+
+func TestSubscribeToStream(t *testing.T) {
+	Convey("Given a user has subscribed to a stream with filters from an offset", t, func() {
+		controller := newMockController()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", model.Cursor{0: 5}).Return(controller, nil)
+		server := NewServer(&config.Config{}, newMockLogger()).WithStream("filings", stream)
+		client, disconnect := connect(server)
+		defer disconnect()
+		call := subscribe(client, context.Background(), &pb.SubscribeRequest{
+			Stream:      "filings",
+			StartOffset: "0:5",
+			Filters:     &pb.Filters{ResourceKinds: []string{"filing-history"}, IncludeSkipped: true},
+		})
+		Convey("When messages are consumed from the stream", func() {
+			controller.data <- &model.StreamEvent{
+				Resource:  &rcd.ResourceChangedData{ResourceKind: "company-profile"},
+				Offset:    5,
+				Partition: 0,
+			}
+			controller.data <- &model.StreamEvent{
+				Resource: &rcd.ResourceChangedData{
+					ResourceKind: "filing-history",
+					ResourceURI:  "/company/00000001/filing-history/1",
+					ResourceID:   "1",
+					Data:         map[string]interface{}{"category": "accounts", "pages": float64(3)},
+					Event:        rcd.Event{FieldsChanged: []string{"category"}, Timepoint: 6, PublishedAt: "2021-01-01T00:00:00", Type: "changed"},
+				},
+				Offset:    6,
+				Partition: 0,
+			}
+			controller.data <- &model.StreamEvent{Offset: 7, Partition: 0, Skipped: true}
+			event, eventErr := receive(call)
+			skipped, skippedErr := receive(call)
+			Convey("Then matching events and skipped messages should be streamed with the cursor to resume from", func() {
+				So(eventErr, ShouldBeNil)
+				So(event.Stream, ShouldEqual, "filings")
+				So(event.ResumeFrom, ShouldEqual, "0:7")
+				So(event.GetEvent().Offset, ShouldEqual, 6)
+				resource := event.GetEvent().Resource
+				So(resource.ResourceKind, ShouldEqual, "filing-history")
+				So(resource.ResourceUri, ShouldEqual, "/company/00000001/filing-history/1")
+				So(resource.ResourceId, ShouldEqual, "1")
+				So(resource.Data.AsMap(), ShouldResemble, map[string]interface{}{"category": "accounts", "pages": float64(3)})
+				So(resource.Event.FieldsChanged, ShouldResemble, []string{"category"})
+				So(resource.Event.Timepoint, ShouldEqual, 6)
+				So(resource.Event.PublishedAt, ShouldEqual, "2021-01-01T00:00:00")
+				So(resource.Event.Type, ShouldEqual, "changed")
+				So(skippedErr, ShouldBeNil)
+				So(skipped.ResumeFrom, ShouldEqual, "0:8")
+				So(skipped.GetSkipped().Offset, ShouldEqual, 7)
+			})
+		})
+		Convey("When messages are dropped because the user has fallen behind the stream", func() {
+			controller.gaps <- []*runner.Gap{{Partition: 1, FirstOffset: 10, LastOffset: 14, Dropped: 5}}
+			response, err := receive(call)
+			Convey("Then the user should be told which messages were dropped", func() {
+				So(err, ShouldBeNil)
+				So(response.GetGap(), ShouldNotBeNil)
+				So(response.GetGap().Partition, ShouldEqual, 1)
+				So(response.GetGap().FirstOffset, ShouldEqual, 10)
+				So(response.GetGap().LastOffset, ShouldEqual, 14)
+				So(response.GetGap().Dropped, ShouldEqual, 5)
+			})
+		})
+		Convey("When the user falls too far behind the stream", func() {
+			close(controller.overflowed)
+			response, err := receive(call)
+			_, endErr := receive(call)
+			Convey("Then the stream should end telling the user where to resume from", func() {
+				So(err, ShouldBeNil)
+				So(response.GetEndOfStream().Reason, ShouldEqual, "slow_consumer")
+				So(response.ResumeFrom, ShouldEqual, "0:5")
+				So(endErr, ShouldNotBeNil)
+				controller.AssertCalled(t, "Stop", "user too far behind stream")
+			})
+		})
+	})
+}
+
+func TestEndSubscriptionsWhenServerCloses(t *testing.T) {
+	Convey("Given a user has subscribed to the live head of a stream with two partitions", t, func() {
+		controller := newMockController()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{0: 9, 2: 1}, nil)
+		stream.On("StartConsumer", model.Cursor(nil)).Return(controller, nil)
+		closing := make(chan struct{})
+		server := NewServer(&config.Config{}, newMockLogger()).WithStream("filings", stream).WithShutdown(closing)
+		client, disconnect := connect(server)
+		defer disconnect()
+		call := subscribe(client, context.Background(), &pb.SubscribeRequest{Stream: "filings"})
+		controller.data <- &model.StreamEvent{Resource: &rcd.ResourceChangedData{}, Offset: 3, Partition: 2}
+		_, _ = receive(call)
+		Convey("When the server is shut down", func() {
+			close(closing)
+			response, err := receive(call)
+			shutdownErr := server.Shutdown(context.Background())
+			Convey("Then the stream should end telling the user where to resume from, including the partition without messages", func() {
+				So(err, ShouldBeNil)
+				So(response.GetEndOfStream().Reason, ShouldEqual, "server_closing")
+				So(response.ResumeFrom, ShouldEqual, "0:9,2:4")
+				So(shutdownErr, ShouldBeNil)
+				controller.AssertCalled(t, "Stop", "server closing")
+			})
+		})
+	})
+}
+
+func TestStopConsumerWhenUserCancels(t *testing.T) {
+	Convey("Given a user has subscribed to a stream", t, func() {
+		controller := newMockController()
+		stopped := make(chan struct{})
+		controller.ExpectedCalls = nil
+		controller.On("Stop", "user disconnected").Run(func(mock.Arguments) { close(stopped) }).Return()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", model.Cursor(nil)).Return(controller, nil)
+		server := NewServer(&config.Config{}, newMockLogger()).WithStream("filings", stream)
+		client, disconnect := connect(server)
+		defer disconnect()
+		ctx, cancel := context.WithCancel(context.Background())
+		call := subscribe(client, ctx, &pb.SubscribeRequest{Stream: "filings"})
+		controller.data <- &model.StreamEvent{Resource: &rcd.ResourceChangedData{}, Offset: 0, Partition: 0}
+		_, _ = receive(call)
+		Convey("When the user cancels the call", func() {
+			cancel()
+			Convey("Then the consumer should be stopped", func() {
+				select {
+				case <-stopped:
+				case <-time.After(5 * time.Second):
+					t.Fatal("consumer not stopped")
+				}
+			})
+		})
+	})
+}
+
+func TestRefuseSubscriptionsBeyondClientLimits(t *testing.T) {
+	Convey("Given a user has subscribed to a stream on a server allowing each client one connection to a stream", t, func() {
+		keys, _ := auth.ParseKeyStore([]byte(keyStoreDefinition))
+		controller := newMockController()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", model.Cursor(nil)).Return(controller, nil)
+		logger := newMockLogger()
+		server := NewServer(&config.Config{}, logger).
+			WithStream("officers", stream).
+			WithKeys(keys).
+			WithLimiter(limit.NewLimiter(&config.Config{StreamConnLimit: 1}, logger))
+		client, disconnect := connect(server)
+		defer disconnect()
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "acme-key")
+		call := subscribe(client, ctx, &pb.SubscribeRequest{Stream: "officers"})
+		controller.data <- &model.StreamEvent{Resource: &rcd.ResourceChangedData{}, Offset: 0, Partition: 0}
+		_, _ = receive(call)
+		Convey("When the user subscribes to the stream again with the same key", func() {
+			_, err := receive(subscribe(client, ctx, &pb.SubscribeRequest{Stream: "officers"}))
+			refused := status.Convert(err)
+			Convey("Then the call should be refused telling the user when to retry", func() {
+				So(refused.Code(), ShouldEqual, codes.ResourceExhausted)
+				So(refused.Message(), ShouldEqual, "too many connections to stream")
+				So(refused.Details(), ShouldHaveLength, 1)
+				So(refused.Details()[0].(*errdetails.RetryInfo).RetryDelay.AsDuration(), ShouldEqual, 30*time.Second)
+				So(stream.AssertNumberOfCalls(t, "StartConsumer", 1), ShouldBeTrue)
+				logger.AssertCalled(t, "Info", "too many connections to stream", []log.Data{{"stream": "officers", "peer": "bufconn", "key_name": "acme", "retry_after": 30}})
+			})
+		})
+	})
+}
+
+func TestRejectInvalidSubscriptions(t *testing.T) {
+	Convey("Given a server requiring API keys", t, func() {
+		keys, _ := auth.ParseKeyStore([]byte(keyStoreDefinition))
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", model.Cursor{0: 100}).Return(&mockController{}, &runner.OffsetOutOfRangeError{Offset: 100, Earliest: 0, Latest: 10})
+		server := NewServer(&config.Config{}, newMockLogger()).
+			WithStream("filings", stream).
+			WithStream("officers", stream).
+			WithKeys(keys)
+		client, disconnect := connect(server)
+		defer disconnect()
+		failure := func(key string, request *pb.SubscribeRequest) *status.Status {
+			ctx := context.Background()
+			if key != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", key)
+			}
+			_, err := receive(subscribe(client, ctx, request))
+			return status.Convert(err)
+		}
+		Convey("When subscriptions are requested that cannot be served", func() {
+			unknown := failure("acme-key", &pb.SubscribeRequest{Stream: "charges"})
+			missing := failure("", &pb.SubscribeRequest{Stream: "officers"})
+			invalid := failure("unknown-key", &pb.SubscribeRequest{Stream: "officers"})
+			notEntitled := failure("acme-key", &pb.SubscribeRequest{Stream: "filings"})
+			badOffset := failure("acme-key", &pb.SubscribeRequest{Stream: "officers", StartOffset: "a:1"})
+			badFilter := failure("acme-key", &pb.SubscribeRequest{Stream: "officers", Filters: &pb.Filters{EventTypes: []string{"created"}}})
+			outOfRange := failure("acme-key", &pb.SubscribeRequest{Stream: "officers", StartOffset: "100"})
+			Convey("Then each should be rejected with a status explaining why", func() {
+				So(unknown.Code(), ShouldEqual, codes.NotFound)
+				So(unknown.Message(), ShouldEqual, "unknown stream: charges")
+				So(missing.Code(), ShouldEqual, codes.Unauthenticated)
+				So(missing.Message(), ShouldEqual, "API key missing")
+				So(invalid.Code(), ShouldEqual, codes.Unauthenticated)
+				So(invalid.Message(), ShouldEqual, "API key invalid")
+				So(notEntitled.Code(), ShouldEqual, codes.PermissionDenied)
+				So(notEntitled.Message(), ShouldEqual, "API key not entitled to stream")
+				So(badOffset.Code(), ShouldEqual, codes.InvalidArgument)
+				So(badOffset.Message(), ShouldEqual, "invalid cursor partition: a")
+				So(badFilter.Code(), ShouldEqual, codes.InvalidArgument)
+				So(badFilter.Message(), ShouldEqual, "invalid event type: created")
+				So(outOfRange.Code(), ShouldEqual, codes.OutOfRange)
+			})
+		})
+	})
+}
+
+func (s *mockStream) Topic() string {
+	return "topic"
+}
+
+func (s *mockStream) HighWaterMarks() (model.Cursor, error) {
+	args := s.Called()
+	return args.Get(0).(model.Cursor), args.Error(1)
+}
+
+func (s *mockStream) StartConsumer(cursor model.Cursor) (runner.Controllable, error) {
+	args := s.Called(cursor)
+	return args.Get(0).(runner.Controllable), args.Error(1)
+}
+
+func (c *mockController) Stop(msg string) {
+	c.Called(msg)
+}
+
+func (c *mockController) Data() <-chan *model.StreamEvent {
+	return c.data
+}
+
+func (c *mockController) Gaps() <-chan []*runner.Gap {
+	return c.gaps
+}
+
+func (c *mockController) Overflowed() <-chan struct{} {
+	return c.overflowed
+}
+
+func (l *mockLogger) Error(err error, data ...log.Data) {
+	l.Called(err, data)
+}
+
+func (l *mockLogger) Info(msg string, data ...log.Data) {
+	l.Called(msg, data)
+}
+
+func (l *mockLogger) InfoR(req *http.Request, msg string, data ...log.Data) {
+	l.Called(req, msg, data)
+}
+
+func (l *mockLogger) ErrorR(req *http.Request, err error, data ...log.Data) {
+	l.Called(req, err, data)
+}
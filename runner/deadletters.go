@@ -0,0 +1,41 @@
+package runner
+
+import (
+	backendconsumer "github.com/companieshouse/chs-streaming-api-backend/consumer"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"sync"
+)
+
+// Records each message that could not be transformed once, however many of the live and catch-up consumers of the
+// topic read it. Only the offsets of recorded messages are remembered, so its size grows with the number of dead
+// letters rather than with the number of messages consumed.
+type deadLetterLog struct {
+	sync.Mutex
+	sink     backendconsumer.Recordable
+	recorded map[int32]map[int64]bool
+}
+
+func newDeadLetterLog(sink backendconsumer.Recordable) *deadLetterLog {
+	return &deadLetterLog{
+		sink:     sink,
+		recorded: make(map[int32]map[int64]bool),
+	}
+}
+
+// Record the message unless it has already been recorded, in which case ErrAlreadyRecorded is returned. A message the
+// sink fails to record is retried the next time a consumer reads it.
+func (l *deadLetterLog) Record(letter *model.DeadLetter) error {
+	l.Lock()
+	defer l.Unlock()
+	if l.recorded[letter.Partition][letter.Offset] {
+		return backendconsumer.ErrAlreadyRecorded
+	}
+	if err := l.sink.Record(letter); err != nil {
+		return err
+	}
+	if l.recorded[letter.Partition] == nil {
+		l.recorded[letter.Partition] = make(map[int64]bool)
+	}
+	l.recorded[letter.Partition][letter.Offset] = true
+	return nil
+}
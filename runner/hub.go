@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"errors"
+	backendconsumer "github.com/companieshouse/chs-streaming-api-backend/consumer"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"sync"
+)
+
+// Consumes the live head of every partition of a topic once and fans each transformed message out to every
+// subscribed client.
+type hub struct {
+	sync.Mutex
+	live        map[int32]backendconsumer.Runnable
+	subscribers map[*ConsumerController]bool
+	heads       map[int32]int64
+}
+
+func newHub() *hub {
+	return &hub{
+		live:        make(map[int32]backendconsumer.Runnable),
+		subscribers: make(map[*ConsumerController]bool),
+		heads:       make(map[int32]int64),
+	}
+}
+
+// Start a live consumer for each of the given partitions that is not already being consumed, and seed the head of the
+// partition with the offset preceding its high-water mark, so that clients catching up on a partition no message has
+// been consumed from yet can still be merged into the live feed. The high-water mark is read once the consumer has
+// started, so that no message is produced between the head and the offset the consumer starts from. If a consumer
+// fails to start, those started by this call are shut down before the error is returned.
+func (h *hub) start(partitions []int32, constructor func(partition int32) backendconsumer.Runnable, highWaterMark func(partition int32) (int64, error)) error {
+	h.Lock()
+	started := make(map[int32]backendconsumer.Runnable)
+	var err error
+	for _, partition := range partitions {
+		if h.live[partition] != nil {
+			continue
+		}
+		live := constructor(partition)
+		go live.Run()
+		if !live.HasStarted() {
+			err = errors.New(msgFailedToStart)
+			break
+		}
+		started[partition] = live
+		var offset int64
+		if offset, err = highWaterMark(partition); err != nil {
+			break
+		}
+		h.live[partition] = live
+		h.advance(partition, offset-1)
+	}
+	if err != nil {
+		for partition := range started {
+			delete(h.live, partition)
+		}
+	}
+	h.Unlock()
+	if err != nil {
+		// Shut down outside the lock, as the consumers may be waiting for it to publish a message
+		stopAll(started, msgFailedToStart)
+	}
+	return err
+}
+
+// Shut down every live consumer and wait for them to close.
+func (h *hub) shutdown(msg string) {
+	h.Lock()
+	live := h.live
+	h.live = make(map[int32]backendconsumer.Runnable)
+	h.Unlock()
+	stopAll(live, msg)
+}
+
+// Subscribe a client to the live feed. Partitions the client wants to resume from beyond the live head are followed
+// live straight away, as there is nothing for them to catch up on.
+func (h *hub) subscribe(controller *ConsumerController) {
+	h.Lock()
+	defer h.Unlock()
+	for partition, position := range controller.positions {
+		if head, ok := h.heads[partition]; ok && !position.live && position.lastOffset >= head {
+			position.live = true
+		}
+	}
+	h.subscribers[controller] = true
+}
+
+func (h *hub) unsubscribe(controller *ConsumerController) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.subscribers, controller)
+}
+
+// Publish a message consumed from the live head of a partition to every client that has caught up with it. Messages
+// are delivered outside the hub lock, so that a client that is slow to take them holds up neither the clients
+// subscribing and unsubscribing meanwhile nor those catching up.
+func (h *hub) Publish(event *model.StreamEvent) {
+	h.Lock()
+	h.advance(event.Partition, event.Offset)
+	subscribers := make([]*ConsumerController, 0, len(h.subscribers))
+	for controller := range h.subscribers {
+		subscribers = append(subscribers, controller)
+	}
+	h.Unlock()
+	for _, controller := range subscribers {
+		controller.publishLive(event)
+	}
+}
+
+// Return the offset of the last message consumed from the live head of the partition, and false if none has been.
+func (h *hub) head(partition int32) (int64, bool) {
+	h.Lock()
+	defer h.Unlock()
+	head, ok := h.heads[partition]
+	return head, ok
+}
+
+// Return the offset following the last message consumed from the live head of the partition, and false if the
+// partition is not being consumed.
+func (h *hub) highWaterMark(partition int32) (int64, bool) {
+	h.Lock()
+	defer h.Unlock()
+	if h.live[partition] == nil {
+		return 0, false
+	}
+	return h.heads[partition] + 1, true
+}
+
+// Move the head of a partition forward to the given offset. The head never moves back, as the high-water mark it is
+// seeded with may be ahead of the messages the live consumer has yet to publish. Must be called while holding the hub
+// lock.
+func (h *hub) advance(partition int32, offset int64) {
+	if head, ok := h.heads[partition]; !ok || offset > head {
+		h.heads[partition] = offset
+	}
+}
+
+// Shut down the given consumers concurrently and wait for them all to close.
+func stopAll(consumers map[int32]backendconsumer.Runnable, msg string) {
+	var wg sync.WaitGroup
+	for _, consumer := range consumers {
+		wg.Add(1)
+		go func(consumer backendconsumer.Runnable) {
+			defer wg.Done()
+			consumer.Shutdown(msg)
+		}(consumer)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+)
+
+// The number of messages queued for a client when no buffer size has been configured.
+const defaultBufferSize = 100
+
+// What happens to a message published to a client whose queue is full.
+type OverflowPolicy string
+
+const (
+	// Wait for the client to make room in its queue, holding up the live feed of the topic until it does.
+	OverflowBlock OverflowPolicy = "block"
+	// Drop the oldest message in the client's queue to make room and tell the client about the gap.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// Disconnect the client, telling it where to resume from.
+	OverflowDisconnect OverflowPolicy = "disconnect"
+)
+
+// Parse an overflow policy from its name.
+func ParseOverflowPolicy(input string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(input); policy {
+	case OverflowBlock, OverflowDropOldest, OverflowDisconnect:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid overflow policy: %s", input)
+}
+
+// A run of consecutive messages on a partition that were dropped rather than delivered to a client that could not
+// keep up with the stream.
+type Gap struct {
+	Partition   int32
+	FirstOffset int64
+	LastOffset  int64
+	Dropped     int
+}
+
+// Deliver a message to a client whose queue is full according to the client's overflow policy. Must be called while
+// holding the client's lock, which guarantees that no other message is queued for the client meanwhile.
+func (c *ConsumerController) overflow(event *model.StreamEvent, position *position) {
+	metrics.Overflows.WithLabelValues(c.topic, string(c.policy)).Inc()
+	switch c.policy {
+	case OverflowDropOldest:
+		select {
+		case dropped := <-c.data:
+			c.recordGap(dropped)
+		default:
+			// The client has emptied its queue in the meantime
+		}
+		c.data <- event
+		position.lastOffset = event.Offset
+	case OverflowDisconnect:
+		c.overflowed = true
+		close(c.disconnect)
+	default:
+		select {
+		case c.data <- event:
+			position.lastOffset = event.Offset
+		case <-c.done:
+		}
+	}
+}
+
+// Add a dropped message to the gaps the client has yet to be told about, extending the gap on its partition if the
+// message directly follows it.
+func (c *ConsumerController) recordGap(dropped *model.StreamEvent) {
+	var gaps []*Gap
+	select {
+	case gaps = <-c.gaps:
+	default:
+	}
+	extended := false
+	for _, gap := range gaps {
+		if gap.Partition == dropped.Partition && gap.LastOffset+1 == dropped.Offset {
+			gap.LastOffset = dropped.Offset
+			gap.Dropped++
+			extended = true
+		}
+	}
+	if !extended {
+		gaps = append(gaps, &Gap{
+			Partition:   dropped.Partition,
+			FirstOffset: dropped.Offset,
+			LastOffset:  dropped.Offset,
+			Dropped:     1,
+		})
+	}
+	c.gaps <- gaps
+}
@@ -2,43 +2,128 @@ package runner
 
 import (
 	"errors"
+	"fmt"
+	"github.com/Shopify/sarama"
 	backendconsumer "github.com/companieshouse/chs-streaming-api-backend/consumer"
 	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
 	"github.com/companieshouse/chs-streaming-api-backend/transformer"
 	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
-	"github.com/companieshouse/chs.go/avro"
 	"github.com/companieshouse/chs.go/kafka/consumer"
+	"sync"
+	"time"
+)
+
+const (
+	liveOffset       int64 = -1
+	unknownOffset    int64 = -1
+	msgCaughtUp            = "caught up with live feed"
+	msgFailedToStart       = "failed to start consumer"
 )
 
 type Config struct {
-	KafkaBroker []string
-	Topic       string
-	Schema      *avro.Schema
-	Broker      backendconsumer.Publishable
+	KafkaBroker    []string
+	Topic          string
+	Schema         transformer.Schemable
+	Registry       transformer.SchemaFetchable
+	Broker         backendconsumer.Publishable
+	DeadLetters    backendconsumer.Recordable
+	BufferSize     int
+	OverflowPolicy OverflowPolicy
 }
 
 type Runner struct {
 	kafkaBrokerAddr []string
 	topic           string
-	schema          *avro.Schema
+	schema          transformer.Schemable
+	deserialiser    transformer.Unmarshallable
 	broker          backendconsumer.Publishable
+	deadLetters     backendconsumer.Recordable
 	offset          int64
-	partition       int32
-	constructor     func(backendconsumer.KafkaPartitionConsumable, backendconsumer.Transformable, backendconsumer.Publishable, int32, int64, logger.Logger) backendconsumer.Runnable
+	bufferSize      int
+	overflowPolicy  OverflowPolicy
+	constructor     func(backendconsumer.KafkaPartitionConsumable, backendconsumer.Transformable, backendconsumer.Publishable, backendconsumer.Recordable, int32, int64, logger.Logger) backendconsumer.Runnable
+	clientFactory   func(brokerAddr []string) (Inspectable, error)
+	client          Inspectable
+	clientLock      sync.Mutex
+	hub             *hub
+}
+
+// Describes an object capable of inspecting the partitions and offsets of a Kafka topic.
+type Inspectable interface {
+	RefreshMetadata(topics ...string) error
+	Partitions(topic string) ([]int32, error)
+	GetOffset(topic string, partition int32, time int64) (int64, error)
 }
 
-type publisher struct {
-	data chan string
+// Publishes messages read by a catch-up consumer to a single client until it reaches the live head of the partition.
+type catchUpPublisher struct {
+	hub        *hub
+	controller *ConsumerController
+	partition  int32
 }
 
+// Controls the subscription of a single client to the messages published on a topic. Messages are queued for the
+// client up to the size of its buffer, beyond which its overflow policy applies.
 type ConsumerController struct {
-	runtime backendconsumer.Runnable
-	data    chan string
+	// Held while a message is delivered to the client, so that messages are queued for it one at a time
+	lock       sync.Mutex
+	hub        *hub
+	topic      string
+	data       chan *model.StreamEvent
+	done       chan struct{}
+	policy     OverflowPolicy
+	gaps       chan []*Gap
+	disconnect chan struct{}
+	overflowed bool
+	positions  map[int32]*position
+	stopOnce   sync.Once
+}
+
+// The position a client has reached within a single partition of the topic.
+type position struct {
+	live       bool
+	lastOffset int64
+	catchUp    backendconsumer.Runnable
+	catchUpEnd sync.Once
 }
 
 type Controllable interface {
 	Stop(msg string)
-	Data() <-chan string
+	Data() <-chan *model.StreamEvent
+	Gaps() <-chan []*Gap
+	Overflowed() <-chan struct{}
+}
+
+// Returned when a user requests an offset that is not held on a partition, either because it has expired from the
+// topic or because it has not yet been produced.
+type OffsetOutOfRangeError struct {
+	Partition int32
+	Offset    int64
+	Earliest  int64
+	Latest    int64
+}
+
+func (e *OffsetOutOfRangeError) Error() string {
+	return fmt.Sprintf("offset %d is outside the range %d to %d held on partition %d", e.Offset, e.Earliest, e.Latest, e.Partition)
+}
+
+// Return true if the requested offset has expired from the topic rather than not yet having been produced.
+func (e *OffsetOutOfRangeError) Expired() bool {
+	return e.Offset < e.Earliest
+}
+
+// Returned when a user requests the messages produced since a time that the messages retained on a partition cannot
+// be guaranteed to go back to.
+type ExpiredTimestampError struct {
+	Partition int32
+	Since     time.Time
+	Earliest  int64
+}
+
+func (e *ExpiredTimestampError) Error() string {
+	return fmt.Sprintf("messages produced since %s have expired from partition %d, the earliest offset held is %d", e.Since.Format(time.RFC3339), e.Partition, e.Earliest)
 }
 
 func NewFactory(cfg *Config) *Runner {
@@ -46,43 +131,370 @@ func NewFactory(cfg *Config) *Runner {
 		kafkaBrokerAddr: cfg.KafkaBroker,
 		topic:           cfg.Topic,
 		schema:          cfg.Schema,
+		deserialiser:    cfg.Schema,
 		broker:          cfg.Broker,
+		bufferSize:      cfg.BufferSize,
+		overflowPolicy:  cfg.OverflowPolicy,
 		constructor:     backendconsumer.NewConsumer,
+		clientFactory:   newClient,
+		hub:             newHub(),
+	}
+	if factory.bufferSize <= 0 {
+		factory.bufferSize = defaultBufferSize
+	}
+	if factory.overflowPolicy == "" {
+		factory.overflowPolicy = OverflowDropOldest
+	}
+	if cfg.DeadLetters != nil {
+		factory.deadLetters = newDeadLetterLog(cfg.DeadLetters)
+	}
+	if cfg.Registry != nil {
+		factory.deserialiser = transformer.NewWireFormatDeserialiser(cfg.Registry, cfg.Schema)
 	}
 	return factory
 }
 
-func (f *Runner) StartConsumer(offset int64) (Controllable, error) {
-	data := make(chan string)
-	publisher := &publisher{data}
-	backendConsumer := f.constructor(
+// Subscribe a client to every partition of the topic. Partitions absent from the cursor are attached directly to the
+// shared live feed, as are those the client wants to resume from beyond the live head; partitions the client wants to
+// resume from an older offset are served by their own catch-up consumer until it reaches the live head, at which point
+// they are merged into the shared feed.
+func (f *Runner) StartConsumer(cursor model.Cursor) (Controllable, error) {
+	client, err := f.inspector()
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := client.Partitions(f.topic)
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[int32]*position)
+	for _, partition := range partitions {
+		positions[partition] = &position{live: true, lastOffset: -1}
+	}
+	for partition, offset := range cursor {
+		if positions[partition] == nil {
+			return nil, fmt.Errorf("partition %d does not exist on topic %s", partition, f.topic)
+		}
+		if offset != liveOffset {
+			if err := f.checkOffset(client, partition, offset); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := f.hub.start(partitions, func(partition int32) backendconsumer.Runnable {
+		return f.newConsumer(f.hub, f.deadLetters, partition, liveOffset)
+	}, func(partition int32) (int64, error) {
+		return client.GetOffset(f.topic, partition, sarama.OffsetNewest)
+	}); err != nil {
+		metrics.KafkaErrors.WithLabelValues(f.topic).Inc()
+		return nil, err
+	}
+	controller := &ConsumerController{
+		hub:        f.hub,
+		topic:      f.topic,
+		data:       make(chan *model.StreamEvent, f.bufferSize),
+		done:       make(chan struct{}),
+		policy:     f.overflowPolicy,
+		gaps:       make(chan []*Gap, 1),
+		disconnect: make(chan struct{}),
+		positions:  positions,
+	}
+	for partition, offset := range cursor {
+		if offset != liveOffset {
+			positions[partition].live = false
+			positions[partition].lastOffset = offset - 1
+		}
+	}
+	f.hub.subscribe(controller)
+	// Messages published on partitions created since are now followed, so the positions are no longer only the
+	// runner's to read
+	positions = controller.followed()
+	for partition, position := range positions {
+		if position.live {
+			continue
+		}
+		position.catchUp = f.newConsumer(&catchUpPublisher{
+			hub:        f.hub,
+			controller: controller,
+			partition:  partition,
+		}, f.deadLetters, partition, position.lastOffset+1)
+	}
+	// Every catch-up consumer is run before any is checked, so that stopping the client after one fails to start
+	// shuts down only consumers that have been run
+	for _, position := range positions {
+		if position.catchUp != nil {
+			go position.catchUp.Run()
+		}
+	}
+	for _, position := range positions {
+		if position.catchUp == nil {
+			continue
+		}
+		if !position.catchUp.HasStarted() {
+			metrics.KafkaErrors.WithLabelValues(f.topic).Inc()
+			position.catchUpEnd.Do(func() {})
+			controller.Stop(msgFailedToStart)
+			return nil, errors.New(msgFailedToStart)
+		}
+		metrics.CatchUpConsumers.WithLabelValues(f.topic).Inc()
+	}
+	return controller, nil
+}
+
+// Check that the topic can be consumed by refreshing its metadata from the Kafka brokers. An error is returned if no
+// broker can be reached or the topic has no partitions.
+func (f *Runner) CheckBrokers() error {
+	client, err := f.inspector()
+	if err != nil {
+		return err
+	}
+	if err := client.RefreshMetadata(f.topic); err != nil {
+		return err
+	}
+	partitions, err := client.Partitions(f.topic)
+	if err != nil {
+		return err
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic %s has no partitions", f.topic)
+	}
+	return nil
+}
+
+// Shut down the live consumers of the topic, waiting for them to close. Catch-up consumers are shut down as their
+// clients unsubscribe.
+func (f *Runner) Shutdown(msg string) {
+	f.hub.shutdown(msg)
+}
+
+// Return the topic the runner consumes.
+func (f *Runner) Topic() string {
+	return f.topic
+}
+
+// Return the high-water mark of each partition of the topic, i.e. the offset the next message produced to it will
+// be assigned. The high-water marks of partitions being consumed from the live head are taken from the last message
+// consumed, so that heartbeats written to every connection cost no round trip to Kafka; those of other partitions are
+// retrieved from Kafka.
+func (f *Runner) HighWaterMarks() (model.Cursor, error) {
+	client, err := f.inspector()
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := client.Partitions(f.topic)
+	if err != nil {
+		return nil, err
+	}
+	highWaterMarks := make(model.Cursor)
+	for _, partition := range partitions {
+		if offset, ok := f.hub.highWaterMark(partition); ok {
+			highWaterMarks[partition] = offset
+			continue
+		}
+		offset, err := client.GetOffset(f.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		highWaterMarks[partition] = offset
+	}
+	return highWaterMarks, nil
+}
+
+// Return the offset of the first message produced at or after the given time on each partition of the topic. Partitions
+// without such a message are positioned at their high-water mark. An error is returned if the first message found on
+// a partition is the earliest it retains, as earlier messages that were also produced after the time may have expired.
+func (f *Runner) OffsetsAt(since time.Time) (model.Cursor, error) {
+	return f.offsetsAt(since, true)
+}
+
+// Return the offset of the first message produced at or after the given time on each partition of the topic, which
+// bounds the messages produced before it. Partitions without such a message are bounded by their high-water mark.
+// Unlike OffsetsAt, no error is returned if messages before the time have expired, as there is then nothing to replay.
+func (f *Runner) OffsetsBefore(until time.Time) (model.Cursor, error) {
+	return f.offsetsAt(until, false)
+}
+
+func (f *Runner) offsetsAt(at time.Time, checkRetention bool) (model.Cursor, error) {
+	client, err := f.inspector()
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := client.Partitions(f.topic)
+	if err != nil {
+		return nil, err
+	}
+	cursor := make(model.Cursor)
+	for _, partition := range partitions {
+		offset, err := client.GetOffset(f.topic, partition, at.UnixMilli())
+		if err != nil {
+			return nil, err
+		}
+		if offset == unknownOffset {
+			if offset, err = client.GetOffset(f.topic, partition, sarama.OffsetNewest); err != nil {
+				return nil, err
+			}
+		} else if checkRetention {
+			earliest, err := client.GetOffset(f.topic, partition, sarama.OffsetOldest)
+			if err != nil {
+				return nil, err
+			}
+			if offset == earliest && earliest > 0 {
+				return nil, &ExpiredTimestampError{Partition: partition, Since: at, Earliest: earliest}
+			}
+		}
+		cursor[partition] = offset
+	}
+	return cursor, nil
+}
+
+// Check that the offset is held on the partition, i.e. that it lies between the earliest offset retained on the
+// partition and its high-water mark. Resuming from the high-water mark waits for the next message to be produced.
+func (f *Runner) checkOffset(client Inspectable, partition int32, offset int64) error {
+	earliest, err := client.GetOffset(f.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return err
+	}
+	latest, err := client.GetOffset(f.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return err
+	}
+	if offset < earliest || offset > latest {
+		return &OffsetOutOfRangeError{Partition: partition, Offset: offset, Earliest: earliest, Latest: latest}
+	}
+	return nil
+}
+
+func (f *Runner) newConsumer(publisher backendconsumer.Publishable, deadLetters backendconsumer.Recordable, partition int32, offset int64) backendconsumer.Runnable {
+	return f.constructor(
 		consumer.NewPartitionConsumer(&consumer.Config{
 			BrokerAddr: f.kafkaBrokerAddr,
 			Topics:     []string{f.topic},
 		}),
 		transformer.NewResourceChangedDataTransformer(
-			transformer.NewDeserialiser(f.schema, jsonproducer.Instance()),
+			transformer.NewDeserialiser(f.deserialiser, jsonproducer.Instance()),
 			transformer.NewSerialiser(jsonproducer.Instance(), jsonproducer.Instance())),
 		publisher,
-		f.partition,
+		deadLetters,
+		partition,
 		offset,
 		logger.NewLogger())
-	go backendConsumer.Run()
-	if !backendConsumer.HasStarted() {
-		return nil, errors.New("failed to start consumer")
+}
+
+// Return the client used to inspect the topic, connecting to Kafka if this has not already been done.
+func (f *Runner) inspector() (Inspectable, error) {
+	f.clientLock.Lock()
+	defer f.clientLock.Unlock()
+	if f.client == nil {
+		client, err := f.clientFactory(f.kafkaBrokerAddr)
+		if err != nil {
+			return nil, err
+		}
+		f.client = client
 	}
-	return &ConsumerController{backendConsumer, data}, nil
+	return f.client, nil
+}
+
+func newClient(brokerAddr []string) (Inspectable, error) {
+	config := sarama.NewConfig()
+	// Offsets can only be looked up by message timestamp from this version onwards
+	config.Version = sarama.V0_10_1_0
+	return sarama.NewClient(brokerAddr, config)
 }
 
+// Unsubscribe the client from the topic and shut down any catch-up consumers that are still running.
 func (c *ConsumerController) Stop(msg string) {
-	c.runtime.Shutdown(msg)
-	close(c.data)
+	c.stopOnce.Do(func() {
+		close(c.done)
+		c.hub.unsubscribe(c)
+		for _, position := range c.followed() {
+			position.stopCatchUp(msg)
+		}
+	})
 }
 
-func (c *ConsumerController) Data() <-chan string {
+func (c *ConsumerController) Data() <-chan *model.StreamEvent {
 	return c.data
 }
 
-func (n *publisher) Publish(msg string) {
-	n.data <- msg
+// Return a channel receiving the messages dropped since the client was last told about them, if its overflow policy
+// is to drop the oldest message queued for it.
+func (c *ConsumerController) Gaps() <-chan []*Gap {
+	return c.gaps
+}
+
+// Return a channel that is closed once the client has fallen too far behind the stream, if its overflow policy is
+// to disconnect it.
+func (c *ConsumerController) Overflowed() <-chan struct{} {
+	return c.disconnect
+}
+
+// Return a copy of the positions the client has reached within each partition it follows.
+func (c *ConsumerController) followed() map[int32]*position {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	positions := make(map[int32]*position, len(c.positions))
+	for partition, position := range c.positions {
+		positions[partition] = position
+	}
+	return positions
+}
+
+// Return the position the client has reached within the given partition. Partitions created after the client
+// subscribed are followed from the live head. Must be called while holding the client's lock.
+func (c *ConsumerController) position(partition int32) *position {
+	if c.positions[partition] == nil {
+		c.positions[partition] = &position{live: true, lastOffset: -1}
+	}
+	return c.positions[partition]
+}
+
+// Queue a message for the client unless it has already been delivered or the client has disconnected. The overflow
+// policy of the client applies if its queue is full. Must be called while holding the client's lock.
+func (c *ConsumerController) deliver(event *model.StreamEvent) {
+	position := c.position(event.Partition)
+	if event.Offset <= position.lastOffset || c.overflowed {
+		return
+	}
+	select {
+	case c.data <- event:
+		position.lastOffset = event.Offset
+	case <-c.done:
+		return
+	default:
+		c.overflow(event, position)
+	}
+	metrics.QueueDepth.WithLabelValues(c.topic).Observe(float64(len(c.data)))
+}
+
+func (p *position) stopCatchUp(msg string) {
+	p.catchUpEnd.Do(func() {
+		if p.catchUp != nil {
+			p.catchUp.Shutdown(msg)
+		}
+	})
+}
+
+// Deliver a message consumed from the live head of a partition if the client is following the partition live.
+func (c *ConsumerController) publishLive(event *model.StreamEvent) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.position(event.Partition).live {
+		c.deliver(event)
+	}
+}
+
+func (p *catchUpPublisher) Publish(event *model.StreamEvent) {
+	p.controller.lock.Lock()
+	defer p.controller.lock.Unlock()
+	position := p.controller.position(p.partition)
+	if position.live {
+		return
+	}
+	p.controller.deliver(event)
+	// The live head is read while holding the client's lock, so that any message consumed from the live head after it
+	// is delivered to the client once it has switched to the live feed
+	if head, ok := p.hub.head(p.partition); ok && event.Offset >= head {
+		position.live = true
+		go position.stopCatchUp(msgCaughtUp)
+	}
 }
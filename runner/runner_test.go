@@ -1,22 +1,46 @@
 package runner
 
 import (
+	"errors"
+	"github.com/Shopify/sarama"
 	"github.com/companieshouse/chs-streaming-api-backend/consumer"
 	"github.com/companieshouse/chs-streaming-api-backend/logger"
-	"github.com/companieshouse/chs.go/avro"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"github.com/companieshouse/chs-streaming-api-backend/schemaregistry"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/mock"
 	"testing"
+	"time"
 )
 
 type mockRunnable struct {
 	mock.Mock
-	done chan bool
+	done     chan bool
+	shutdown chan string
+}
+
+type mockConstructor struct {
+	runnables   []consumer.Runnable
+	publishers  []consumer.Publishable
+	deadLetters []consumer.Recordable
+	partitions  []int32
+	offsets     []int64
+}
+
+type mockInspector struct {
+	mock.Mock
+}
+
+type mockDeadLetters struct {
+	mock.Mock
 }
 
 func TestCreateNewFactoryInstance(t *testing.T) {
 	Convey("Given a configuration object with all fields specified", t, func() {
-		config := &Config{KafkaBroker: []string{"0.0.0.0"}, Topic: "topic", Schema: &avro.Schema{}}
+		config := &Config{KafkaBroker: []string{"0.0.0.0"}, Topic: "topic", Schema: schemaregistry.NewSchema("")}
 		Convey("When a new runner instance is created", func() {
 			actual := NewFactory(config)
 			Convey("Then a new runner instance should be returned", func() {
@@ -24,28 +48,277 @@ func TestCreateNewFactoryInstance(t *testing.T) {
 				So(actual.kafkaBrokerAddr, ShouldResemble, config.KafkaBroker)
 				So(actual.topic, ShouldEqual, config.Topic)
 				So(actual.schema, ShouldEqual, config.Schema)
+				So(actual.clientFactory, ShouldNotBeNil)
+				So(actual.hub, ShouldNotBeNil)
+				So(actual.bufferSize, ShouldEqual, 100)
+				So(actual.overflowPolicy, ShouldEqual, OverflowDropOldest)
+				So(actual.deserialiser, ShouldEqual, config.Schema)
+			})
+		})
+	})
+	Convey("Given a configuration object specifying a schema registry", t, func() {
+		config := &Config{Topic: "topic", Schema: schemaregistry.NewSchema(""), Registry: schemaregistry.NewClient("http://schema-registry")}
+		Convey("When a new runner instance is created", func() {
+			actual := NewFactory(config)
+			Convey("Then messages should be resolved from the schema they were written with", func() {
+				So(actual.deserialiser, ShouldHaveSameTypeAs, &transformer.WireFormatDeserialiser{})
+			})
+		})
+	})
+	Convey("Given a configuration object specifying a buffer size and overflow policy", t, func() {
+		config := &Config{Topic: "topic", BufferSize: 10, OverflowPolicy: OverflowDisconnect}
+		Convey("When a new runner instance is created", func() {
+			actual := NewFactory(config)
+			Convey("Then the buffer size and overflow policy should be applied", func() {
+				So(actual.bufferSize, ShouldEqual, 10)
+				So(actual.overflowPolicy, ShouldEqual, OverflowDisconnect)
+			})
+		})
+	})
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	Convey("When overflow policies are parsed", t, func() {
+		dropOldest, err := ParseOverflowPolicy("drop_oldest")
+		_, invalidErr := ParseOverflowPolicy("ignore")
+		Convey("Then known policies should be returned and unknown policies rejected", func() {
+			So(err, ShouldBeNil)
+			So(dropOldest, ShouldEqual, OverflowDropOldest)
+			So(invalidErr.Error(), ShouldEqual, "invalid overflow policy: ignore")
+		})
+	})
+}
+
+func TestBlockWhenQueueFull(t *testing.T) {
+	Convey("Given a client with a full queue whose overflow policy is to block", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0}, newMockRunnable(true))
+		retainOffsets(inspector, 0, 0)
+		factory.bufferSize = 1
+		factory.overflowPolicy = OverflowBlock
+		actual, _ := factory.StartConsumer(nil)
+		awaitRun(constructor)
+		factory.hub.Publish(&model.StreamEvent{Offset: 0})
+		overflows := testutil.ToFloat64(metrics.Overflows.WithLabelValues("topic", "block"))
+		Convey("When another message is consumed", func() {
+			published := make(chan struct{})
+			go func() {
+				factory.hub.Publish(&model.StreamEvent{Offset: 1})
+				close(published)
+			}()
+			blocked := true
+			select {
+			case <-published:
+				blocked = false
+			case <-time.After(50 * time.Millisecond):
+			}
+			first := <-actual.Data()
+			<-published
+			second := <-actual.Data()
+			Convey("Then the message should be delivered once the client has made room for it", func() {
+				So(blocked, ShouldBeTrue)
+				So(first.Offset, ShouldEqual, 0)
+				So(second.Offset, ShouldEqual, 1)
+				So(testutil.ToFloat64(metrics.Overflows.WithLabelValues("topic", "block")), ShouldEqual, overflows+1)
+			})
+		})
+	})
+}
+
+func TestDropOldestMessagesWhenQueueFull(t *testing.T) {
+	Convey("Given a client with a queue of two messages whose overflow policy is to drop the oldest", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0, 1}, newMockRunnable(true), newMockRunnable(true))
+		retainOffsets(inspector, 0, 0)
+		factory.bufferSize = 2
+		factory.overflowPolicy = OverflowDropOldest
+		actual, _ := factory.StartConsumer(nil)
+		awaitRun(constructor)
+		overflows := testutil.ToFloat64(metrics.Overflows.WithLabelValues("topic", "drop_oldest"))
+		Convey("When more messages are consumed than the client has read", func() {
+			factory.hub.Publish(&model.StreamEvent{Offset: 3, Partition: 0})
+			factory.hub.Publish(&model.StreamEvent{Offset: 4, Partition: 0})
+			factory.hub.Publish(&model.StreamEvent{Offset: 8, Partition: 1})
+			factory.hub.Publish(&model.StreamEvent{Offset: 9, Partition: 1})
+			factory.hub.Publish(&model.StreamEvent{Offset: 10, Partition: 1})
+			gaps := <-actual.Gaps()
+			Convey("Then the oldest messages should be dropped and the client told about the gaps", func() {
+				So((<-actual.Data()).Offset, ShouldEqual, 9)
+				So((<-actual.Data()).Offset, ShouldEqual, 10)
+				So(gaps, ShouldResemble, []*Gap{
+					{Partition: 0, FirstOffset: 3, LastOffset: 4, Dropped: 2},
+					{Partition: 1, FirstOffset: 8, LastOffset: 8, Dropped: 1},
+				})
+				So(testutil.ToFloat64(metrics.Overflows.WithLabelValues("topic", "drop_oldest")), ShouldEqual, overflows+3)
+			})
+		})
+	})
+}
+
+func TestDisconnectClientWhenQueueFull(t *testing.T) {
+	Convey("Given a client with a queue of one message whose overflow policy is to disconnect", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0}, newMockRunnable(true))
+		retainOffsets(inspector, 0, 0)
+		factory.bufferSize = 1
+		factory.overflowPolicy = OverflowDisconnect
+		actual, _ := factory.StartConsumer(nil)
+		awaitRun(constructor)
+		overflows := testutil.ToFloat64(metrics.Overflows.WithLabelValues("topic", "disconnect"))
+		Convey("When more messages are consumed than the client has read", func() {
+			factory.hub.Publish(&model.StreamEvent{Offset: 3})
+			factory.hub.Publish(&model.StreamEvent{Offset: 4})
+			factory.hub.Publish(&model.StreamEvent{Offset: 5})
+			_, open := <-actual.Overflowed()
+			Convey("Then the client should be disconnected without holding up the live feed", func() {
+				So(open, ShouldBeFalse)
+				So((<-actual.Data()).Offset, ShouldEqual, 3)
+				So(len(actual.Data()), ShouldEqual, 0)
+				So(testutil.ToFloat64(metrics.Overflows.WithLabelValues("topic", "disconnect")), ShouldEqual, overflows+1)
 			})
 		})
 	})
 }
 
 func TestStartNewConsumer(t *testing.T) {
-	Convey("Given a new runner instance has been created", t, func() {
-		config := &Config{KafkaBroker: []string{"0.0.0.0"}, Topic: "topic", Schema: &avro.Schema{}}
-		factory := NewFactory(config)
-		done := make(chan bool)
-		runnable := &mockRunnable{done: done}
-		runnable.On("Run").Return()
-		runnable.On("HasStarted").Return(true)
-		factory.constructor = mockConsumerConstructor(runnable)
-		Convey("When a new consumer instance is obtained", func() {
-			actual, err := factory.StartConsumer(3)
-			<-done
-			Convey("Then a new consumer instance should be constructed from the provided details", func() {
+	Convey("Given a new runner instance has been created for a topic with two partitions", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0, 1}, newMockRunnable(true), newMockRunnable(true))
+		retainOffsets(inspector, 0, 10)
+		Convey("When a new consumer instance is obtained for the live head of the topic", func() {
+			actual, err := factory.StartConsumer(nil)
+			awaitRun(constructor)
+			Convey("Then a shared live consumer should be started for each partition and the client subscribed to them", func() {
 				So(err, ShouldBeNil)
 				So(actual, ShouldNotBeNil)
-				So(actual.(*ConsumerController).runtime, ShouldEqual, runnable)
-				So(runnable.AssertCalled(t, "Run"), ShouldBeTrue)
+				So(actual.(*ConsumerController).positions[0].live, ShouldBeTrue)
+				So(actual.(*ConsumerController).positions[1].live, ShouldBeTrue)
+				So(factory.hub.live[0], ShouldEqual, constructor.runnables[0])
+				So(factory.hub.live[1], ShouldEqual, constructor.runnables[1])
+				So(factory.hub.subscribers[actual.(*ConsumerController)], ShouldBeTrue)
+				So(factory.hub.heads, ShouldResemble, map[int32]int64{0: 9, 1: 9})
+				So(constructor.partitions, ShouldResemble, []int32{0, 1})
+				So(constructor.offsets, ShouldResemble, []int64{-1, -1})
+				So(constructor.publishers[0], ShouldEqual, factory.hub)
+				So(constructor.publishers[1], ShouldEqual, factory.hub)
+				So(inspector.AssertCalled(t, "Partitions", "topic"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestShareLiveConsumerBetweenClients(t *testing.T) {
+	Convey("Given a client is subscribed to the live head of a topic", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0}, newMockRunnable(true))
+		retainOffsets(inspector, 0, 7)
+		first, _ := factory.StartConsumer(nil)
+		awaitRun(constructor)
+		Convey("When another client subscribes and a message is consumed", func() {
+			second, err := factory.StartConsumer(nil)
+			received := make(chan *model.StreamEvent, 2)
+			go func() { received <- <-first.Data() }()
+			go func() { received <- <-second.Data() }()
+			factory.hub.Publish(&model.StreamEvent{Data: "data", Offset: 7})
+			firstEvent := <-received
+			secondEvent := <-received
+			Convey("Then the message should be consumed once and delivered to both clients", func() {
+				So(err, ShouldBeNil)
+				So(len(constructor.offsets), ShouldEqual, 1)
+				So(firstEvent, ShouldResemble, &model.StreamEvent{Data: "data", Offset: 7})
+				So(secondEvent, ShouldEqual, firstEvent)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfKafkaClientCannotBeCreated(t *testing.T) {
+	Convey("Given a Kafka client cannot be created", t, func() {
+		expectedError := errors.New("something went wrong")
+		factory := NewFactory(&Config{KafkaBroker: []string{"0.0.0.0"}, Topic: "topic", Schema: schemaregistry.NewSchema("")})
+		factory.clientFactory = func(brokerAddr []string) (Inspectable, error) {
+			return nil, expectedError
+		}
+		Convey("When a new consumer instance is obtained", func() {
+			actual, err := factory.StartConsumer(nil)
+			Convey("Then the error should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err, ShouldEqual, expectedError)
+				So(factory.client, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfPartitionsCannotBeDiscovered(t *testing.T) {
+	Convey("Given the partitions of a topic cannot be retrieved", t, func() {
+		expectedError := errors.New("something went wrong")
+		factory, constructor, inspector := newTestFactory(nil)
+		inspector.ExpectedCalls = nil
+		inspector.On("Partitions", mock.Anything).Return([]int32(nil), expectedError)
+		Convey("When a new consumer instance is obtained", func() {
+			actual, err := factory.StartConsumer(nil)
+			Convey("Then the error should be returned and no consumers started", func() {
+				So(actual, ShouldBeNil)
+				So(err, ShouldEqual, expectedError)
+				So(constructor.offsets, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfCursorReferencesUnknownPartition(t *testing.T) {
+	Convey("Given a topic with a single partition", t, func() {
+		factory, constructor, _ := newTestFactory([]int32{0})
+		Convey("When a client requests an offset in a partition that does not exist", func() {
+			actual, err := factory.StartConsumer(model.Cursor{3: 10})
+			Convey("Then an error should be returned and no consumers started", func() {
+				So(actual, ShouldBeNil)
+				So(err.Error(), ShouldEqual, "partition 3 does not exist on topic topic")
+				So(constructor.offsets, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfOffsetExpired(t *testing.T) {
+	Convey("Given the earliest offset retained on a partition is 5", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0, 1})
+		retainOffsets(inspector, 5, 10)
+		Convey("When a client requests offset 3", func() {
+			actual, err := factory.StartConsumer(model.Cursor{0: 7, 1: 3})
+			Convey("Then an expired offset error giving the valid range should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err, ShouldResemble, &OffsetOutOfRangeError{Partition: 1, Offset: 3, Earliest: 5, Latest: 10})
+				So(err.(*OffsetOutOfRangeError).Expired(), ShouldBeTrue)
+				So(err.Error(), ShouldEqual, "offset 3 is outside the range 5 to 10 held on partition 1")
+				So(constructor.offsets, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfOffsetNotYetProduced(t *testing.T) {
+	Convey("Given the high-water mark of a partition is 10", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0})
+		retainOffsets(inspector, 5, 10)
+		Convey("When a client requests offset 11", func() {
+			actual, err := factory.StartConsumer(model.Cursor{0: 11})
+			Convey("Then an offset out of range error should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err, ShouldResemble, &OffsetOutOfRangeError{Partition: 0, Offset: 11, Earliest: 5, Latest: 10})
+				So(err.(*OffsetOutOfRangeError).Expired(), ShouldBeFalse)
+				So(constructor.offsets, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfOffsetRangeCannotBeRetrieved(t *testing.T) {
+	Convey("Given the offsets of a topic cannot be retrieved", t, func() {
+		expectedError := errors.New("something went wrong")
+		factory, _, inspector := newTestFactory([]int32{0})
+		inspector.On("GetOffset", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), expectedError)
+		Convey("When a client requests an offset", func() {
+			actual, err := factory.StartConsumer(model.Cursor{0: 3})
+			Convey("Then the error should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err, ShouldEqual, expectedError)
 			})
 		})
 	})
@@ -53,25 +326,486 @@ func TestStartNewConsumer(t *testing.T) {
 
 func TestReturnErrorIfConsumerNotStarted(t *testing.T) {
 	Convey("Given a new runner instance has been created", t, func() {
-		config := &Config{KafkaBroker: []string{"0.0.0.0"}, Topic: "topic", Schema: &avro.Schema{}}
-		factory := NewFactory(config)
-		done := make(chan bool)
-		runnable := &mockRunnable{done: done}
-		runnable.On("Run").Return()
-		runnable.On("HasStarted").Return(false)
-		factory.constructor = mockConsumerConstructor(runnable)
+		factory, constructor, inspector := newTestFactory([]int32{0}, newMockRunnable(false))
+		retainOffsets(inspector, 0, 10)
+		Convey("When a new consumer instance is obtained", func() {
+			actual, err := factory.StartConsumer(model.Cursor{0: 3})
+			awaitRun(constructor)
+			Convey("Then an error should be returned and the live consumer should not be retained", func() {
+				So(err.Error(), ShouldEqual, "failed to start consumer")
+				So(actual, ShouldBeNil)
+				So(factory.hub.live, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestShutdownStartedLiveConsumersIfAnotherNotStarted(t *testing.T) {
+	Convey("Given a topic with two partitions whose second live consumer cannot start", t, func() {
+		first := newMockRunnable(true)
+		first.On("Shutdown", mock.Anything).Return()
+		factory, constructor, inspector := newTestFactory([]int32{0, 1}, first, newMockRunnable(false))
+		retainOffsets(inspector, 0, 10)
 		Convey("When a new consumer instance is obtained", func() {
-			actual, err := factory.StartConsumer(3)
-			<-done
-			Convey("Then a new consumer instance should be constructed from the provided details", func() {
+			actual, err := factory.StartConsumer(nil)
+			awaitRun(constructor)
+			Convey("Then the live consumer that started should be shut down and not retained", func() {
 				So(err.Error(), ShouldEqual, "failed to start consumer")
 				So(actual, ShouldBeNil)
-				So(runnable.AssertCalled(t, "Run"), ShouldBeTrue)
+				So(<-first.shutdown, ShouldEqual, "failed to start consumer")
+				So(factory.hub.live, ShouldBeEmpty)
 			})
 		})
 	})
 }
 
+func TestShutdownLiveConsumerIfHighWaterMarkCannotBeRetrieved(t *testing.T) {
+	Convey("Given the high-water mark of a partition cannot be retrieved", t, func() {
+		expectedError := errors.New("something went wrong")
+		live := newMockRunnable(true)
+		live.On("Shutdown", mock.Anything).Return()
+		factory, constructor, inspector := newTestFactory([]int32{0}, live)
+		inspector.On("GetOffset", "topic", int32(0), sarama.OffsetNewest).Return(int64(0), expectedError)
+		Convey("When a new consumer instance is obtained", func() {
+			actual, err := factory.StartConsumer(nil)
+			awaitRun(constructor)
+			Convey("Then the error should be returned and the live consumer shut down", func() {
+				So(err, ShouldEqual, expectedError)
+				So(actual, ShouldBeNil)
+				So(<-live.shutdown, ShouldEqual, "failed to start consumer")
+				So(factory.hub.live, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfCatchUpConsumerNotStarted(t *testing.T) {
+	Convey("Given the live consumer for a topic is running", t, func() {
+		catchUp := newMockRunnable(false)
+		factory, constructor, inspector := newTestFactory([]int32{0}, newMockRunnable(true), catchUp)
+		retainOffsets(inspector, 0, 10)
+		Convey("When a client requests an offset that cannot be consumed", func() {
+			kafkaErrors := testutil.ToFloat64(metrics.KafkaErrors.WithLabelValues("topic"))
+			actual, err := factory.StartConsumer(model.Cursor{0: 3})
+			awaitRun(constructor)
+			Convey("Then an error should be returned and the client should not be subscribed", func() {
+				So(err.Error(), ShouldEqual, "failed to start consumer")
+				So(actual, ShouldBeNil)
+				So(factory.hub.subscribers, ShouldBeEmpty)
+				So(catchUp.AssertNotCalled(t, "Shutdown", mock.Anything), ShouldBeTrue)
+				So(testutil.ToFloat64(metrics.KafkaErrors.WithLabelValues("topic")), ShouldEqual, kafkaErrors+1)
+			})
+		})
+	})
+}
+
+func TestStopRunningCatchUpConsumersIfAnotherNotStarted(t *testing.T) {
+	Convey("Given the live consumers for a topic with two partitions are running", t, func() {
+		started := newMockRunnable(true)
+		started.On("Shutdown", mock.Anything).Return()
+		failed := newMockRunnable(false)
+		factory, constructor, inspector := newTestFactory([]int32{0, 1}, newMockRunnable(true), newMockRunnable(true), started, failed)
+		retainOffsets(inspector, 0, 10)
+		Convey("When a client requests older offsets on both partitions and one cannot be consumed", func() {
+			actual, err := factory.StartConsumer(model.Cursor{0: 3, 1: 4})
+			awaitRun(constructor)
+			Convey("Then the catch-up consumer that started should be shut down and the error returned", func() {
+				So(err.Error(), ShouldEqual, "failed to start consumer")
+				So(actual, ShouldBeNil)
+				So(<-started.shutdown, ShouldEqual, "failed to start consumer")
+				So(failed.AssertNotCalled(t, "Shutdown", mock.Anything), ShouldBeTrue)
+				So(factory.hub.subscribers, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestMergeLateJoinerIntoLiveFeed(t *testing.T) {
+	Convey("Given the live head of a partition is at offset 5", t, func() {
+		catchUp := newMockRunnable(true)
+		catchUp.On("Shutdown", mock.Anything).Return()
+		factory, constructor, inspector := newTestFactory([]int32{0}, newMockRunnable(true), catchUp)
+		retainOffsets(inspector, 0, 6)
+		Convey("When a client requests offset 3 and the catch-up consumer reaches the live head", func() {
+			catchUpConsumers := testutil.ToFloat64(metrics.CatchUpConsumers.WithLabelValues("topic"))
+			actual, err := factory.StartConsumer(model.Cursor{0: 3})
+			awaitRun(constructor)
+			go func() {
+				for offset := int64(3); offset <= 5; offset++ {
+					constructor.publishers[1].Publish(&model.StreamEvent{Offset: offset})
+				}
+			}()
+			received := []int64{(<-actual.Data()).Offset, (<-actual.Data()).Offset, (<-actual.Data()).Offset}
+			msg := <-catchUp.shutdown
+			go factory.hub.Publish(&model.StreamEvent{Offset: 6})
+			next := <-actual.Data()
+			Convey("Then the client should receive the backlog and then be merged into the live feed", func() {
+				So(err, ShouldBeNil)
+				So(constructor.partitions, ShouldResemble, []int32{0, 0})
+				So(constructor.offsets, ShouldResemble, []int64{-1, 3})
+				So(received, ShouldResemble, []int64{3, 4, 5})
+				So(msg, ShouldEqual, "caught up with live feed")
+				So(actual.(*ConsumerController).positions[0].live, ShouldBeTrue)
+				So(next.Offset, ShouldEqual, 6)
+				So(testutil.ToFloat64(metrics.CatchUpConsumers.WithLabelValues("topic")), ShouldEqual, catchUpConsumers+1)
+			})
+		})
+	})
+}
+
+func TestFollowLiveFeedWhenResumingFromHighWaterMark(t *testing.T) {
+	Convey("Given no message has been consumed from a partition whose high-water mark is 10", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0}, newMockRunnable(true))
+		retainOffsets(inspector, 0, 10)
+		Convey("When a client requests offset 10 and the next message is consumed", func() {
+			actual, err := factory.StartConsumer(model.Cursor{0: 10})
+			awaitRun(constructor)
+			go factory.hub.Publish(&model.StreamEvent{Offset: 10})
+			next := <-actual.Data()
+			Convey("Then the client should follow the live feed without a catch-up consumer", func() {
+				So(err, ShouldBeNil)
+				So(constructor.offsets, ShouldResemble, []int64{-1})
+				So(actual.(*ConsumerController).positions[0].live, ShouldBeTrue)
+				So(next.Offset, ShouldEqual, 10)
+			})
+		})
+	})
+}
+
+func TestRecordDeadLettersFromLiveAndCatchUpConsumers(t *testing.T) {
+	Convey("Given a runner has been configured with a dead letter sink", t, func() {
+		deadLetters := &mockDeadLetters{}
+		factory, constructor, inspector := newTestFactory([]int32{0}, newMockRunnable(true), newMockRunnable(true))
+		retainOffsets(inspector, 0, 10)
+		factory.deadLetters = newDeadLetterLog(deadLetters)
+		Convey("When a client requests an older offset", func() {
+			_, err := factory.StartConsumer(model.Cursor{0: 3})
+			awaitRun(constructor)
+			Convey("Then both the live and the catch-up consumer should record dead letters to the same log", func() {
+				So(err, ShouldBeNil)
+				So(constructor.offsets, ShouldResemble, []int64{-1, 3})
+				So(constructor.deadLetters[0], ShouldEqual, factory.deadLetters)
+				So(constructor.deadLetters[1], ShouldEqual, factory.deadLetters)
+			})
+		})
+	})
+}
+
+func TestRecordEachDeadLetterOnce(t *testing.T) {
+	Convey("Given a dead letter log whose sink fails to record a message once", t, func() {
+		sinkError := errors.New("disk full")
+		deadLetters := &mockDeadLetters{}
+		deadLetters.On("Record", mock.Anything).Return(sinkError).Once()
+		deadLetters.On("Record", mock.Anything).Return(nil)
+		log := newDeadLetterLog(deadLetters)
+		Convey("When the message is read by several consumers, as is another at the same offset of another partition", func() {
+			failed := log.Record(&model.DeadLetter{Partition: 0, Offset: 3})
+			recorded := log.Record(&model.DeadLetter{Partition: 0, Offset: 3})
+			duplicate := log.Record(&model.DeadLetter{Partition: 0, Offset: 3})
+			other := log.Record(&model.DeadLetter{Partition: 1, Offset: 3})
+			Convey("Then the message should be retried until recorded and recorded once per partition and offset", func() {
+				So(failed, ShouldEqual, sinkError)
+				So(recorded, ShouldBeNil)
+				So(duplicate, ShouldEqual, consumer.ErrAlreadyRecorded)
+				So(other, ShouldBeNil)
+				So(deadLetters.AssertNumberOfCalls(t, "Record", 3), ShouldBeTrue)
+			})
+		})
+	})
+	Convey("Given a runner is configured with a dead letter sink", t, func() {
+		config := &Config{Topic: "topic", Schema: schemaregistry.NewSchema(""), DeadLetters: &mockDeadLetters{}}
+		Convey("When a new runner instance is created", func() {
+			actual := NewFactory(config)
+			Convey("Then dead letters should be recorded through a log of those already recorded", func() {
+				So(actual.deadLetters, ShouldResemble, newDeadLetterLog(config.DeadLetters))
+			})
+		})
+	})
+}
+
+func TestIgnoreLiveMessagesWhileCatchingUp(t *testing.T) {
+	Convey("Given a client is being served by a catch-up consumer for one of two partitions", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0, 1}, newMockRunnable(true), newMockRunnable(true), newMockRunnable(true))
+		retainOffsets(inspector, 0, 10)
+		actual, _ := factory.StartConsumer(model.Cursor{0: 3})
+		awaitRun(constructor)
+		Convey("When messages are consumed from the live head of both partitions", func() {
+			factory.hub.Publish(&model.StreamEvent{Offset: 10, Partition: 0})
+			go factory.hub.Publish(&model.StreamEvent{Offset: 11, Partition: 1})
+			liveEvent := <-actual.Data()
+			go constructor.publishers[2].Publish(&model.StreamEvent{Offset: 3, Partition: 0})
+			catchUpEvent := <-actual.Data()
+			Convey("Then only the partition being followed live should be delivered from the live feed", func() {
+				So(constructor.partitions, ShouldResemble, []int32{0, 1, 0})
+				So(liveEvent, ShouldResemble, &model.StreamEvent{Offset: 11, Partition: 1})
+				So(catchUpEvent, ShouldResemble, &model.StreamEvent{Offset: 3, Partition: 0})
+				So(factory.hub.heads, ShouldResemble, map[int32]int64{0: 10, 1: 11})
+				So(actual.(*ConsumerController).positions[0].live, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestStopCatchUpConsumerWhenClientUnsubscribes(t *testing.T) {
+	Convey("Given a client is being served by a catch-up consumer", t, func() {
+		live := newMockRunnable(true)
+		catchUp := newMockRunnable(true)
+		catchUp.On("Shutdown", mock.Anything).Return()
+		factory, constructor, inspector := newTestFactory([]int32{0}, live, catchUp)
+		retainOffsets(inspector, 0, 10)
+		actual, _ := factory.StartConsumer(model.Cursor{0: 3})
+		awaitRun(constructor)
+		Convey("When the client unsubscribes", func() {
+			go actual.Stop("user disconnected")
+			msg := <-catchUp.shutdown
+			Convey("Then the catch-up consumer should be shut down and the live consumer left running", func() {
+				So(msg, ShouldEqual, "user disconnected")
+				So(live.AssertNotCalled(t, "Shutdown", mock.Anything), ShouldBeTrue)
+				So(factory.hub.live[0], ShouldEqual, live)
+			})
+		})
+	})
+}
+
+func TestStopClientWhileMessagesPublishedOnNewPartitions(t *testing.T) {
+	Convey("Given a client is subscribed to the live head of a topic", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0}, newMockRunnable(true))
+		retainOffsets(inspector, 0, 10)
+		actual, _ := factory.StartConsumer(nil)
+		awaitRun(constructor)
+		Convey("When messages are published on partitions created since while the client unsubscribes", func() {
+			publishing := make(chan struct{})
+			stopped := make(chan struct{})
+			published := make(chan struct{})
+			go func() {
+				defer close(published)
+				for partition := int32(1); ; partition++ {
+					factory.hub.Publish(&model.StreamEvent{Partition: partition})
+					if partition == 1 {
+						close(publishing)
+					}
+					select {
+					case <-stopped:
+						return
+					default:
+					}
+				}
+			}()
+			<-publishing
+			actual.Stop("user disconnected")
+			close(stopped)
+			<-published
+			Convey("Then the client should be unsubscribed", func() {
+				So(factory.hub.subscribers, ShouldNotContainKey, actual)
+			})
+		})
+	})
+}
+
+func TestShutdownLiveConsumers(t *testing.T) {
+	Convey("Given the live consumers of a topic with two partitions are running", t, func() {
+		first := newMockRunnable(true)
+		first.On("Shutdown", mock.Anything).Return()
+		second := newMockRunnable(true)
+		second.On("Shutdown", mock.Anything).Return()
+		factory, constructor, inspector := newTestFactory([]int32{0, 1}, first, second)
+		retainOffsets(inspector, 0, 10)
+		_, _ = factory.StartConsumer(nil)
+		awaitRun(constructor)
+		Convey("When the runner is shut down", func() {
+			factory.Shutdown("server closing")
+			Convey("Then every live consumer should be shut down", func() {
+				So(<-first.shutdown, ShouldEqual, "server closing")
+				So(<-second.shutdown, ShouldEqual, "server closing")
+				So(factory.hub.live, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestReturnHighWaterMarks(t *testing.T) {
+	Convey("Given a topic with two partitions", t, func() {
+		factory, _, inspector := newTestFactory([]int32{0, 1})
+		inspector.On("GetOffset", "topic", int32(0), sarama.OffsetNewest).Return(int64(12), nil)
+		inspector.On("GetOffset", "topic", int32(1), sarama.OffsetNewest).Return(int64(34), nil)
+		Convey("When the high-water marks of the topic are requested", func() {
+			actual, err := factory.HighWaterMarks()
+			Convey("Then the high-water mark of each partition should be returned", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, model.Cursor{0: 12, 1: 34})
+			})
+		})
+	})
+}
+
+func TestReturnHighWaterMarksOfLivePartitionsFromLiveHead(t *testing.T) {
+	Convey("Given the live consumers of a topic with two partitions are running", t, func() {
+		factory, constructor, inspector := newTestFactory([]int32{0, 1}, newMockRunnable(true), newMockRunnable(true))
+		retainOffsets(inspector, 0, 10)
+		_, _ = factory.StartConsumer(nil)
+		awaitRun(constructor)
+		factory.hub.Publish(&model.StreamEvent{Offset: 12, Partition: 1})
+		calls := len(inspector.Calls)
+		Convey("When the high-water marks of the topic are requested", func() {
+			actual, err := factory.HighWaterMarks()
+			Convey("Then they should follow the last message consumed without retrieving offsets from Kafka", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, model.Cursor{0: 10, 1: 13})
+				So(inspector.Calls[calls:], ShouldHaveLength, 1)
+				So(inspector.Calls[calls].Method, ShouldEqual, "Partitions")
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfHighWaterMarkCannotBeRetrieved(t *testing.T) {
+	Convey("Given the offsets of a topic cannot be retrieved", t, func() {
+		expectedError := errors.New("something went wrong")
+		factory, _, inspector := newTestFactory([]int32{0})
+		inspector.On("GetOffset", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), expectedError)
+		Convey("When the high-water marks of the topic are requested", func() {
+			actual, err := factory.HighWaterMarks()
+			Convey("Then the error should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err, ShouldEqual, expectedError)
+			})
+		})
+	})
+}
+
+func TestResolveOffsetsFromTime(t *testing.T) {
+	Convey("Given a topic with three partitions", t, func() {
+		since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		factory, _, inspector := newTestFactory([]int32{0, 1, 2})
+		inspector.On("GetOffset", "topic", int32(0), since.UnixMilli()).Return(int64(7), nil)
+		inspector.On("GetOffset", "topic", int32(1), since.UnixMilli()).Return(int64(0), nil)
+		inspector.On("GetOffset", "topic", int32(2), since.UnixMilli()).Return(int64(-1), nil)
+		inspector.On("GetOffset", "topic", int32(2), sarama.OffsetNewest).Return(int64(12), nil)
+		retainOffsets(inspector, 0, 20)
+		Convey("When the offsets of the messages produced since a time are requested", func() {
+			actual, err := factory.OffsetsAt(since)
+			Convey("Then the first offset at or after the time should be returned for each partition", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, model.Cursor{0: 7, 1: 0, 2: 12})
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfTimePredatesRetention(t *testing.T) {
+	Convey("Given the earliest offset retained on a partition is 5", t, func() {
+		since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		factory, _, inspector := newTestFactory([]int32{0})
+		inspector.On("GetOffset", "topic", int32(0), since.UnixMilli()).Return(int64(5), nil)
+		retainOffsets(inspector, 5, 20)
+		Convey("When the offsets of the messages produced since a time before the earliest retained message are requested", func() {
+			actual, err := factory.OffsetsAt(since)
+			Convey("Then an expired timestamp error should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err, ShouldResemble, &ExpiredTimestampError{Partition: 0, Since: since, Earliest: 5})
+				So(err.Error(), ShouldEqual, "messages produced since 2020-01-02T03:04:05Z have expired from partition 0, the earliest offset held is 5")
+			})
+		})
+	})
+}
+
+func TestResolveEndOffsetsFromTimePredatingRetention(t *testing.T) {
+	Convey("Given the earliest offset retained on a partition is 5", t, func() {
+		until := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		factory, _, inspector := newTestFactory([]int32{0})
+		inspector.On("GetOffset", "topic", int32(0), until.UnixMilli()).Return(int64(5), nil)
+		retainOffsets(inspector, 5, 20)
+		Convey("When the offsets bounding the messages produced before a time before the earliest retained message are requested", func() {
+			actual, err := factory.OffsetsBefore(until)
+			Convey("Then the earliest offset retained should be returned", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, model.Cursor{0: 5})
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfOffsetForTimeCannotBeRetrieved(t *testing.T) {
+	Convey("Given the offsets of a topic cannot be retrieved", t, func() {
+		expectedError := errors.New("something went wrong")
+		factory, _, inspector := newTestFactory([]int32{0})
+		inspector.On("GetOffset", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), expectedError)
+		Convey("When the offsets of the messages produced since a time are requested", func() {
+			actual, err := factory.OffsetsAt(time.Now())
+			Convey("Then the error should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err, ShouldEqual, expectedError)
+			})
+		})
+	})
+}
+
+func TestCheckBrokers(t *testing.T) {
+	Convey("Given the metadata of a topic can be refreshed from the brokers", t, func() {
+		factory, _, inspector := newTestFactory([]int32{0})
+		inspector.On("RefreshMetadata", mock.Anything).Return(nil)
+		Convey("When the brokers are checked", func() {
+			err := factory.CheckBrokers()
+			Convey("Then no error should be returned", func() {
+				So(err, ShouldBeNil)
+				So(inspector.AssertCalled(t, "RefreshMetadata", []string{"topic"}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfBrokersUnhealthy(t *testing.T) {
+	Convey("Given the brokers cannot be reached", t, func() {
+		expectedError := errors.New("something went wrong")
+		unreachable, _, unreachableInspector := newTestFactory([]int32{0})
+		unreachableInspector.On("RefreshMetadata", mock.Anything).Return(expectedError)
+		empty, _, emptyInspector := newTestFactory([]int32{})
+		emptyInspector.On("RefreshMetadata", mock.Anything).Return(nil)
+		unconnected := NewFactory(&Config{Topic: "topic"})
+		unconnected.clientFactory = func(brokerAddr []string) (Inspectable, error) {
+			return nil, expectedError
+		}
+		Convey("When the brokers are checked", func() {
+			unreachableErr := unreachable.CheckBrokers()
+			emptyErr := empty.CheckBrokers()
+			unconnectedErr := unconnected.CheckBrokers()
+			Convey("Then an error should be returned", func() {
+				So(unreachableErr, ShouldEqual, expectedError)
+				So(emptyErr.Error(), ShouldEqual, "topic topic has no partitions")
+				So(unconnectedErr, ShouldEqual, expectedError)
+			})
+		})
+	})
+}
+
+func newTestFactory(partitions []int32, runnables ...consumer.Runnable) (*Runner, *mockConstructor, *mockInspector) {
+	factory := NewFactory(&Config{KafkaBroker: []string{"0.0.0.0"}, Topic: "topic", Schema: schemaregistry.NewSchema("")})
+	constructor := &mockConstructor{runnables: runnables}
+	factory.constructor = constructor.construct
+	inspector := &mockInspector{}
+	inspector.On("Partitions", mock.Anything).Return(partitions, nil)
+	factory.client = inspector
+	return factory, constructor, inspector
+}
+
+func retainOffsets(inspector *mockInspector, earliest int64, latest int64) {
+	inspector.On("GetOffset", "topic", mock.Anything, sarama.OffsetOldest).Return(earliest, nil)
+	inspector.On("GetOffset", "topic", mock.Anything, sarama.OffsetNewest).Return(latest, nil)
+}
+
+func newMockRunnable(started bool) *mockRunnable {
+	runnable := &mockRunnable{done: make(chan bool, 1), shutdown: make(chan string, 1)}
+	runnable.On("Run").Return()
+	runnable.On("HasStarted").Return(started)
+	return runnable
+}
+
+func awaitRun(constructor *mockConstructor) {
+	for _, runnable := range constructor.runnables[:len(constructor.offsets)] {
+		<-runnable.(*mockRunnable).done
+	}
+}
+
 func (r *mockRunnable) Run() {
 	r.Called()
 	r.done <- true
@@ -79,6 +813,7 @@ func (r *mockRunnable) Run() {
 
 func (r *mockRunnable) Shutdown(msg string) {
 	r.Called(msg)
+	r.shutdown <- msg
 }
 
 func (r *mockRunnable) HasStarted() bool {
@@ -86,8 +821,30 @@ func (r *mockRunnable) HasStarted() bool {
 	return args.Bool(0)
 }
 
-func mockConsumerConstructor(r consumer.Runnable) func(consumer consumer.KafkaPartitionConsumable, messageTransformer consumer.Transformable, publisher consumer.Publishable, partition int32, offset int64, logger logger.Logger) consumer.Runnable {
-	return func(consumer consumer.KafkaPartitionConsumable, messageTransformer consumer.Transformable, publisher consumer.Publishable, partition int32, offset int64, logger logger.Logger) consumer.Runnable {
-		return r
-	}
+func (c *mockConstructor) construct(consumer consumer.KafkaPartitionConsumable, messageTransformer consumer.Transformable, publisher consumer.Publishable, deadLetters consumer.Recordable, partition int32, offset int64, logger logger.Logger) consumer.Runnable {
+	c.publishers = append(c.publishers, publisher)
+	c.deadLetters = append(c.deadLetters, deadLetters)
+	c.partitions = append(c.partitions, partition)
+	c.offsets = append(c.offsets, offset)
+	return c.runnables[len(c.offsets)-1]
+}
+
+func (d *mockDeadLetters) Record(letter *model.DeadLetter) error {
+	args := d.Called(letter)
+	return args.Error(0)
+}
+
+func (i *mockInspector) RefreshMetadata(topics ...string) error {
+	args := i.Called(topics)
+	return args.Error(0)
+}
+
+func (i *mockInspector) Partitions(topic string) ([]int32, error) {
+	args := i.Called(topic)
+	return args.Get(0).([]int32), args.Error(1)
+}
+
+func (i *mockInspector) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	args := i.Called(topic, partition, time)
+	return args.Get(0).(int64), args.Error(1)
 }
@@ -0,0 +1,129 @@
+package schemaregistry
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs.go/avro/schema"
+	"github.com/companieshouse/chs.go/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	initialBackoff        = 500 * time.Millisecond
+	maxBackoff            = 30 * time.Second
+	localSchemaExtension  = ".avsc"
+	msgFetchingSchema     = "fetching avro schema from schema registry"
+	msgStartingFromLocal  = "schema registry unavailable, starting from local copy of schema"
+	msgReplacedLocalCopy  = "schema registry reachable, replaced local copy of schema"
+	msgLocalCopyNotSaved  = "local copy of schema could not be saved"
+	msgLocalCopyNotLoaded = "no local copy of schema could be read"
+)
+
+// Loads the schemas messages are read with from the schema registry when the application starts. Fetching a schema
+// is retried with exponential backoff until a deadline has passed, after which the application starts from the
+// local copy of the schema, if any, and the registry is polled in the background until it can be reached. Every
+// schema fetched is saved as the local copy so that the last known good schema can be started from.
+type Bootstrap struct {
+	url          string
+	localDir     string
+	deadline     time.Duration
+	pollInterval time.Duration
+	backoff      time.Duration
+	fetch        func(url string, name string) (string, error)
+	logger       logger.Logger
+}
+
+// Construct a new Bootstrap instance.
+func NewBootstrap(cfg *config.Config) *Bootstrap {
+	return &Bootstrap{
+		url:          cfg.SchemaRegistryURL,
+		localDir:     cfg.SchemaDir,
+		deadline:     time.Duration(cfg.SchemaDeadline) * time.Second,
+		pollInterval: time.Duration(cfg.SchemaPollInterval) * time.Second,
+		backoff:      initialBackoff,
+		fetch:        schema.Get,
+		logger:       logger.NewLogger(),
+	}
+}
+
+// Load the latest version of the schema with the given subject name.
+func (b *Bootstrap) Load(name string) (*Schema, error) {
+	b.logger.Info(msgFetchingSchema, log.Data{"schema_name": name})
+	definition, err := b.fetchWithRetry(name)
+	if err == nil {
+		b.saveLocalCopy(name, definition)
+		return NewSchema(definition), nil
+	}
+	if b.localDir == "" {
+		return nil, err
+	}
+	local, readErr := ioutil.ReadFile(b.localPath(name))
+	if readErr != nil {
+		return nil, fmt.Errorf("%s, and %s: %s", err, msgLocalCopyNotLoaded, readErr)
+	}
+	b.logger.Info(msgStartingFromLocal, log.Data{"schema_name": name, "error": err.Error()})
+	loaded := NewSchema(string(local))
+	go b.poll(name, loaded)
+	return loaded, nil
+}
+
+// Fetch the schema, backing off exponentially between attempts until the deadline has passed.
+func (b *Bootstrap) fetchWithRetry(name string) (string, error) {
+	start := time.Now()
+	backoff := b.backoff
+	for {
+		definition, err := b.fetch(b.url, name)
+		if err == nil {
+			return definition, nil
+		}
+		if time.Since(start)+backoff > b.deadline {
+			return "", fmt.Errorf("error receiving %s schema: %s", name, err)
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Poll the schema registry until the schema can be fetched, then replace the local copy the application started
+// from.
+func (b *Bootstrap) poll(name string, loaded *Schema) {
+	for {
+		time.Sleep(b.pollInterval)
+		definition, err := b.fetch(b.url, name)
+		if err != nil {
+			continue
+		}
+		loaded.swap(definition)
+		b.saveLocalCopy(name, definition)
+		b.logger.Info(msgReplacedLocalCopy, log.Data{"schema_name": name})
+		return
+	}
+}
+
+func (b *Bootstrap) saveLocalCopy(name string, definition string) {
+	if b.localDir == "" {
+		return
+	}
+	// Write to a temporary file first so that a partially written copy never replaces the last known good one
+	temporary := b.localPath(name) + ".tmp"
+	err := os.MkdirAll(b.localDir, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(temporary, []byte(definition), 0644)
+	}
+	if err == nil {
+		err = os.Rename(temporary, b.localPath(name))
+	}
+	if err != nil {
+		b.logger.Error(fmt.Errorf("%s: %s", msgLocalCopyNotSaved, err), log.Data{"schema_name": name})
+	}
+}
+
+func (b *Bootstrap) localPath(name string) string {
+	return filepath.Join(b.localDir, name+localSchemaExtension)
+}
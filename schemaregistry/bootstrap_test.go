@@ -0,0 +1,156 @@
+package schemaregistry
+
+import (
+	"errors"
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs.go/log"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockLogger struct {
+	mock.Mock
+}
+
+// A schema registry that fails a given number of times before returning the schema.
+type flakyRegistry struct {
+	lock     sync.Mutex
+	failures int
+	calls    int
+}
+
+func (r *flakyRegistry) fetch(url string, name string) (string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.calls++
+	if r.calls <= r.failures {
+		return "", errors.New("connection refused")
+	}
+	return `"string"`, nil
+}
+
+func TestCreateNewBootstrap(t *testing.T) {
+	Convey("When a new bootstrap instance is constructed", t, func() {
+		actual := NewBootstrap(&config.Config{
+			SchemaRegistryURL:  "http://schema-registry:8081",
+			SchemaDir:          "/var/lib/schemas",
+			SchemaDeadline:     60,
+			SchemaPollInterval: 30,
+		})
+		Convey("Then a new bootstrap instance should be returned", func() {
+			So(actual.url, ShouldEqual, "http://schema-registry:8081")
+			So(actual.localDir, ShouldEqual, "/var/lib/schemas")
+			So(actual.deadline, ShouldEqual, 60*time.Second)
+			So(actual.pollInterval, ShouldEqual, 30*time.Second)
+			So(actual.backoff, ShouldEqual, initialBackoff)
+			So(actual.fetch, ShouldNotBeNil)
+			So(actual.logger, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRetryFetchingSchemaUntilRegistryReachable(t *testing.T) {
+	Convey("Given the schema registry fails twice before it can be reached", t, func() {
+		registry := &flakyRegistry{failures: 2}
+		logger := &mockLogger{}
+		logger.On("Info", msgFetchingSchema, mock.Anything)
+		dir := t.TempDir()
+		bootstrap := &Bootstrap{localDir: dir, deadline: time.Second, backoff: time.Millisecond, fetch: registry.fetch, logger: logger}
+		Convey("When the schema is loaded", func() {
+			actual, err := bootstrap.Load("resource-changed-data")
+			Convey("Then the schema fetched should be returned and saved as the local copy", func() {
+				So(err, ShouldBeNil)
+				So(actual.Definition(), ShouldEqual, `"string"`)
+				So(registry.calls, ShouldEqual, 3)
+				local, _ := ioutil.ReadFile(filepath.Join(dir, "resource-changed-data.avsc"))
+				So(string(local), ShouldEqual, `"string"`)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfRegistryUnreachableWithoutLocalCopy(t *testing.T) {
+	Convey("Given the schema registry cannot be reached and no local schema directory has been configured", t, func() {
+		registry := &flakyRegistry{failures: 1000}
+		logger := &mockLogger{}
+		logger.On("Info", msgFetchingSchema, mock.Anything)
+		bootstrap := &Bootstrap{deadline: 10 * time.Millisecond, backoff: time.Millisecond, fetch: registry.fetch, logger: logger}
+		Convey("When the schema is loaded", func() {
+			actual, err := bootstrap.Load("resource-changed-data")
+			Convey("Then an error should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err.Error(), ShouldEqual, "error receiving resource-changed-data schema: connection refused")
+			})
+		})
+	})
+}
+
+func TestStartFromLocalCopyIfRegistryUnreachable(t *testing.T) {
+	Convey("Given the schema registry cannot be reached before the deadline and a local copy of the schema exists", t, func() {
+		registry := &flakyRegistry{failures: 1000}
+		dir := t.TempDir()
+		_ = ioutil.WriteFile(filepath.Join(dir, "resource-changed-data.avsc"), []byte(`"long"`), 0644)
+		replaced := make(chan struct{})
+		logger := &mockLogger{}
+		logger.On("Info", msgFetchingSchema, mock.Anything)
+		logger.On("Info", msgStartingFromLocal, mock.Anything)
+		logger.On("Info", msgReplacedLocalCopy, mock.Anything).Run(func(mock.Arguments) {
+			close(replaced)
+		})
+		bootstrap := &Bootstrap{localDir: dir, deadline: 10 * time.Millisecond, pollInterval: time.Millisecond, backoff: time.Millisecond, fetch: registry.fetch, logger: logger}
+		Convey("When the schema is loaded", func() {
+			actual, err := bootstrap.Load("resource-changed-data")
+			Convey("Then the local copy should be returned", func() {
+				So(err, ShouldBeNil)
+				So(actual.Definition(), ShouldEqual, `"long"`)
+				Convey("And the schema should be replaced once the registry can be reached", func() {
+					registry.lock.Lock()
+					registry.failures = 0
+					registry.lock.Unlock()
+					<-replaced
+					So(actual.Definition(), ShouldEqual, `"string"`)
+					local, _ := ioutil.ReadFile(filepath.Join(dir, "resource-changed-data.avsc"))
+					So(string(local), ShouldEqual, `"string"`)
+				})
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfRegistryUnreachableAndLocalCopyMissing(t *testing.T) {
+	Convey("Given the schema registry cannot be reached and no local copy of the schema exists", t, func() {
+		registry := &flakyRegistry{failures: 1000}
+		logger := &mockLogger{}
+		logger.On("Info", msgFetchingSchema, mock.Anything)
+		bootstrap := &Bootstrap{localDir: t.TempDir(), deadline: 10 * time.Millisecond, backoff: time.Millisecond, fetch: registry.fetch, logger: logger}
+		Convey("When the schema is loaded", func() {
+			actual, err := bootstrap.Load("resource-changed-data")
+			Convey("Then an error should be returned", func() {
+				So(actual, ShouldBeNil)
+				So(err.Error(), ShouldStartWith, "error receiving resource-changed-data schema: connection refused, and "+msgLocalCopyNotLoaded)
+			})
+		})
+	})
+}
+
+func (l *mockLogger) Error(err error, data ...log.Data) {
+	l.Called(err, data)
+}
+
+func (l *mockLogger) Info(msg string, data ...log.Data) {
+	l.Called(msg, data)
+}
+
+func (l *mockLogger) InfoR(req *http.Request, msg string, data ...log.Data) {
+	l.Called(req, msg, data)
+}
+
+func (l *mockLogger) ErrorR(req *http.Request, err error, data ...log.Data) {
+	l.Called(req, err, data)
+}
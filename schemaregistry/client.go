@@ -0,0 +1,81 @@
+// Package schemaregistry fetches the Avro schemas messages were written with from a Confluent compatible schema
+// registry.
+package schemaregistry
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Fetches schemas from the schema registry by their ID. Schemas are immutable once registered so each is fetched
+// only once.
+type Client struct {
+	url        string
+	httpClient *http.Client
+	lock       sync.Mutex
+	schemas    map[int32]string
+}
+
+// Returned when the schema registry holds no schema with the requested ID.
+type SchemaNotFoundError struct {
+	ID     int32
+	Status string
+}
+
+func (e *SchemaNotFoundError) Error() string {
+	return fmt.Sprintf("schema %d could not be fetched from the schema registry: %s", e.ID, e.Status)
+}
+
+// The response returned by the schema registry for a schema ID.
+type schemaResponse struct {
+	Schema string `json:"schema"`
+}
+
+// Construct a new Client instance for the schema registry at the given URL.
+func NewClient(url string) *Client {
+	return &Client{
+		url:        strings.TrimSuffix(url, "/"),
+		httpClient: &http.Client{Timeout: requestTimeout},
+		schemas:    make(map[int32]string),
+	}
+}
+
+// Return the definition of the schema registered with the given ID.
+func (c *Client) SchemaByID(id int32) (string, error) {
+	c.lock.Lock()
+	schema, ok := c.schemas[id]
+	c.lock.Unlock()
+	if ok {
+		return schema, nil
+	}
+	response, err := c.httpClient.Get(fmt.Sprintf("%s/schemas/ids/%d", c.url, id))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return "", &SchemaNotFoundError{ID: id, Status: response.Status}
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("schema %d could not be fetched from the schema registry: %s", id, response.Status)
+	}
+	parsed := &schemaResponse{}
+	if err := jsonproducer.Instance().Unmarshal(body, parsed); err != nil {
+		return "", err
+	}
+	c.lock.Lock()
+	c.schemas[id] = parsed.Schema
+	c.lock.Unlock()
+	return parsed.Schema, nil
+}
@@ -0,0 +1,54 @@
+package schemaregistry
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCreateNewClient(t *testing.T) {
+	Convey("When a new client instance is constructed", t, func() {
+		actual := NewClient("http://schema-registry:8081/")
+		Convey("Then a new client instance should be returned", func() {
+			So(actual.url, ShouldEqual, "http://schema-registry:8081")
+			So(actual.httpClient, ShouldNotBeNil)
+			So(actual.schemas, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestFetchSchemaByID(t *testing.T) {
+	Convey("Given a schema registry holding schema 7", t, func() {
+		var requests int32
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			if r.URL.Path != "/schemas/ids/7" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"schema":"\"string\""}`))
+		}))
+		defer registry.Close()
+		client := NewClient(registry.URL)
+		Convey("When the schema is requested twice", func() {
+			first, err := client.SchemaByID(7)
+			second, _ := client.SchemaByID(7)
+			Convey("Then it should be fetched once and cached", func() {
+				So(err, ShouldBeNil)
+				So(first, ShouldEqual, `"string"`)
+				So(second, ShouldEqual, first)
+				So(atomic.LoadInt32(&requests), ShouldEqual, 1)
+			})
+		})
+		Convey("When an unknown schema is requested", func() {
+			_, err := client.SchemaByID(8)
+			Convey("Then an error should be returned saying the schema was not found", func() {
+				So(err.Error(), ShouldEqual, "schema 8 could not be fetched from the schema registry: 404 Not Found")
+				So(err, ShouldResemble, &SchemaNotFoundError{ID: 8, Status: "404 Not Found"})
+			})
+		})
+	})
+}
@@ -0,0 +1,40 @@
+package schemaregistry
+
+import (
+	"github.com/companieshouse/chs.go/avro"
+	"sync"
+)
+
+// An Avro schema messages are read with, which may be replaced while the application is running, e.g. once the
+// schema registry can be reached after starting from a local copy of the schema.
+type Schema struct {
+	lock   sync.RWMutex
+	schema *avro.Schema
+}
+
+// Construct a new Schema instance with the given definition.
+func NewSchema(definition string) *Schema {
+	return &Schema{schema: &avro.Schema{Definition: definition}}
+}
+
+// Return the current definition of the schema.
+func (s *Schema) Definition() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.schema.Definition
+}
+
+// Unmarshal an Avro message into the given data structure using the current definition of the schema.
+func (s *Schema) Unmarshal(input []byte, model interface{}) error {
+	s.lock.RLock()
+	schema := s.schema
+	s.lock.RUnlock()
+	return schema.Unmarshal(input, model)
+}
+
+// Replace the definition of the schema.
+func (s *Schema) swap(definition string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.schema = &avro.Schema{Definition: definition}
+}
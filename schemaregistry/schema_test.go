@@ -0,0 +1,28 @@
+package schemaregistry
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCreateNewSchema(t *testing.T) {
+	Convey("When a new schema instance is constructed", t, func() {
+		actual := NewSchema(`"string"`)
+		Convey("Then a new schema instance should be returned", func() {
+			So(actual, ShouldNotBeNil)
+			So(actual.Definition(), ShouldEqual, `"string"`)
+		})
+	})
+}
+
+func TestSwapSchemaDefinition(t *testing.T) {
+	Convey("Given a schema", t, func() {
+		schema := NewSchema(`"string"`)
+		Convey("When its definition is replaced", func() {
+			schema.swap(`"long"`)
+			Convey("Then the new definition should be returned", func() {
+				So(schema.Definition(), ShouldEqual, `"long"`)
+			})
+		})
+	})
+}
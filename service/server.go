@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const msgServerClosing = "server closing"
+
+// A transport serving streams alongside HTTP, e.g. gRPC, that stops accepting connections and waits for those open to
+// close when shut down.
+type Drainable interface {
+	Shutdown(ctx context.Context) error
+}
+
+// A service whose consumers are shut down, waiting for them to close, once every connection has been drained.
+type Stoppable interface {
+	Shutdown(msg string)
+}
+
+// Serves streams over HTTP and shuts them down gracefully, telling connected users where to resume from before the
+// consumers of each stream are closed.
+type Server struct {
+	server      *http.Server
+	certFile    string
+	keyFile     string
+	gracePeriod time.Duration
+	closing     chan struct{}
+	closeOnce   sync.Once
+	services    []Stoppable
+	transports  []Drainable
+}
+
+// Construct a new server instance listening on the configured address.
+func NewServer(cfg *config.Config) *Server {
+	return &Server{
+		server:      &http.Server{Addr: cfg.BindAddress},
+		certFile:    cfg.CertFile,
+		keyFile:     cfg.KeyFile,
+		gracePeriod: time.Duration(cfg.ShutdownGracePeriod) * time.Second,
+		closing:     make(chan struct{}),
+	}
+}
+
+// Return a channel that is closed once the server starts shutting down, telling request handlers to close their
+// connections.
+func (s *Server) Closing() <-chan struct{} {
+	return s.closing
+}
+
+// Register a service whose consumers should be shut down with the server.
+func (s *Server) Register(service Stoppable) {
+	s.services = append(s.services, service)
+}
+
+// Register a transport that should be drained alongside HTTP before the consumers of each service are shut down.
+func (s *Server) RegisterTransport(transport Drainable) {
+	s.transports = append(s.transports, transport)
+}
+
+// Serve requests using the given handler until the server is shut down.
+func (s *Server) Start(handler http.Handler) error {
+	s.server.Handler = handler
+	var err error
+	if s.certFile != "" && s.keyFile != "" {
+		err = s.server.ListenAndServeTLS(s.certFile, s.keyFile)
+	} else {
+		err = s.server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop accepting connections on HTTP and every registered transport, close the connections of every user and shut
+// down the consumers of every registered service. The consumers are shut down even if the connections could not be
+// drained, each stage being given the grace period to complete; the errors of both stages are returned together.
+func (s *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.gracePeriod)
+	defer cancel()
+	drained := make(chan error, len(s.transports)+1)
+	go func() {
+		drained <- s.server.Shutdown(ctx)
+	}()
+	for _, transport := range s.transports {
+		go func(transport Drainable) {
+			drained <- transport.Shutdown(ctx)
+		}(transport)
+	}
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+	var drainErr error
+	for i := 0; i < len(s.transports)+1; i++ {
+		if err := <-drained; err != nil && drainErr == nil {
+			drainErr = err
+		}
+	}
+	stopErr := s.stopServices()
+	switch {
+	case drainErr != nil && stopErr != nil:
+		return fmt.Errorf("%w; shutting down consumers: %v", drainErr, stopErr)
+	case drainErr != nil:
+		return drainErr
+	default:
+		return stopErr
+	}
+}
+
+// Shut down the consumers of every registered service concurrently. An error is returned if they have not closed
+// within the grace period.
+func (s *Server) stopServices() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.gracePeriod)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for _, service := range s.services {
+			wg.Add(1)
+			go func(service Stoppable) {
+				defer wg.Done()
+				service.Shutdown(msgServerClosing)
+			}(service)
+		}
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/gorilla/pat"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCreateNewServer(t *testing.T) {
+	Convey("When a new server instance is constructed", t, func() {
+		actual := NewServer(&config.Config{
+			BindAddress:         ":6000",
+			CertFile:            "cert",
+			KeyFile:             "key",
+			ShutdownGracePeriod: 10,
+		})
+		Convey("Then a new server instance should be returned", func() {
+			So(actual.server.Addr, ShouldEqual, ":6000")
+			So(actual.certFile, ShouldEqual, "cert")
+			So(actual.keyFile, ShouldEqual, "key")
+			So(actual.gracePeriod, ShouldEqual, 10*time.Second)
+			So(actual.Closing(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestShutdownServer(t *testing.T) {
+	Convey("Given a server with a registered service is running", t, func() {
+		server := NewServer(&config.Config{BindAddress: "127.0.0.1:0", ShutdownGracePeriod: 10})
+		server.Register(NewBackendService(&BackendConfiguration{
+			Configuration: &config.Config{},
+			Router:        pat.New(),
+			Closing:       server.Closing(),
+		}).WithTopic("topic"))
+		stopped := make(chan error)
+		go func() {
+			stopped <- server.Start(http.NotFoundHandler())
+		}()
+		Convey("When the server is shut down", func() {
+			err := server.Shutdown()
+			Convey("Then users should be told the server is closing and the server should stop", func() {
+				So(err, ShouldBeNil)
+				So(<-stopped, ShouldBeNil)
+				_, open := <-server.Closing()
+				So(open, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+type stubTransport struct {
+	err     error
+	drained bool
+}
+
+func (t *stubTransport) Shutdown(ctx context.Context) error {
+	t.drained = true
+	return t.err
+}
+
+type stubService struct {
+	msg chan string
+}
+
+func (s *stubService) Shutdown(msg string) {
+	s.msg <- msg
+}
+
+func TestDrainRegisteredTransports(t *testing.T) {
+	Convey("Given a server with registered transports", t, func() {
+		server := NewServer(&config.Config{ShutdownGracePeriod: 10})
+		drained := &stubTransport{}
+		failed := &stubTransport{err: errors.New("transport failed")}
+		service := &stubService{msg: make(chan string, 1)}
+		server.RegisterTransport(drained)
+		server.RegisterTransport(failed)
+		server.Register(service)
+		Convey("When the server is shut down", func() {
+			err := server.Shutdown()
+			Convey("Then every transport should be drained, the services shut down regardless and the errors returned", func() {
+				So(drained.drained, ShouldBeTrue)
+				So(failed.drained, ShouldBeTrue)
+				So(<-service.msg, ShouldEqual, "server closing")
+				So(err.Error(), ShouldEqual, "transport failed")
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfConnectionsNotDrainedWithinGracePeriod(t *testing.T) {
+	Convey("Given a user is connected to a request handler that ignores the server closing", t, func() {
+		server := NewServer(&config.Config{})
+		server.gracePeriod = 50 * time.Millisecond
+		connected := make(chan struct{})
+		released := make(chan struct{})
+		defer close(released)
+		server.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(connected)
+			<-released
+		})
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		go func() {
+			_ = server.server.Serve(listener)
+		}()
+		go func() {
+			_, _ = http.Get("http://" + listener.Addr().String())
+		}()
+		<-connected
+		Convey("When the server is shut down", func() {
+			err := server.Shutdown()
+			Convey("Then an error should be returned once the grace period has elapsed", func() {
+				So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestReturnDrainAndShutdownErrorsTogether(t *testing.T) {
+	Convey("Given a server whose transport cannot be drained and whose service does not close", t, func() {
+		server := NewServer(&config.Config{})
+		server.gracePeriod = 50 * time.Millisecond
+		released := make(chan struct{})
+		defer close(released)
+		server.RegisterTransport(&stubTransport{err: errors.New("transport failed")})
+		server.Register(&blockingService{released: released})
+		Convey("When the server is shut down", func() {
+			err := server.Shutdown()
+			Convey("Then both errors should be returned once the grace period has elapsed", func() {
+				So(err.Error(), ShouldEqual, "transport failed; shutting down consumers: context deadline exceeded")
+			})
+		})
+	})
+}
+
+type blockingService struct {
+	released chan struct{}
+}
+
+func (s *blockingService) Shutdown(msg string) {
+	<-s.released
+}
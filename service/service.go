@@ -2,21 +2,29 @@ package service
 
 import (
 	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs-streaming-api-backend/consumer"
 	"github.com/companieshouse/chs-streaming-api-backend/handler"
 	"github.com/companieshouse/chs-streaming-api-backend/logger"
 	"github.com/companieshouse/chs-streaming-api-backend/runner"
-	"github.com/companieshouse/chs.go/avro"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/pat"
 	"net/http"
+	"time"
 )
 
 type BackendService struct {
-	kafkaBroker []string
-	schema      *avro.Schema
-	factory     *runner.Runner
-	router      *pat.Router
-	prefix      string
+	kafkaBroker       []string
+	schema            transformer.Schemable
+	registry          transformer.SchemaFetchable
+	factory           *runner.Runner
+	router            *pat.Router
+	prefix            string
+	heartbeatInterval time.Duration
+	bufferSize        int
+	overflowPolicy    runner.OverflowPolicy
+	deadLetters       consumer.Recordable
+	closing           <-chan struct{}
 }
 
 type Router interface {
@@ -25,31 +33,68 @@ type Router interface {
 
 type BackendConfiguration struct {
 	Configuration *config.Config
-	Schema        *avro.Schema
+	Schema        transformer.Schemable
+	Registry      transformer.SchemaFetchable
 	Router        *pat.Router
 	Topic         string
 	Prefix        string
+	Closing       <-chan struct{}
+	DeadLetters   consumer.Recordable
 }
 
 func NewBackendService(cfg *BackendConfiguration) *BackendService {
 	return &BackendService{
-		router:      cfg.Router,
-		kafkaBroker: cfg.Configuration.KafkaBroker,
-		schema:      cfg.Schema,
-		prefix:      cfg.Prefix,
+		router:            cfg.Router,
+		kafkaBroker:       cfg.Configuration.KafkaBroker,
+		schema:            cfg.Schema,
+		registry:          cfg.Registry,
+		prefix:            cfg.Prefix,
+		heartbeatInterval: time.Duration(cfg.Configuration.HeartbeatInterval) * time.Second,
+		bufferSize:        cfg.Configuration.BufferSize,
+		overflowPolicy:    runner.OverflowPolicy(cfg.Configuration.OverflowPolicy),
+		deadLetters:       cfg.DeadLetters,
+		closing:           cfg.Closing,
 	}
 }
 
 func (s *BackendService) WithTopic(topic string) *BackendService {
 	s.factory = runner.NewFactory(&runner.Config{
-		KafkaBroker: s.kafkaBroker,
-		Schema:      s.schema,
-		Topic:       topic,
+		KafkaBroker:    s.kafkaBroker,
+		Schema:         s.schema,
+		Registry:       s.registry,
+		Topic:          topic,
+		BufferSize:     s.bufferSize,
+		OverflowPolicy: s.overflowPolicy,
+		DeadLetters:    s.deadLetters,
 	})
 	return s
 }
 
+// Return the runner consuming the topic bound to the service, through which it can be served by other transports.
+func (s *BackendService) Runner() *runner.Runner {
+	return s.factory
+}
+
+// Override the interval after which a heartbeat is written to idle connections to the stream.
+func (s *BackendService) WithHeartbeat(interval time.Duration) *BackendService {
+	s.heartbeatInterval = interval
+	return s
+}
+
+// Check that the topic bound to the service can be consumed from the Kafka brokers.
+func (s *BackendService) CheckBrokers() error {
+	return s.factory.CheckBrokers()
+}
+
+// Shut down the consumers of the topic bound to the service, waiting for them to close.
+func (s *BackendService) Shutdown(msg string) {
+	s.factory.Shutdown(msg)
+}
+
 func (s *BackendService) WithPath(path string) *BackendService {
-	s.router.Path(s.prefix + path).Methods(http.MethodGet).HandlerFunc(handler.NewRequestHandler(s.factory, logger.NewLogger()).HandleRequest)
+	requestHandler := handler.NewRequestHandler(s.factory, logger.NewLogger()).
+		WithHeartbeat(s.heartbeatInterval).
+		WithShutdown(s.closing)
+	s.router.Path(s.prefix + path).Methods(http.MethodGet).HandlerFunc(requestHandler.HandleRequest)
 	return s
 }
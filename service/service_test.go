@@ -2,23 +2,31 @@ package service
 
 import (
 	"github.com/companieshouse/chs-streaming-api-backend/config"
+	"github.com/companieshouse/chs-streaming-api-backend/deadletter"
 	backendhandler "github.com/companieshouse/chs-streaming-api-backend/handler"
-	"github.com/companieshouse/chs.go/avro"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	"github.com/companieshouse/chs-streaming-api-backend/schemaregistry"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/pat"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
 )
 
 func TestCreateNewService(t *testing.T) {
 	Convey("When a new service instance is constructed", t, func() {
 		configuration := &BackendConfiguration{
 			Configuration: &config.Config{
-				KafkaBroker: []string{"0.0.0.0"},
+				KafkaBroker:       []string{"0.0.0.0"},
+				HeartbeatInterval: 30,
+				BufferSize:        50,
+				OverflowPolicy:    "disconnect",
 			},
-			Schema: &avro.Schema{},
-			Router: pat.New(),
-			Prefix: "/prefix",
+			Schema:      schemaregistry.NewSchema(""),
+			Router:      pat.New(),
+			Prefix:      "/prefix",
+			DeadLetters: &deadletter.FileSink{},
+			Registry:    schemaregistry.NewClient("http://schema-registry"),
 		}
 		actual := NewBackendService(configuration)
 		Convey("Then a new service instance should be returned", func() {
@@ -27,6 +35,11 @@ func TestCreateNewService(t *testing.T) {
 			So(actual.router, ShouldEqual, configuration.Router)
 			So(actual.kafkaBroker, ShouldResemble, configuration.Configuration.KafkaBroker)
 			So(actual.prefix, ShouldEqual, "/prefix")
+			So(actual.heartbeatInterval, ShouldEqual, 30*time.Second)
+			So(actual.bufferSize, ShouldEqual, 50)
+			So(actual.overflowPolicy, ShouldEqual, runner.OverflowDisconnect)
+			So(actual.deadLetters, ShouldEqual, configuration.DeadLetters)
+			So(actual.registry, ShouldEqual, configuration.Registry)
 		})
 	})
 }
@@ -37,7 +50,7 @@ func TestBindKafkaTopic(t *testing.T) {
 			Configuration: &config.Config{
 				KafkaBroker: []string{"0.0.0.0"},
 			},
-			Schema: &avro.Schema{},
+			Schema: schemaregistry.NewSchema(""),
 			Router: pat.New(),
 		}
 		service := NewBackendService(configuration)
@@ -46,6 +59,26 @@ func TestBindKafkaTopic(t *testing.T) {
 			Convey("Then a new consumer factory should be allocated to the service", func() {
 				So(actual, ShouldEqual, service)
 				So(actual.factory, ShouldNotBeNil)
+				So(actual.Runner(), ShouldEqual, actual.factory)
+			})
+		})
+	})
+}
+
+func TestOverrideHeartbeatInterval(t *testing.T) {
+	Convey("Given a new service instance has been constructed", t, func() {
+		configuration := &BackendConfiguration{
+			Configuration: &config.Config{
+				HeartbeatInterval: 30,
+			},
+			Router: pat.New(),
+		}
+		service := NewBackendService(configuration)
+		Convey("When the heartbeat interval is overridden", func() {
+			actual := service.WithHeartbeat(5 * time.Second)
+			Convey("Then the overriding interval should be used", func() {
+				So(actual, ShouldEqual, service)
+				So(actual.heartbeatInterval, ShouldEqual, 5*time.Second)
 			})
 		})
 	})
@@ -57,7 +90,7 @@ func TestAttachRequestHandler(t *testing.T) {
 			Configuration: &config.Config{
 				KafkaBroker: []string{"0.0.0.0"},
 			},
-			Schema: &avro.Schema{},
+			Schema: schemaregistry.NewSchema(""),
 			Router: pat.New(),
 			Prefix: "/prefix",
 		}
@@ -0,0 +1,112 @@
+// Package socket serves the streams over WebSocket connections, on which users subscribe to streams, change the
+// filters applied to them and move within them by sending control messages.
+package socket
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/logger"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	msgUserConnected    = "user connected"
+	msgUserDisconnected = "user disconnected"
+	msgUnsubscribed     = "user unsubscribed"
+	msgServerClosing    = "server closing"
+	msgSlowConsumer     = "user too far behind stream"
+	msgMessagesDropped  = "messages dropped"
+	originHeader        = "Origin"
+	writeTimeout        = 10 * time.Second
+)
+
+// A stream that can be subscribed to over a WebSocket connection.
+type Streamable interface {
+	Topic() string
+	StartConsumer(cursor model.Cursor) (runner.Controllable, error)
+	HighWaterMarks() (model.Cursor, error)
+	OffsetsAt(since time.Time) (model.Cursor, error)
+}
+
+// Upgrades requests to WebSocket connections and serves the streams requested on them.
+type Handler struct {
+	streams           map[string]Streamable
+	upgrader          *websocket.Upgrader
+	allowedOrigins    map[string]bool
+	jsonSerialiser    transformer.Marshallable
+	jsonDeserialiser  transformer.Unmarshallable
+	heartbeatInterval time.Duration
+	closing           <-chan struct{}
+	logger            logger.Logger
+}
+
+// Construct a new Handler instance.
+func NewHandler(logger logger.Logger) *Handler {
+	h := &Handler{
+		streams:          make(map[string]Streamable),
+		allowedOrigins:   make(map[string]bool),
+		jsonSerialiser:   jsonproducer.Instance(),
+		jsonDeserialiser: jsonproducer.Instance(),
+		logger:           logger,
+	}
+	h.upgrader = &websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	return h
+}
+
+// Allow users to subscribe to the given stream by name.
+func (h *Handler) WithStream(name string, stream Streamable) *Handler {
+	h.streams[name] = stream
+	return h
+}
+
+// Accept connections from pages served from the given origins, e.g. https://example.com, as well as from pages served
+// by this service.
+func (h *Handler) WithAllowedOrigins(origins []string) *Handler {
+	for _, origin := range origins {
+		h.allowedOrigins[strings.TrimSuffix(strings.TrimSpace(origin), "/")] = true
+	}
+	return h
+}
+
+// Send a ping to every connection at the given interval so that idle connections are kept open. Pings are disabled
+// if the interval is not positive.
+func (h *Handler) WithHeartbeat(interval time.Duration) *Handler {
+	h.heartbeatInterval = interval
+	return h
+}
+
+// Close every connection, telling users where to resume each stream from, once the given channel is closed.
+func (h *Handler) WithShutdown(closing <-chan struct{}) *Handler {
+	h.closing = closing
+	return h
+}
+
+func (h *Handler) HandleRequest(writer http.ResponseWriter, request *http.Request) {
+	conn, err := h.upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		// The upgrader has already told the user why the connection could not be upgraded
+		h.logger.ErrorR(request, err)
+		return
+	}
+	h.logger.InfoR(request, msgUserConnected)
+	newSession(h, conn, request).serve()
+}
+
+// Return true if the connection may be upgraded. Browsers send the API key given as basic credentials with every
+// request to the service, including those made by pages served from other origins, so upgrades are only accepted from
+// clients that are not browsers, which send no Origin header, from pages served by this service and from the allowed
+// origins.
+func (h *Handler) checkOrigin(request *http.Request) bool {
+	origin := request.Header.Get(originHeader)
+	if origin == "" || h.allowedOrigins[origin] {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, request.Host)
+}
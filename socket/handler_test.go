@@ -0,0 +1,454 @@
+package socket
+
+import (
+	"errors"
+	"github.com/companieshouse/chs-streaming-api-backend/auth"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	"github.com/companieshouse/chs.go/log"
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockStream struct {
+	mock.Mock
+}
+
+type mockController struct {
+	mock.Mock
+	data       chan *model.StreamEvent
+	gaps       chan []*runner.Gap
+	overflowed chan struct{}
+}
+
+type mockLogger struct {
+	mock.Mock
+}
+
+func newMockController() *mockController {
+	controller := &mockController{
+		data:       make(chan *model.StreamEvent),
+		gaps:       make(chan []*runner.Gap),
+		overflowed: make(chan struct{}),
+	}
+	controller.On("Stop", mock.Anything).Return()
+	return controller
+}
+
+func newMockLogger() *mockLogger {
+	logger := &mockLogger{}
+	logger.On("InfoR", mock.Anything, mock.Anything, mock.Anything).Return()
+	logger.On("ErrorR", mock.Anything, mock.Anything, mock.Anything).Return()
+	return logger
+}
+
+// Serve the handler and open a WebSocket connection to it, returning the connection and a function that closes it.
+func connect(handler http.Handler) (*websocket.Conn, func()) {
+	server := httptest.NewServer(handler)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	So(err, ShouldBeNil)
+	return conn, func() {
+		_ = conn.Close()
+		server.Close()
+	}
+}
+
+func send(conn *websocket.Conn, command string) {
+	So(conn.WriteMessage(websocket.TextMessage, []byte(command)), ShouldBeNil)
+}
+
+func receive(conn *websocket.Conn) *Message {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	message := &Message{}
+	So(conn.ReadJSON(message), ShouldBeNil)
+	return message
+}
+
+func TestCreateNewHandler(t *testing.T) {
+	Convey("When a new handler instance is constructed", t, func() {
+		logger := &mockLogger{}
+		stream := &mockStream{}
+		closing := make(chan struct{})
+		actual := NewHandler(logger).WithStream("filings", stream).WithAllowedOrigins([]string{" https://example.com/"}).WithHeartbeat(time.Second).WithShutdown(closing)
+		Convey("Then a new handler instance should be returned", func() {
+			So(actual.streams, ShouldResemble, map[string]Streamable{"filings": stream})
+			So(actual.upgrader, ShouldNotBeNil)
+			So(actual.allowedOrigins, ShouldResemble, map[string]bool{"https://example.com": true})
+			So(actual.jsonSerialiser, ShouldNotBeNil)
+			So(actual.jsonDeserialiser, ShouldNotBeNil)
+			So(actual.heartbeatInterval, ShouldEqual, time.Second)
+			So(actual.closing, ShouldEqual, (<-chan struct{})(closing))
+			So(actual.logger, ShouldEqual, logger)
+		})
+	})
+}
+
+func TestSubscribeToStream(t *testing.T) {
+	Convey("Given a user is connected to the WebSocket endpoint of a stream with two partitions", t, func() {
+		controller := newMockController()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{0: 10, 1: 20}, nil)
+		stream.On("StartConsumer", mock.Anything).Return(controller, nil)
+		conn, disconnect := connect(http.HandlerFunc(NewHandler(newMockLogger()).WithStream("filings", stream).HandleRequest))
+		defer disconnect()
+		Convey("When the user subscribes to a stream from an offset", func() {
+			send(conn, `{"action":"subscribe","stream":"filings","offset":"0:5","filter":{"resource_kind":"filing-history"}}`)
+			subscribed := receive(conn)
+			controller.data <- &model.StreamEvent{
+				Data:      `{"data":"{}","offset":5,"partition":0}` + "\n",
+				Resource:  &rcd.ResourceChangedData{ResourceKind: "company-profile"},
+				Offset:    5,
+				Partition: 0,
+			}
+			controller.data <- &model.StreamEvent{
+				Data:      `{"data":"{}","offset":6,"partition":0}` + "\n",
+				Resource:  &rcd.ResourceChangedData{ResourceKind: "filing-history"},
+				Offset:    6,
+				Partition: 0,
+			}
+			event := receive(conn)
+			Convey("Then the user should be told the subscription has started, following the other partition from its high-water mark", func() {
+				So(stream.AssertCalled(t, "StartConsumer", model.Cursor{0: 5}), ShouldBeTrue)
+				So(subscribed, ShouldResemble, &Message{Type: "subscribed", Stream: "filings", Cursor: "0:5,1:20"})
+			})
+			Convey("Then only the messages matching the filter should be written, tagged with the stream and resume cursor", func() {
+				So(event.Type, ShouldEqual, "event")
+				So(event.Stream, ShouldEqual, "filings")
+				So(event.Cursor, ShouldEqual, "0:7,1:20")
+				So(string(event.Data), ShouldEqual, `{"data":"{}","offset":6,"partition":0}`)
+			})
+			Convey("And the user changes the filter", func() {
+				send(conn, `{"action":"filter","stream":"filings","filter":{"resource_kind":"company-profile"}}`)
+				filtered := receive(conn)
+				controller.data <- &model.StreamEvent{Data: `{"offset":7}`, Resource: &rcd.ResourceChangedData{ResourceKind: "company-profile"}, Offset: 7}
+				event := receive(conn)
+				Convey("Then the messages matching the new filter should be written", func() {
+					So(filtered, ShouldResemble, &Message{Type: "filtered", Stream: "filings"})
+					So(event.Cursor, ShouldEqual, "0:8,1:20")
+					So(string(event.Data), ShouldEqual, `{"offset":7}`)
+				})
+			})
+			Convey("And the user unsubscribes", func() {
+				send(conn, `{"action":"unsubscribe","stream":"filings"}`)
+				unsubscribed := receive(conn)
+				Convey("Then the consumer should be stopped and the user told where to resume from", func() {
+					So(unsubscribed, ShouldResemble, &Message{Type: "unsubscribed", Stream: "filings", Cursor: "0:7,1:20"})
+					So(controller.AssertCalled(t, "Stop", msgUnsubscribed), ShouldBeTrue)
+				})
+			})
+		})
+	})
+}
+
+func TestSeekWithinStream(t *testing.T) {
+	Convey("Given a user has subscribed to a stream", t, func() {
+		first := newMockController()
+		second := newMockController()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", model.Cursor(nil)).Return(first, nil)
+		stream.On("StartConsumer", model.Cursor{0: 100}).Return(second, nil)
+		conn, disconnect := connect(http.HandlerFunc(NewHandler(newMockLogger()).WithStream("filings", stream).HandleRequest))
+		defer disconnect()
+		send(conn, `{"action":"subscribe","stream":"filings"}`)
+		So(receive(conn).Type, ShouldEqual, "subscribed")
+		Convey("When the user seeks to another offset", func() {
+			send(conn, `{"action":"seek","stream":"filings","offset":"0:100"}`)
+			subscribed := receive(conn)
+			second.data <- &model.StreamEvent{Data: `{"offset":100}`, Offset: 100}
+			event := receive(conn)
+			Convey("Then the stream should be restarted from the offset without reconnecting", func() {
+				So(first.AssertCalled(t, "Stop", msgUnsubscribed), ShouldBeTrue)
+				So(subscribed, ShouldResemble, &Message{Type: "subscribed", Stream: "filings", Cursor: "0:100"})
+				So(event.Cursor, ShouldEqual, "0:101")
+			})
+		})
+	})
+}
+
+func TestKeepSubscriptionIfSeekFails(t *testing.T) {
+	Convey("Given a user has subscribed to a stream", t, func() {
+		first := newMockController()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", model.Cursor(nil)).Return(first, nil)
+		stream.On("StartConsumer", model.Cursor{0: 100}).Return(&mockController{}, errors.New("offset 100 out of range"))
+		conn, disconnect := connect(http.HandlerFunc(NewHandler(newMockLogger()).WithStream("filings", stream).HandleRequest))
+		defer disconnect()
+		send(conn, `{"action":"subscribe","stream":"filings"}`)
+		So(receive(conn).Type, ShouldEqual, "subscribed")
+		Convey("When the user seeks to an offset the stream cannot be consumed from", func() {
+			send(conn, `{"action":"seek","stream":"filings","offset":"0:100"}`)
+			actual := receive(conn)
+			first.data <- &model.StreamEvent{Data: `{"offset":5}`, Offset: 5}
+			event := receive(conn)
+			Convey("Then the user should be told why and keep receiving messages from the existing subscription", func() {
+				So(actual, ShouldResemble, &Message{Type: "error", Stream: "filings", Error: "offset 100 out of range"})
+				So(event.Cursor, ShouldEqual, "0:6")
+				So(first.AssertNotCalled(t, "Stop", mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestCloseConnectionIfCommandTooLarge(t *testing.T) {
+	Convey("Given a user is connected to the WebSocket endpoint", t, func() {
+		conn, disconnect := connect(http.HandlerFunc(NewHandler(newMockLogger()).WithStream("filings", &mockStream{}).HandleRequest))
+		defer disconnect()
+		Convey("When the user sends a message larger than a command may be", func() {
+			send(conn, `{"action":"subscribe","stream":"`+strings.Repeat("f", maxCommandSize)+`"}`)
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, _, err := conn.ReadMessage()
+			Convey("Then the connection should be closed", func() {
+				So(websocket.IsCloseError(err, websocket.CloseMessageTooBig), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestCloseConnectionIfUserStopsAnsweringPings(t *testing.T) {
+	Convey("Given a user connected to a handler pinging connections frequently has subscribed to a stream", t, func() {
+		stopped := make(chan string, 1)
+		controller := &mockController{data: make(chan *model.StreamEvent), gaps: make(chan []*runner.Gap), overflowed: make(chan struct{})}
+		controller.On("Stop", mock.Anything).Return().Run(func(args mock.Arguments) {
+			stopped <- args.String(0)
+		})
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", mock.Anything).Return(controller, nil)
+		conn, disconnect := connect(http.HandlerFunc(NewHandler(newMockLogger()).WithStream("filings", stream).WithHeartbeat(50 * time.Millisecond).HandleRequest))
+		defer disconnect()
+		send(conn, `{"action":"subscribe","stream":"filings"}`)
+		So(receive(conn).Type, ShouldEqual, "subscribed")
+		Convey("When the user stops reading from the connection and so stops answering pings", func() {
+			var reason string
+			select {
+			case reason = <-stopped:
+			case <-time.After(5 * time.Second):
+			}
+			Convey("Then the user should be disconnected and the consumer stopped", func() {
+				So(reason, ShouldEqual, msgUserDisconnected)
+			})
+		})
+	})
+}
+
+func TestRejectInvalidCommands(t *testing.T) {
+	Convey("Given a user authenticated with a key entitled to the filings stream only is connected", t, func() {
+		keys, _ := auth.ParseKeyStore([]byte("keys:\n  - name: acme\n    key: acme-key\n    streams: [filings]\n"))
+		logger := newMockLogger()
+		controller := newMockController()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", mock.Anything).Return(controller, nil)
+		handler := NewHandler(logger).WithStream("filings", stream).WithStream("officers", &mockStream{})
+		server := httptest.NewServer(auth.NewMiddleware(keys, logger).WithStreams("/").Handler(http.HandlerFunc(handler.HandleRequest)))
+		defer server.Close()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), http.Header{"Authorization": {"acme-key"}})
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		Convey("When invalid commands are sent", func() {
+			send(conn, `not json`)
+			invalidJSON := receive(conn)
+			send(conn, `{"action":"rewind","stream":"filings"}`)
+			invalidAction := receive(conn)
+			send(conn, `{"action":"subscribe","stream":"charges"}`)
+			unknownStream := receive(conn)
+			send(conn, `{"action":"subscribe","stream":"officers"}`)
+			notEntitled := receive(conn)
+			send(conn, `{"action":"unsubscribe","stream":"filings"}`)
+			notSubscribed := receive(conn)
+			send(conn, `{"action":"subscribe","stream":"filings","filter":{"event_type":"created"}}`)
+			invalidFilter := receive(conn)
+			send(conn, `{"action":"subscribe","stream":"filings"}`)
+			subscribed := receive(conn)
+			send(conn, `{"action":"subscribe","stream":"filings"}`)
+			alreadySubscribed := receive(conn)
+			Convey("Then the user should be told why each was rejected", func() {
+				So(invalidJSON.Type, ShouldEqual, "error")
+				So(invalidJSON.Error, ShouldStartWith, "invalid command: ")
+				So(invalidAction, ShouldResemble, &Message{Type: "error", Stream: "filings", Error: "invalid action: rewind"})
+				So(unknownStream, ShouldResemble, &Message{Type: "error", Stream: "charges", Error: "unknown stream: charges"})
+				So(notEntitled, ShouldResemble, &Message{Type: "error", Stream: "officers", Error: "API key not entitled to stream"})
+				So(notSubscribed, ShouldResemble, &Message{Type: "error", Stream: "filings", Error: "not subscribed to stream: filings"})
+				So(invalidFilter, ShouldResemble, &Message{Type: "error", Stream: "filings", Error: "invalid event type: created"})
+				So(subscribed.Type, ShouldEqual, "subscribed")
+				So(alreadySubscribed, ShouldResemble, &Message{Type: "error", Stream: "filings", Error: "already subscribed to stream: filings"})
+			})
+		})
+	})
+}
+
+func TestReportErrorIfConsumerCannotStart(t *testing.T) {
+	Convey("Given a user is connected to the WebSocket endpoint", t, func() {
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", mock.Anything).Return(&mockController{}, errors.New("offset 0 out of range"))
+		conn, disconnect := connect(http.HandlerFunc(NewHandler(newMockLogger()).WithStream("filings", stream).HandleRequest))
+		defer disconnect()
+		Convey("When the user subscribes to a stream that cannot be consumed", func() {
+			send(conn, `{"action":"subscribe","stream":"filings","offset":"0"}`)
+			actual := receive(conn)
+			Convey("Then the user should be told why", func() {
+				So(actual, ShouldResemble, &Message{Type: "error", Stream: "filings", Error: "offset 0 out of range"})
+			})
+		})
+	})
+}
+
+func TestCloseSubscriptionsWhenServerClosing(t *testing.T) {
+	Convey("Given a user has subscribed to a stream and received a message", t, func() {
+		controller := newMockController()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", mock.Anything).Return(controller, nil)
+		closing := make(chan struct{})
+		conn, disconnect := connect(http.HandlerFunc(NewHandler(newMockLogger()).WithStream("filings", stream).WithShutdown(closing).HandleRequest))
+		defer disconnect()
+		send(conn, `{"action":"subscribe","stream":"filings","offset":"0:5"}`)
+		So(receive(conn).Type, ShouldEqual, "subscribed")
+		controller.data <- &model.StreamEvent{Data: `{"offset":5}`, Offset: 5}
+		So(receive(conn).Type, ShouldEqual, "event")
+		Convey("When the server closes", func() {
+			close(closing)
+			actual := receive(conn)
+			_, _, err := conn.ReadMessage()
+			Convey("Then the user should be told where to resume from and the connection closed", func() {
+				So(actual.Type, ShouldEqual, "closing")
+				So(actual.Cursor, ShouldEqual, "0:6")
+				So(string(actual.Data), ShouldEqual, `{"reason":"server_closing","resume_from":"0:6"}`)
+				So(controller.AssertCalled(t, "Stop", msgServerClosing), ShouldBeTrue)
+				So(websocket.IsCloseError(err, websocket.CloseGoingAway), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestCloseSubscriptionWhenUserTooFarBehind(t *testing.T) {
+	Convey("Given a user has subscribed to a stream", t, func() {
+		controller := newMockController()
+		stream := &mockStream{}
+		stream.On("HighWaterMarks").Return(model.Cursor{}, nil)
+		stream.On("StartConsumer", mock.Anything).Return(controller, nil)
+		conn, disconnect := connect(http.HandlerFunc(NewHandler(newMockLogger()).WithStream("filings", stream).HandleRequest))
+		defer disconnect()
+		send(conn, `{"action":"subscribe","stream":"filings","offset":"0:5"}`)
+		So(receive(conn).Type, ShouldEqual, "subscribed")
+		Convey("When messages are dropped and the user then falls too far behind the stream", func() {
+			controller.gaps <- []*runner.Gap{{Partition: 0, FirstOffset: 5, LastOffset: 9, Dropped: 5}}
+			gap := receive(conn)
+			close(controller.overflowed)
+			actual := receive(conn)
+			send(conn, `{"action":"subscribe","stream":"filings","offset":"0:10"}`)
+			resubscribed := receive(conn)
+			Convey("Then the user should be told about the gap and then that the subscription has closed", func() {
+				So(gap.Type, ShouldEqual, "gap")
+				So(string(gap.Data), ShouldEqual, `{"partition":0,"first_offset":5,"last_offset":9,"dropped":5}`)
+				So(actual.Type, ShouldEqual, "closing")
+				So(string(actual.Data), ShouldEqual, `{"reason":"slow_consumer","resume_from":"0:5"}`)
+				So(controller.AssertCalled(t, "Stop", msgSlowConsumer), ShouldBeTrue)
+			})
+			Convey("Then the user should be able to subscribe to the stream again", func() {
+				So(resubscribed.Type, ShouldEqual, "subscribed")
+			})
+		})
+	})
+}
+
+func TestRejectRequestsThatAreNotWebSocketUpgrades(t *testing.T) {
+	Convey("When a plain HTTP request is received", t, func() {
+		response := httptest.NewRecorder()
+		NewHandler(newMockLogger()).HandleRequest(response, httptest.NewRequest("GET", "/socket", nil))
+		Convey("Then it should be rejected", func() {
+			So(response.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
+
+func TestRejectUpgradesFromOtherOrigins(t *testing.T) {
+	Convey("Given a handler allowing connections from pages served from https://example.com", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(NewHandler(newMockLogger()).WithAllowedOrigins([]string{"https://example.com"}).HandleRequest))
+		defer server.Close()
+		dial := func(origin string) int {
+			header := http.Header{}
+			if origin != "" {
+				header.Set("Origin", origin)
+			}
+			conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+			if err == nil {
+				_ = conn.Close()
+			}
+			return response.StatusCode
+		}
+		Convey("When connections are opened from several origins", func() {
+			none := dial("")
+			same := dial(server.URL)
+			allowed := dial("https://example.com")
+			other := dial("https://attacker.example")
+			Convey("Then only those from other origins that are not allowed should be rejected", func() {
+				So(none, ShouldEqual, http.StatusSwitchingProtocols)
+				So(same, ShouldEqual, http.StatusSwitchingProtocols)
+				So(allowed, ShouldEqual, http.StatusSwitchingProtocols)
+				So(other, ShouldEqual, http.StatusForbidden)
+			})
+		})
+	})
+}
+
+func (s *mockStream) Topic() string {
+	return "topic"
+}
+
+func (s *mockStream) StartConsumer(cursor model.Cursor) (runner.Controllable, error) {
+	args := s.Called(cursor)
+	return args.Get(0).(runner.Controllable), args.Error(1)
+}
+
+func (s *mockStream) HighWaterMarks() (model.Cursor, error) {
+	args := s.Called()
+	return args.Get(0).(model.Cursor), args.Error(1)
+}
+
+func (s *mockStream) OffsetsAt(since time.Time) (model.Cursor, error) {
+	args := s.Called(since)
+	return args.Get(0).(model.Cursor), args.Error(1)
+}
+
+func (c *mockController) Stop(msg string) {
+	c.Called(msg)
+}
+
+func (c *mockController) Data() <-chan *model.StreamEvent {
+	return c.data
+}
+
+func (c *mockController) Gaps() <-chan []*runner.Gap {
+	return c.gaps
+}
+
+func (c *mockController) Overflowed() <-chan struct{} {
+	return c.overflowed
+}
+
+func (l *mockLogger) Error(err error, data ...log.Data) {
+	l.Called(err, data)
+}
+
+func (l *mockLogger) Info(msg string, data ...log.Data) {
+	l.Called(msg, data)
+}
+
+func (l *mockLogger) InfoR(req *http.Request, msg string, data ...log.Data) {
+	l.Called(req, msg, data)
+}
+
+func (l *mockLogger) ErrorR(req *http.Request, err error, data ...log.Data) {
+	l.Called(req, err, data)
+}
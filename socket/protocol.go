@@ -0,0 +1,68 @@
+package socket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+const (
+	actionSubscribe   = "subscribe"
+	actionUnsubscribe = "unsubscribe"
+	actionFilter      = "filter"
+	actionSeek        = "seek"
+	typeSubscribed    = "subscribed"
+	typeUnsubscribed  = "unsubscribed"
+	typeFiltered      = "filtered"
+	typeEvent         = "event"
+	typeSkipped       = "skipped"
+	typeGap           = "gap"
+	typeClosing       = "closing"
+	typeError         = "error"
+)
+
+// A control message sent by the user to subscribe to a stream, unsubscribe from it, change the filter applied to it
+// or move to another position within it. Filters take the same criteria as the query parameters of the HTTP streams
+// and positions are given as an offset cursor or as the time to stream from.
+type Command struct {
+	Action string            `json:"action"`
+	Stream string            `json:"stream"`
+	Offset string            `json:"offset,omitempty"`
+	Since  string            `json:"since,omitempty"`
+	Filter map[string]string `json:"filter,omitempty"`
+}
+
+// A message written to the user. Events carry the message serialised exactly as it is written to the HTTP streams,
+// identified by the cursor the user should resume the stream from.
+type Message struct {
+	Type   string          `json:"type"`
+	Stream string          `json:"stream,omitempty"`
+	Cursor string          `json:"cursor,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Return the filter criteria of the command in the form of query parameters.
+func (c *Command) query() url.Values {
+	query := make(url.Values)
+	for criterion, value := range c.Filter {
+		query.Set(criterion, value)
+	}
+	return query
+}
+
+// Return an error if the command does not name an action the user may take on a stream.
+func (c *Command) validate() error {
+	switch c.Action {
+	case actionSubscribe, actionUnsubscribe, actionFilter, actionSeek:
+	default:
+		return fmt.Errorf("invalid action: %s", c.Action)
+	}
+	if c.Stream == "" {
+		return fmt.Errorf("%s must specify a stream", c.Action)
+	}
+	if c.Offset != "" && c.Since != "" {
+		return fmt.Errorf("offset and since cannot both be specified")
+	}
+	return nil
+}
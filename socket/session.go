@@ -0,0 +1,416 @@
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/auth"
+	"github.com/companieshouse/chs-streaming-api-backend/metrics"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/runner"
+	"github.com/companieshouse/chs.go/log"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	endReasonServerClosing = "server_closing"
+	endReasonSlowConsumer  = "slow_consumer"
+	msgNotEntitled         = "API key not entitled to stream"
+	// The largest command a user may send; larger messages close the connection.
+	maxCommandSize = 64 * 1024
+)
+
+// The streams a user has subscribed to over a single WebSocket connection. Messages from every stream are written to
+// the connection by one writer at a time.
+type session struct {
+	handler       *Handler
+	conn          *websocket.Conn
+	request       *http.Request
+	key           *auth.Key
+	writeLock     sync.Mutex
+	lock          sync.Mutex
+	subscriptions map[string]*subscription
+}
+
+// A stream the user has subscribed to, together with the filter applied to it and the cursor to resume it from.
+type subscription struct {
+	name       string
+	topic      string
+	controller runner.Controllable
+	lock       sync.Mutex
+	filter     *model.Filter
+	cursor     model.Cursor
+	stop       chan struct{}
+	stopped    chan struct{}
+}
+
+func newSession(handler *Handler, conn *websocket.Conn, request *http.Request) *session {
+	return &session{
+		handler:       handler,
+		conn:          conn,
+		request:       request,
+		key:           auth.KeyFromContext(request.Context()),
+		subscriptions: make(map[string]*subscription),
+	}
+}
+
+// Act on the commands sent by the user until they disconnect or the server closes.
+func (s *session) serve() {
+	done := make(chan struct{})
+	defer close(done)
+	defer s.conn.Close()
+	commands := make(chan []byte)
+	go s.read(commands, done)
+	var heartbeat <-chan time.Time
+	if s.handler.heartbeatInterval > 0 {
+		ticker := time.NewTicker(s.handler.heartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
+		select {
+		case command, ok := <-commands:
+			if !ok {
+				s.unsubscribeAll(func(sub *subscription) {
+					sub.controller.Stop(msgUserDisconnected)
+				})
+				s.handler.logger.InfoR(s.request, msgUserDisconnected)
+				return
+			}
+			s.handle(command)
+		case <-heartbeat:
+			_ = s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+		case <-s.handler.closing:
+			s.unsubscribeAll(func(sub *subscription) {
+				sub.controller.Stop(msgServerClosing)
+				s.end(sub, endReasonServerClosing)
+			})
+			s.handler.logger.InfoR(s.request, msgServerClosing)
+			_ = s.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, msgServerClosing), time.Now().Add(writeTimeout))
+			return
+		}
+	}
+}
+
+// Pass every message sent by the user to the session until the connection is closed, the user sends a message larger
+// than a command may be or the user stops answering pings.
+func (s *session) read(commands chan<- []byte, done <-chan struct{}) {
+	defer close(commands)
+	s.conn.SetReadLimit(maxCommandSize)
+	s.extendReadDeadline()
+	s.conn.SetPongHandler(func(string) error {
+		s.extendReadDeadline()
+		return nil
+	})
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.extendReadDeadline()
+		select {
+		case commands <- data:
+		case <-done:
+			return
+		}
+	}
+}
+
+// Allow the user until two heartbeat intervals from now to answer the next ping, if connections are pinged. Users are
+// otherwise allowed to stay silent indefinitely, as they need send nothing once they have subscribed.
+func (s *session) extendReadDeadline() {
+	if s.handler.heartbeatInterval > 0 {
+		_ = s.conn.SetReadDeadline(time.Now().Add(2 * s.handler.heartbeatInterval))
+	}
+}
+
+func (s *session) handle(data []byte) {
+	command := &Command{}
+	if err := s.handler.jsonDeserialiser.Unmarshal(data, command); err != nil {
+		s.fail("", fmt.Errorf("invalid command: %s", err))
+		return
+	}
+	if err := command.validate(); err != nil {
+		s.fail(command.Stream, err)
+		return
+	}
+	stream, ok := s.handler.streams[command.Stream]
+	if !ok {
+		s.fail(command.Stream, fmt.Errorf("unknown stream: %s", command.Stream))
+		return
+	}
+	if s.key != nil && !s.key.Entitled(command.Stream) {
+		s.fail(command.Stream, errors.New(msgNotEntitled))
+		return
+	}
+	s.lock.Lock()
+	existing := s.subscriptions[command.Stream]
+	s.lock.Unlock()
+	if command.Action == actionSubscribe && existing != nil {
+		s.fail(command.Stream, fmt.Errorf("already subscribed to stream: %s", command.Stream))
+		return
+	}
+	if command.Action != actionSubscribe && existing == nil {
+		s.fail(command.Stream, fmt.Errorf("not subscribed to stream: %s", command.Stream))
+		return
+	}
+	switch command.Action {
+	case actionSubscribe:
+		filter, err := model.ParseFilter(command.query())
+		if err != nil {
+			s.fail(command.Stream, err)
+			return
+		}
+		s.subscribe(command, stream, filter)
+	case actionUnsubscribe:
+		s.unsubscribe(existing)
+		existing.controller.Stop(msgUnsubscribed)
+		s.handler.logger.InfoR(s.request, msgUnsubscribed, log.Data{"stream": existing.name})
+		s.write(&Message{Type: typeUnsubscribed, Stream: existing.name, Cursor: existing.resumeCursor().String()})
+	case actionFilter:
+		filter, err := model.ParseFilter(command.query())
+		if err != nil {
+			s.fail(command.Stream, err)
+			return
+		}
+		existing.setFilter(filter)
+		s.write(&Message{Type: typeFiltered, Stream: existing.name})
+	case actionSeek:
+		filter := existing.currentFilter()
+		if command.Filter != nil {
+			var err error
+			if filter, err = model.ParseFilter(command.query()); err != nil {
+				s.fail(command.Stream, err)
+				return
+			}
+		}
+		cursor, err := s.startCursor(command, stream)
+		if err != nil {
+			s.fail(command.Stream, err)
+			return
+		}
+		// The new position is consumed before the existing subscription is stopped, so that the user keeps it if the
+		// stream cannot be consumed from the new position
+		sub, err := s.open(command.Stream, stream, cursor, filter)
+		if err != nil {
+			s.fail(command.Stream, err)
+			return
+		}
+		s.unsubscribe(existing)
+		existing.controller.Stop(msgUnsubscribed)
+		s.begin(sub)
+	}
+}
+
+// Subscribe the user to the stream from the position given by the command.
+func (s *session) subscribe(command *Command, stream Streamable, filter *model.Filter) {
+	cursor, err := s.startCursor(command, stream)
+	if err != nil {
+		s.fail(command.Stream, err)
+		return
+	}
+	s.start(command.Stream, stream, cursor, filter)
+}
+
+// Start consuming the stream from the given cursor and write its messages to the user until they unsubscribe.
+func (s *session) start(name string, stream Streamable, cursor model.Cursor, filter *model.Filter) {
+	sub, err := s.open(name, stream, cursor, filter)
+	if err != nil {
+		s.fail(name, err)
+		return
+	}
+	s.begin(sub)
+}
+
+// Start consuming the stream from the given cursor, returning a subscription that has yet to be added to the session.
+func (s *session) open(name string, stream Streamable, cursor model.Cursor, filter *model.Filter) (*subscription, error) {
+	// Partitions followed from the live head start from their high-water mark, which is read before subscribing so
+	// that users resuming before any message has been delivered on a partition miss nothing produced meanwhile
+	highWaterMarks, err := stream.HighWaterMarks()
+	if err != nil {
+		return nil, err
+	}
+	controller, err := stream.StartConsumer(cursor)
+	if err != nil {
+		return nil, err
+	}
+	sub := &subscription{
+		name:       name,
+		topic:      stream.Topic(),
+		controller: controller,
+		filter:     filter,
+		cursor:     make(model.Cursor),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	for partition, offset := range cursor {
+		sub.cursor[partition] = offset
+	}
+	for partition, offset := range highWaterMarks {
+		if start, ok := sub.cursor[partition]; !ok || start < 0 {
+			sub.cursor[partition] = offset
+		}
+	}
+	return sub, nil
+}
+
+// Add the subscription to the session, tell the user it has started and write its messages to the user until they
+// unsubscribe.
+func (s *session) begin(sub *subscription) {
+	cursor := sub.cursor.String()
+	s.lock.Lock()
+	s.subscriptions[sub.name] = sub
+	s.lock.Unlock()
+	s.write(&Message{Type: typeSubscribed, Stream: sub.name, Cursor: cursor})
+	go s.run(sub)
+}
+
+// Write the messages of the stream to the user until they unsubscribe or fall too far behind the stream.
+func (s *session) run(sub *subscription) {
+	defer close(sub.stopped)
+	connections := metrics.Connections.WithLabelValues(sub.topic)
+	connections.Inc()
+	defer connections.Dec()
+	published := metrics.MessagesPublished.WithLabelValues(sub.topic)
+	for {
+		select {
+		case event := <-sub.controller.Data():
+			filter, cursor := sub.advance(event)
+			if event.Skipped {
+				if filter.IncludeSkipped {
+					s.writeNotice(sub.name, typeSkipped, cursor, &json.Skipped{Partition: event.Partition, Offset: event.Offset})
+				}
+			} else if filter.Matches(event.Resource) {
+				s.write(&Message{Type: typeEvent, Stream: sub.name, Cursor: cursor, Data: []byte(event.Data)})
+				published.Inc()
+			}
+		case gaps := <-sub.controller.Gaps():
+			for _, gap := range gaps {
+				s.handler.logger.InfoR(s.request, msgMessagesDropped, log.Data{"stream": sub.name, "partition": gap.Partition, "dropped": gap.Dropped})
+				s.writeNotice(sub.name, typeGap, "", &json.Gap{
+					Partition:   gap.Partition,
+					FirstOffset: gap.FirstOffset,
+					LastOffset:  gap.LastOffset,
+					Dropped:     gap.Dropped,
+				})
+			}
+		case <-sub.controller.Overflowed():
+			s.lock.Lock()
+			if s.subscriptions[sub.name] == sub {
+				delete(s.subscriptions, sub.name)
+			}
+			s.lock.Unlock()
+			sub.controller.Stop(msgSlowConsumer)
+			s.handler.logger.InfoR(s.request, msgSlowConsumer, log.Data{"stream": sub.name})
+			s.end(sub, endReasonSlowConsumer)
+			return
+		case <-sub.stop:
+			return
+		}
+	}
+}
+
+// Remove the subscription from the session and wait for its messages to stop being written to the user.
+func (s *session) unsubscribe(sub *subscription) {
+	s.lock.Lock()
+	if s.subscriptions[sub.name] == sub {
+		delete(s.subscriptions, sub.name)
+	}
+	s.lock.Unlock()
+	close(sub.stop)
+	<-sub.stopped
+}
+
+// Remove every subscription from the session, calling the given function for each once its messages have stopped
+// being written to the user.
+func (s *session) unsubscribeAll(stopped func(sub *subscription)) {
+	s.lock.Lock()
+	subscriptions := make([]*subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subscriptions = append(subscriptions, sub)
+	}
+	s.lock.Unlock()
+	for _, sub := range subscriptions {
+		s.unsubscribe(sub)
+		stopped(sub)
+	}
+}
+
+// Return the cursor the command asks to start the stream from, resolving the time given by the since field to
+// offsets if given.
+func (s *session) startCursor(command *Command, stream Streamable) (model.Cursor, error) {
+	if command.Since == "" {
+		return model.ParseCursor(command.Offset)
+	}
+	since, err := time.Parse(time.RFC3339, command.Since)
+	if err != nil {
+		return nil, err
+	}
+	return stream.OffsetsAt(since)
+}
+
+// Tell the user why the stream has ended and where to resume it from.
+func (s *session) end(sub *subscription, reason string) {
+	cursor := sub.resumeCursor().String()
+	s.writeNotice(sub.name, typeClosing, cursor, &json.EndOfStream{Reason: reason, ResumeFrom: cursor})
+}
+
+func (s *session) fail(stream string, err error) {
+	s.handler.logger.ErrorR(s.request, err, log.Data{"stream": stream})
+	s.write(&Message{Type: typeError, Stream: stream, Error: err.Error()})
+}
+
+func (s *session) writeNotice(stream string, messageType string, cursor string, notice interface{}) {
+	data, err := s.handler.jsonSerialiser.Marshal(notice)
+	if err != nil {
+		s.handler.logger.ErrorR(s.request, err)
+		return
+	}
+	s.write(&Message{Type: messageType, Stream: stream, Cursor: cursor, Data: data})
+}
+
+func (s *session) write(message *Message) {
+	data, err := s.handler.jsonSerialiser.Marshal(message)
+	if err != nil {
+		s.handler.logger.ErrorR(s.request, err)
+		return
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_ = s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Record that the user has reached the message, returning the filter to apply to it and the cursor to resume from.
+func (sub *subscription) advance(event *model.StreamEvent) (*model.Filter, string) {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	sub.cursor[event.Partition] = event.Offset + 1
+	return sub.filter, sub.cursor.String()
+}
+
+func (sub *subscription) setFilter(filter *model.Filter) {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	sub.filter = filter
+}
+
+func (sub *subscription) currentFilter() *model.Filter {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	return sub.filter
+}
+
+func (sub *subscription) resumeCursor() model.Cursor {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	cursor := make(model.Cursor, len(sub.cursor))
+	for partition, offset := range sub.cursor {
+		cursor[partition] = offset
+	}
+	return cursor
+}
@@ -0,0 +1,27 @@
+package streamingpb
+
+import (
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Convert the resource changed data entity served over HTTP to its protobuf equivalent.
+func NewResourceChangedData(resource *json.ResourceChangedData) (*ResourceChangedData, error) {
+	data, err := structpb.NewStruct(resource.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &ResourceChangedData{
+		ResourceKind: resource.ResourceKind,
+		ResourceUri:  resource.ResourceURI,
+		ResourceId:   resource.ResourceID,
+		Data:         data,
+		Event: &Event{
+			FieldsChanged: resource.Event.FieldsChanged,
+			Timepoint:     resource.Event.Timepoint,
+			Partition:     resource.Event.Partition,
+			PublishedAt:   resource.Event.PublishedAt,
+			Type:          resource.Event.Type,
+		},
+	}, nil
+}
@@ -0,0 +1,103 @@
+package transformer
+
+import (
+	"encoding/csv"
+	"github.com/companieshouse/chs-streaming-api-backend/model"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"strconv"
+	"strings"
+)
+
+const (
+	csvRecordEvent         = "event"
+	fieldsChangedSeparator = ";"
+)
+
+// The columns of every row written as CSV. Notices name their kind in the type column and carry their JSON
+// serialisation in the data column, so that every row of a stream has the same columns.
+var csvColumns = []string{
+	"type",
+	"offset",
+	"partition",
+	"published_at",
+	"event_type",
+	"resource_kind",
+	"resource_id",
+	"resource_uri",
+	"company_number",
+	"fields_changed",
+	"data",
+}
+
+// Serialises the provided message as a row of CSV with a fixed set of columns, for users loading the stream into
+// spreadsheets. The data of the resource is written to a single column as JSON.
+type CSVSerialiser struct {
+	dataSerialiser Marshallable
+}
+
+// Construct a new CSV serialiser instance.
+func NewCSVSerialiser(dataSerialiser Marshallable) *CSVSerialiser {
+	return &CSVSerialiser{
+		dataSerialiser: dataSerialiser,
+	}
+}
+
+// Return the header row naming the columns of the rows serialised.
+func (s *CSVSerialiser) Header() string {
+	return csvRow(csvColumns)
+}
+
+// Serialise the provided data structure into a row of CSV.
+func (s *CSVSerialiser) Serialise(jsonData *json.ResourceChangedData) (string, error) {
+	data, err := s.dataSerialiser.Marshal(jsonData.Data)
+	if err != nil {
+		return "", err
+	}
+	return csvRow([]string{
+		csvRecordEvent,
+		strconv.FormatInt(jsonData.Event.Timepoint, 10),
+		strconv.FormatInt(int64(jsonData.Event.Partition), 10),
+		jsonData.Event.PublishedAt,
+		jsonData.Event.Type,
+		jsonData.ResourceKind,
+		jsonData.ResourceID,
+		jsonData.ResourceURI,
+		model.CompanyNumber(jsonData),
+		strings.Join(jsonData.Event.FieldsChanged, fieldsChangedSeparator),
+		string(data),
+	}), nil
+}
+
+// Serialise the notice into a row of CSV naming the notice in the type column, giving the partition and offset it
+// refers to where it has one and holding the notice in the data column.
+func (s *CSVSerialiser) SerialiseNotice(notice interface{}) (string, error) {
+	kind, err := noticeKind(notice)
+	if err != nil {
+		return "", err
+	}
+	data, err := s.dataSerialiser.Marshal(notice)
+	if err != nil {
+		return "", err
+	}
+	row := make([]string, len(csvColumns))
+	row[0] = kind
+	switch notice := notice.(type) {
+	case *json.Skipped:
+		row[1] = strconv.FormatInt(notice.Offset, 10)
+		row[2] = strconv.FormatInt(int64(notice.Partition), 10)
+	case *json.Gap:
+		row[1] = strconv.FormatInt(notice.FirstOffset, 10)
+		row[2] = strconv.FormatInt(int64(notice.Partition), 10)
+	}
+	row[len(row)-1] = string(data)
+	return csvRow(row), nil
+}
+
+func csvRow(fields []string) string {
+	var row strings.Builder
+	writer := csv.NewWriter(&row)
+	writer.UseCRLF = true
+	_ = writer.Write(fields)
+	writer.Flush()
+	return row.String()
+}
@@ -0,0 +1,50 @@
+package transformer
+
+import (
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSerialiseResourceChangedDataMessageAsCSV(t *testing.T) {
+	Convey("Given a new CSV serialiser instance", t, func() {
+		serialiser := NewCSVSerialiser(jsonproducer.Instance())
+		data := &rcd.ResourceChangedData{
+			ResourceKind: "company-officers",
+			ResourceURI:  "/company/00000001/appointments/abc",
+			ResourceID:   "abc",
+			Data:         map[string]interface{}{"name": "SMITH, John"},
+			Event: rcd.Event{
+				FieldsChanged: []string{"name", "occupation"},
+				Timepoint:     3,
+				Partition:     1,
+				PublishedAt:   "2021-01-01T00:00:00",
+				Type:          "changed",
+			},
+		}
+		Convey("When a resource changed data message is serialised", func() {
+			actual, err := serialiser.Serialise(data)
+			Convey("Then a row holding each column should be returned", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldEqual, `event,3,1,2021-01-01T00:00:00,changed,company-officers,abc,/company/00000001/appointments/abc,00000001,name;occupation,"{""name"":""SMITH, John""}"`+"\r\n")
+			})
+		})
+		Convey("When notices are serialised", func() {
+			gap, gapErr := serialiser.SerialiseNotice(&rcd.Gap{Partition: 2, FirstOffset: 10, LastOffset: 12, Dropped: 3})
+			heartbeat, heartbeatErr := serialiser.SerialiseNotice(&rcd.Heartbeat{HighWaterMarks: map[int32]int64{0: 5}})
+			Convey("Then rows naming each notice and holding it in the data column should be returned", func() {
+				So(gapErr, ShouldBeNil)
+				So(gap, ShouldEqual, `gap,10,2,,,,,,,,"{""partition"":2,""first_offset"":10,""last_offset"":12,""dropped"":3}"`+"\r\n")
+				So(heartbeatErr, ShouldBeNil)
+				So(heartbeat, ShouldEqual, `heartbeat,,,,,,,,,,"{""high_water_marks"":{""0"":5}}"`+"\r\n")
+			})
+		})
+		Convey("When the header row is requested", func() {
+			actual := serialiser.Header()
+			Convey("Then every column should be named", func() {
+				So(actual, ShouldEqual, "type,offset,partition,published_at,event_type,resource_kind,resource_id,resource_uri,company_number,fields_changed,data\r\n")
+			})
+		})
+	})
+}
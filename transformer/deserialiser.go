@@ -42,6 +42,7 @@ func (a *Deserialiser) Deserialise(model *model.BackendEvent) (*json.ResourceCha
 		Event: json.Event{
 			FieldsChanged: avroData.Event.FieldsChanged,
 			Timepoint:     model.Offset,
+			Partition:     model.Partition,
 			PublishedAt:   avroData.Event.PublishedAt,
 			Type:          avroData.Event.Type,
 		},
@@ -40,6 +40,7 @@ var expectedJsonData = rcd.ResourceChangedData{
 	Event: rcd.Event{
 		FieldsChanged: []string{"Field"},
 		Timepoint:     3,
+		Partition:     1,
 		PublishedAt:   "PublishedAt",
 		Type:          "Type",
 	},
@@ -66,7 +67,7 @@ func TestDeserialiseIncomingMessage(t *testing.T) {
 		dataDeserialiser.On("Unmarshal", []byte("Data"), mock.Anything).Return(nil)
 		deserialiser := NewDeserialiser(messageDeserialiser, dataDeserialiser)
 		Convey("When an incoming message is deserialised", func() {
-			actual, err := deserialiser.Deserialise(&model.BackendEvent{Data: []byte("cat"), Offset: 3})
+			actual, err := deserialiser.Deserialise(&model.BackendEvent{Data: []byte("cat"), Offset: 3, Partition: 1})
 			Convey("Then it should be deserialised into the expected data structure", func() {
 				So(err, ShouldBeNil)
 				So(actual, ShouldResemble, &expectedJsonData)
@@ -127,7 +128,7 @@ func TestReturnErrorIfDeserialisedMessageDataNotDeserialisable(t *testing.T) {
 		dataDeserialiser.On("Unmarshal", []byte("Data"), mock.Anything).Return(expectedError)
 		deserialiser := NewDeserialiser(messageDeserialiser, dataDeserialiser)
 		Convey("When an incoming message is deserialised", func() {
-			actual, err := deserialiser.Deserialise(&model.BackendEvent{Data: []byte("cat"), Offset: 3})
+			actual, err := deserialiser.Deserialise(&model.BackendEvent{Data: []byte("cat"), Offset: 3, Partition: 1})
 			Convey("Then it should be deserialised into the expected data structure", func() {
 				So(actual, ShouldBeNil)
 				So(err, ShouldEqual, expectedError)
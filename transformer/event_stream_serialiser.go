@@ -0,0 +1,37 @@
+package transformer
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"strings"
+)
+
+// Serialises the provided message as a server-sent event that can be consumed by EventSource clients.
+type EventStreamSerialiser struct {
+	resourceDataSerialiser Marshallable
+}
+
+// Construct a new event stream serialiser instance.
+func NewEventStreamSerialiser(resourceDataSerialiser Marshallable) *EventStreamSerialiser {
+	return &EventStreamSerialiser{
+		resourceDataSerialiser: resourceDataSerialiser,
+	}
+}
+
+// Serialise the provided data structure into the event and data fields of a server-sent event. The id field is left
+// to the caller as it depends on the position the user has reached across every partition of the topic.
+func (s *EventStreamSerialiser) Serialise(jsonData *json.ResourceChangedData) (string, error) {
+	data, err := s.resourceDataSerialiser.Marshal(jsonData)
+	if err != nil {
+		return "", err
+	}
+	var event strings.Builder
+	if jsonData.Event.Type != "" {
+		event.WriteString(fmt.Sprintf("event: %s\n", jsonData.Event.Type))
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		event.WriteString(fmt.Sprintf("data: %s\n", line))
+	}
+	event.WriteString("\n")
+	return event.String(), nil
+}
@@ -0,0 +1,68 @@
+package transformer
+
+import (
+	"errors"
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func TestCreateNewEventStreamSerialiser(t *testing.T) {
+	Convey("When a new event stream serialiser instance is created", t, func() {
+		dataSerialiser := &mockDataSerialiser{}
+		actual := NewEventStreamSerialiser(dataSerialiser)
+		Convey("Then a new event stream serialiser reference should be returned", func() {
+			So(actual, ShouldNotBeNil)
+			So(actual.resourceDataSerialiser, ShouldEqual, dataSerialiser)
+		})
+	})
+}
+
+func TestSerialiseResourceChangedDataMessageAsServerSentEvent(t *testing.T) {
+	Convey("Given a new event stream serialiser instance", t, func() {
+		dataSerialiser := &mockDataSerialiser{}
+		dataSerialiser.On("Marshal", mock.Anything).Return([]byte(`{"resource_kind":"kind"}`), nil)
+		data := &rcd.ResourceChangedData{Event: rcd.Event{Timepoint: 3, Type: "changed"}}
+		serialiser := NewEventStreamSerialiser(dataSerialiser)
+		Convey("When a resource changed data message is serialised", func() {
+			actual, err := serialiser.Serialise(data)
+			Convey("Then the event type and data fields should be returned", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldEqual, "event: changed\ndata: {\"resource_kind\":\"kind\"}\n\n")
+				So(dataSerialiser.AssertCalled(t, "Marshal", data), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestSplitMultilineDataIntoSeparateFields(t *testing.T) {
+	Convey("Given a new event stream serialiser instance that produces multiline output", t, func() {
+		dataSerialiser := &mockDataSerialiser{}
+		dataSerialiser.On("Marshal", mock.Anything).Return([]byte("{\n}"), nil)
+		data := &rcd.ResourceChangedData{}
+		serialiser := NewEventStreamSerialiser(dataSerialiser)
+		Convey("When a message without an event type is serialised", func() {
+			actual, err := serialiser.Serialise(data)
+			Convey("Then each line should be written as a data field and the event field omitted", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldEqual, "data: {\ndata: }\n\n")
+			})
+		})
+	})
+}
+
+func TestRaiseErrorIfServerSentEventDataCannotBeSerialised(t *testing.T) {
+	Convey("Given a new event stream serialiser instance", t, func() {
+		expectedError := errors.New("something went wrong")
+		dataSerialiser := &mockDataSerialiser{}
+		dataSerialiser.On("Marshal", mock.Anything).Return([]byte(nil), expectedError)
+		serialiser := NewEventStreamSerialiser(dataSerialiser)
+		Convey("When a resource changed data message is serialised", func() {
+			_, err := serialiser.Serialise(&rcd.ResourceChangedData{})
+			Convey("Then the error should be returned", func() {
+				So(err, ShouldEqual, expectedError)
+			})
+		})
+	})
+}
@@ -0,0 +1,51 @@
+package transformer
+
+import (
+	encoding "encoding/json"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+)
+
+// Serialises the provided message as a newline delimited JSON record embedding the resource as an object, rather than
+// as the string of JSON carried by the records of the Serialiser.
+type NDJSONSerialiser struct {
+	resourceDataSerialiser Marshallable
+	recordSerialiser       Marshallable
+}
+
+// A message written as newline delimited JSON.
+type Record struct {
+	Data      encoding.RawMessage `json:"data"`
+	Offset    int64               `json:"offset"`
+	Partition int32               `json:"partition"`
+}
+
+// Construct a new newline delimited JSON serialiser instance.
+func NewNDJSONSerialiser(resourceDataSerialiser Marshallable, recordSerialiser Marshallable) *NDJSONSerialiser {
+	return &NDJSONSerialiser{
+		resourceDataSerialiser: resourceDataSerialiser,
+		recordSerialiser:       recordSerialiser,
+	}
+}
+
+// Serialise the provided data structure into a newline delimited JSON record.
+func (s *NDJSONSerialiser) Serialise(jsonData *json.ResourceChangedData) (string, error) {
+	data, err := s.resourceDataSerialiser.Marshal(jsonData)
+	if err != nil {
+		return "", err
+	}
+	record, err := s.recordSerialiser.Marshal(&Record{
+		Data:      data,
+		Offset:    jsonData.Event.Timepoint,
+		Partition: jsonData.Event.Partition,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(record) + "\n", nil
+}
+
+// Serialise the notice into a newline delimited JSON record holding the notice under its name, e.g.
+// {"heartbeat":{...}}.
+func (s *NDJSONSerialiser) SerialiseNotice(notice interface{}) (string, error) {
+	return jsonNotice(s.recordSerialiser, notice)
+}
@@ -0,0 +1,38 @@
+package transformer
+
+import (
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSerialiseResourceChangedDataMessageAsNDJSON(t *testing.T) {
+	Convey("Given a new newline delimited JSON serialiser instance", t, func() {
+		serialiser := NewNDJSONSerialiser(jsonproducer.Instance(), jsonproducer.Instance())
+		data := &rcd.ResourceChangedData{
+			ResourceKind: "kind",
+			Data:         map[string]interface{}{"key": "value"},
+			Event:        rcd.Event{Timepoint: 3, Partition: 1, Type: "changed"},
+		}
+		Convey("When a resource changed data message is serialised", func() {
+			actual, err := serialiser.Serialise(data)
+			Convey("Then a record embedding the resource as an object should be returned", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldEqual, `{"data":{"resource_kind":"kind","resource_uri":"","resource_id":"","data":{"key":"value"},"event":{"timepoint":3,"partition":1,"published_at":"","type":"changed"}},"offset":3,"partition":1}`+"\n")
+			})
+		})
+		Convey("When notices are serialised", func() {
+			skipped, skippedErr := serialiser.SerialiseNotice(&rcd.Skipped{Partition: 1, Offset: 4})
+			end, endErr := serialiser.SerialiseNotice(&rcd.EndOfStream{Reason: "limit", ResumeFrom: "1:5"})
+			_, unsupportedErr := serialiser.SerialiseNotice("notice")
+			Convey("Then records holding each notice under its name should be returned", func() {
+				So(skippedErr, ShouldBeNil)
+				So(skipped, ShouldEqual, `{"skipped":{"partition":1,"offset":4}}`+"\n")
+				So(endErr, ShouldBeNil)
+				So(end, ShouldEqual, `{"end_of_stream":{"reason":"limit","resume_from":"1:5"}}`+"\n")
+				So(unsupportedErr.Error(), ShouldEqual, "unsupported notice: string")
+			})
+		})
+	})
+}
@@ -0,0 +1,42 @@
+package transformer
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+)
+
+const (
+	noticeHeartbeat   = "heartbeat"
+	noticeSkipped     = "skipped"
+	noticeGap         = "gap"
+	noticeEndOfStream = "end_of_stream"
+)
+
+// Return the name a notice is written to a stream under.
+func noticeKind(notice interface{}) (string, error) {
+	switch notice.(type) {
+	case *json.Heartbeat:
+		return noticeHeartbeat, nil
+	case *json.Skipped:
+		return noticeSkipped, nil
+	case *json.Gap:
+		return noticeGap, nil
+	case *json.EndOfStream:
+		return noticeEndOfStream, nil
+	default:
+		return "", fmt.Errorf("unsupported notice: %T", notice)
+	}
+}
+
+// Serialise the notice into a JSON record holding the notice under its name, e.g. {"heartbeat":{...}}.
+func jsonNotice(recordSerialiser Marshallable, notice interface{}) (string, error) {
+	kind, err := noticeKind(notice)
+	if err != nil {
+		return "", err
+	}
+	record, err := recordSerialiser.Marshal(map[string]interface{}{kind: notice})
+	if err != nil {
+		return "", err
+	}
+	return string(record) + "\n", nil
+}
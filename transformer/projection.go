@@ -0,0 +1,145 @@
+package transformer
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"strings"
+)
+
+const (
+	projectionFieldSeparator = ","
+	projectionPathSeparator  = "."
+	dataField                = "data"
+)
+
+// The fields of the resource changed data entity that may be projected, and the fields within each that may be
+// projected in turn. The fields within data vary by resource kind and are not checked.
+var projectableFields = map[string]map[string]bool{
+	"resource_kind": nil,
+	"resource_uri":  nil,
+	"resource_id":   nil,
+	dataField:       nil,
+	"event": {
+		"fields_changed": true,
+		"timepoint":      true,
+		"partition":      true,
+		"published_at":   true,
+		"type":           true,
+	},
+}
+
+// Marshals a resource changed data entity keeping only the fields requested by the user, given as dotted paths such
+// as "event.type" or "data.links.self". Requested fields missing from an entity are omitted from it.
+type Projection struct {
+	root         *projectionNode
+	serialiser   Marshallable
+	deserialiser Unmarshallable
+}
+
+// The requested fields beneath a field of the entity. A field is kept whole if it was requested itself rather than
+// only fields beneath it.
+type projectionNode struct {
+	whole    bool
+	children map[string]*projectionNode
+}
+
+// Parse a projection from a comma separated list of dotted paths, e.g. "resource_id,event.type,data.links.self". An
+// error is returned if a path does not name a field of the resource changed data entity. Nil is returned if no paths
+// are given, in which case the whole entity should be serialised.
+func ParseProjection(input string) (*Projection, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	root := &projectionNode{children: make(map[string]*projectionNode)}
+	for _, field := range strings.Split(input, projectionFieldSeparator) {
+		field = strings.TrimSpace(field)
+		path := strings.Split(field, projectionPathSeparator)
+		if err := validatePath(field, path); err != nil {
+			return nil, err
+		}
+		root.add(path)
+	}
+	return &Projection{
+		root:         root,
+		serialiser:   jsonproducer.Instance(),
+		deserialiser: jsonproducer.Instance(),
+	}, nil
+}
+
+// Marshal the input into JSON keeping only the requested fields.
+func (p *Projection) Marshal(input interface{}) ([]byte, error) {
+	data, err := p.serialiser.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err := p.deserialiser.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	projected, _ := p.root.project(document)
+	if projected == nil {
+		projected = map[string]interface{}{}
+	}
+	return p.serialiser.Marshal(projected)
+}
+
+func validatePath(field string, path []string) error {
+	for _, segment := range path {
+		if segment == "" {
+			return fmt.Errorf("invalid field: %s", field)
+		}
+	}
+	children, ok := projectableFields[path[0]]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", field)
+	}
+	if len(path) == 1 || path[0] == dataField {
+		return nil
+	}
+	if len(path) > 2 || !children[path[1]] {
+		return fmt.Errorf("unknown field: %s", field)
+	}
+	return nil
+}
+
+func (n *projectionNode) add(path []string) {
+	if n.whole {
+		return
+	}
+	if len(path) == 0 {
+		n.whole = true
+		n.children = nil
+		return
+	}
+	child, ok := n.children[path[0]]
+	if !ok {
+		child = &projectionNode{children: make(map[string]*projectionNode)}
+		n.children[path[0]] = child
+	}
+	child.add(path[1:])
+}
+
+// Return the parts of the value beneath the node that were requested, and false if none of them are present.
+func (n *projectionNode) project(value interface{}) (interface{}, bool) {
+	if n.whole {
+		return value, true
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	projected := make(map[string]interface{})
+	for name, child := range n.children {
+		field, ok := object[name]
+		if !ok {
+			continue
+		}
+		if kept, ok := child.project(field); ok {
+			projected[name] = kept
+		}
+	}
+	if len(projected) == 0 {
+		return nil, false
+	}
+	return projected, true
+}
@@ -0,0 +1,64 @@
+package transformer
+
+import (
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseEmptyProjection(t *testing.T) {
+	Convey("When an empty list of fields is parsed", t, func() {
+		actual, err := ParseProjection(" ")
+		Convey("Then no projection should be returned", func() {
+			So(err, ShouldBeNil)
+			So(actual, ShouldBeNil)
+		})
+	})
+}
+
+func TestReturnErrorIfProjectedFieldUnknown(t *testing.T) {
+	Convey("When fields that are not part of the entity are parsed", t, func() {
+		_, unknownErr := ParseProjection("resource_id,company_number")
+		_, eventErr := ParseProjection("event.source")
+		_, scalarErr := ParseProjection("resource_kind.name")
+		_, emptyErr := ParseProjection("data..links")
+		Convey("Then an error should be returned", func() {
+			So(unknownErr.Error(), ShouldEqual, "unknown field: company_number")
+			So(eventErr.Error(), ShouldEqual, "unknown field: event.source")
+			So(scalarErr.Error(), ShouldEqual, "unknown field: resource_kind.name")
+			So(emptyErr.Error(), ShouldEqual, "invalid field: data..links")
+		})
+	})
+}
+
+func TestMarshalProjectedFields(t *testing.T) {
+	Convey("Given a resource changed data entity", t, func() {
+		data := &rcd.ResourceChangedData{
+			ResourceKind: "company-officers",
+			ResourceID:   "abc",
+			Data: map[string]interface{}{
+				"company_number":    "00000001",
+				"date_of_cessation": "2021-01-01",
+				"links":             map[string]interface{}{"self": "/company/00000001/appointments/abc", "officer": "/officers/xyz"},
+			},
+			Event: rcd.Event{Timepoint: 3, Type: "changed"},
+		}
+		Convey("When it is marshalled keeping only the requested fields", func() {
+			projection, err := ParseProjection("resource_id, event.type,data.links.self,data.company_number,data.missing")
+			So(err, ShouldBeNil)
+			actual, err := projection.Marshal(data)
+			Convey("Then only the requested fields present in the entity should be kept", func() {
+				So(err, ShouldBeNil)
+				So(string(actual), ShouldEqual, `{"data":{"company_number":"00000001","links":{"self":"/company/00000001/appointments/abc"}},"event":{"type":"changed"},"resource_id":"abc"}`)
+			})
+		})
+		Convey("When it is marshalled keeping a field and a field beneath it", func() {
+			projection, _ := ParseProjection("data.links.self,data.links")
+			actual, err := projection.Marshal(data)
+			Convey("Then the whole of the field should be kept", func() {
+				So(err, ShouldBeNil)
+				So(string(actual), ShouldEqual, `{"data":{"links":{"officer":"/officers/xyz","self":"/company/00000001/appointments/abc"}}}`)
+			})
+		})
+	})
+}
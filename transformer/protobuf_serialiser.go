@@ -0,0 +1,67 @@
+package transformer
+
+import (
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/model/json"
+	pb "github.com/companieshouse/chs-streaming-api-backend/streamingpb"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Serialises the provided message as a SubscribeResponse of the gRPC streaming contract, prefixed with its length as a
+// varint so that a stream of them can be read from a single response body.
+type ProtobufSerialiser struct {
+}
+
+// Construct a new protobuf serialiser instance.
+func NewProtobufSerialiser() *ProtobufSerialiser {
+	return &ProtobufSerialiser{}
+}
+
+// Serialise the provided data structure into a length delimited SubscribeResponse carrying the resource.
+func (s *ProtobufSerialiser) Serialise(jsonData *json.ResourceChangedData) (string, error) {
+	resource, err := pb.NewResourceChangedData(jsonData)
+	if err != nil {
+		return "", err
+	}
+	return delimited(&pb.SubscribeResponse{
+		Payload: &pb.SubscribeResponse_Event{Event: &pb.ResourceEvent{
+			Partition: jsonData.Event.Partition,
+			Offset:    jsonData.Event.Timepoint,
+			Resource:  resource,
+		}},
+	})
+}
+
+// Serialise the notice into a length delimited SubscribeResponse carrying the notice. End of stream markers give the
+// cursor to resume from in the resume_from field of the response.
+func (s *ProtobufSerialiser) SerialiseNotice(notice interface{}) (string, error) {
+	response := &pb.SubscribeResponse{}
+	switch notice := notice.(type) {
+	case *json.Heartbeat:
+		response.Payload = &pb.SubscribeResponse_Heartbeat{Heartbeat: &pb.Heartbeat{HighWaterMarks: notice.HighWaterMarks}}
+	case *json.Skipped:
+		response.Payload = &pb.SubscribeResponse_Skipped{Skipped: &pb.Skipped{Partition: notice.Partition, Offset: notice.Offset}}
+	case *json.Gap:
+		response.Payload = &pb.SubscribeResponse_Gap{Gap: &pb.Gap{
+			Partition:   notice.Partition,
+			FirstOffset: notice.FirstOffset,
+			LastOffset:  notice.LastOffset,
+			Dropped:     int32(notice.Dropped),
+		}}
+	case *json.EndOfStream:
+		response.ResumeFrom = notice.ResumeFrom
+		response.Payload = &pb.SubscribeResponse_EndOfStream{EndOfStream: &pb.EndOfStream{Reason: notice.Reason}}
+	default:
+		return "", fmt.Errorf("unsupported notice: %T", notice)
+	}
+	return delimited(response)
+}
+
+func delimited(message proto.Message) (string, error) {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	return string(append(protowire.AppendVarint(nil, uint64(len(data))), data...)), nil
+}
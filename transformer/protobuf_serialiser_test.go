@@ -0,0 +1,59 @@
+package transformer
+
+import (
+	rcd "github.com/companieshouse/chs-streaming-api-backend/model/json"
+	pb "github.com/companieshouse/chs-streaming-api-backend/streamingpb"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+// Read a single length delimited response from the serialised output.
+func readDelimited(output string) *pb.SubscribeResponse {
+	length, n := protowire.ConsumeVarint([]byte(output))
+	So(n, ShouldBeGreaterThan, 0)
+	So(len(output)-n, ShouldEqual, length)
+	response := &pb.SubscribeResponse{}
+	So(proto.Unmarshal([]byte(output[n:]), response), ShouldBeNil)
+	return response
+}
+
+func TestSerialiseResourceChangedDataMessageAsProtobuf(t *testing.T) {
+	Convey("Given a new protobuf serialiser instance", t, func() {
+		serialiser := NewProtobufSerialiser()
+		data := &rcd.ResourceChangedData{
+			ResourceKind: "kind",
+			ResourceID:   "id",
+			Data:         map[string]interface{}{"key": "value"},
+			Event:        rcd.Event{Timepoint: 3, Partition: 1, Type: "deleted"},
+		}
+		Convey("When a resource changed data message is serialised", func() {
+			actual, err := serialiser.Serialise(data)
+			Convey("Then a length delimited response carrying the resource should be returned", func() {
+				So(err, ShouldBeNil)
+				event := readDelimited(actual).GetEvent()
+				So(event.Offset, ShouldEqual, 3)
+				So(event.Partition, ShouldEqual, 1)
+				So(event.Resource.ResourceKind, ShouldEqual, "kind")
+				So(event.Resource.ResourceId, ShouldEqual, "id")
+				So(event.Resource.Data.AsMap(), ShouldResemble, map[string]interface{}{"key": "value"})
+				So(event.Resource.Event.Type, ShouldEqual, "deleted")
+			})
+		})
+		Convey("When notices are serialised", func() {
+			heartbeat, heartbeatErr := serialiser.SerialiseNotice(&rcd.Heartbeat{HighWaterMarks: map[int32]int64{0: 5}})
+			end, endErr := serialiser.SerialiseNotice(&rcd.EndOfStream{Reason: "server_closing", ResumeFrom: "0:6"})
+			_, unsupportedErr := serialiser.SerialiseNotice("notice")
+			Convey("Then length delimited responses carrying each notice should be returned", func() {
+				So(heartbeatErr, ShouldBeNil)
+				So(readDelimited(heartbeat).GetHeartbeat().HighWaterMarks, ShouldResemble, map[int32]int64{0: 5})
+				So(endErr, ShouldBeNil)
+				endResponse := readDelimited(end)
+				So(endResponse.ResumeFrom, ShouldEqual, "0:6")
+				So(endResponse.GetEndOfStream().Reason, ShouldEqual, "server_closing")
+				So(unsupportedErr.Error(), ShouldEqual, "unsupported notice: string")
+			})
+		})
+	})
+}
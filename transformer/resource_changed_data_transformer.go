@@ -23,6 +23,12 @@ type Serialisable interface {
 	Serialise(jsonData *json.ResourceChangedData) (string, error)
 }
 
+// Describes an object capable of serialising the notices written to a stream alongside its messages, i.e. heartbeats,
+// skipped messages, gaps and end of stream markers, in the same format as the messages.
+type NoticeSerialisable interface {
+	SerialiseNotice(notice interface{}) (string, error)
+}
+
 // Construct a new resource changed data transformer instance.
 func NewResourceChangedDataTransformer(deserialiser Deserialisable, serialiser Serialisable) *ResourceChangedDataTransformer {
 	return &ResourceChangedDataTransformer{
@@ -31,11 +37,21 @@ func NewResourceChangedDataTransformer(deserialiser Deserialisable, serialiser S
 	}
 }
 
-// Transform the provided resource changed data message into a format usable by streaming API cache.
-func (t *ResourceChangedDataTransformer) Transform(model *model.BackendEvent) (string, error) {
-	jsonData, err := t.deserialiser.Deserialise(model)
+// Transform the provided resource changed data message into a format usable by streaming API cache. The deserialised
+// resource is retained alongside the serialised message so that it can be rendered in other formats if required.
+func (t *ResourceChangedDataTransformer) Transform(message *model.BackendEvent) (*model.StreamEvent, error) {
+	jsonData, err := t.deserialiser.Deserialise(message)
+	if err != nil {
+		return nil, err
+	}
+	data, err := t.serialiser.Serialise(jsonData)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return t.serialiser.Serialise(jsonData)
+	return &model.StreamEvent{
+		Data:      data,
+		Resource:  jsonData,
+		Offset:    message.Offset,
+		Partition: message.Partition,
+	}, nil
 }
@@ -45,7 +45,8 @@ func TestTransformResourceChangedDataMessage(t *testing.T) {
 		Convey("When a resource changed data message is transformed", func() {
 			actual, err := transformer.Transform(event)
 			Convey("Then the expected result should be returned", func() {
-				So(actual, ShouldResemble, "result")
+				So(actual, ShouldResemble, &model.StreamEvent{Data: "result", Resource: data, Offset: 3})
+				So(actual.Resource, ShouldEqual, data)
 				So(err, ShouldBeNil)
 				So(deserialiser.AssertCalled(t, "Deserialise", event), ShouldBeTrue)
 				So(serialiser.AssertCalled(t, "Serialise", data), ShouldBeTrue)
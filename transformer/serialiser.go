@@ -10,8 +10,9 @@ type Serialiser struct {
 
 // The result of the operation.
 type Result struct {
-	Data   string `json:"data"`
-	Offset int64  `json:"offset"`
+	Data      string `json:"data"`
+	Offset    int64  `json:"offset"`
+	Partition int32  `json:"partition"`
 }
 
 // Describes an object capable of marshalling a data structure into a readable data exchange format.
@@ -33,9 +34,18 @@ func (s *Serialiser) Serialise(jsonData *json.ResourceChangedData) (string, erro
 	if err != nil {
 		return "", err
 	}
-	result, err := s.resultSerialiser.Marshal(&Result{Data: string(transformedData), Offset: jsonData.Event.Timepoint})
+	result, err := s.resultSerialiser.Marshal(&Result{
+		Data:      string(transformedData),
+		Offset:    jsonData.Event.Timepoint,
+		Partition: jsonData.Event.Partition,
+	})
 	if err != nil {
 		return "", err
 	}
 	return string(result) + "\n", nil
 }
+
+// Serialise the notice into a JSON record holding the notice under its name, e.g. {"heartbeat":{...}}.
+func (s *Serialiser) SerialiseNotice(notice interface{}) (string, error) {
+	return jsonNotice(s.resultSerialiser, notice)
+}
@@ -35,7 +35,7 @@ func TestSerialiseResourceChangedDataMessage(t *testing.T) {
 		dataSerialiser.On("Marshal", mock.Anything).Return([]byte("data"), nil)
 		resultSerialiser := &mockResultSerialiser{}
 		resultSerialiser.On("Marshal", mock.Anything).Return([]byte("result"), nil)
-		data := &rcd.ResourceChangedData{Event: rcd.Event{Timepoint: 3}}
+		data := &rcd.ResourceChangedData{Event: rcd.Event{Timepoint: 3, Partition: 1}}
 		serialiser := NewSerialiser(dataSerialiser, resultSerialiser)
 		Convey("When a resource changed data message is serialised as a result", func() {
 			actual, err := serialiser.Serialise(data)
@@ -45,8 +45,9 @@ func TestSerialiseResourceChangedDataMessage(t *testing.T) {
 				So(actual, ShouldResemble, "result\n")
 				So(dataSerialiser.AssertCalled(t, "Marshal", data), ShouldBeTrue)
 				So(resultSerialiser.AssertCalled(t, "Marshal", &Result{
-					Data:   "data",
-					Offset: 3,
+					Data:      "data",
+					Offset:    3,
+					Partition: 1,
 				}), ShouldBeTrue)
 			})
 		})
@@ -59,7 +60,7 @@ func TestRaiseErrorIfDataCannotBeSerialised(t *testing.T) {
 		dataSerialiser := &mockDataSerialiser{}
 		dataSerialiser.On("Marshal", mock.Anything).Return([]byte(nil), expectedError)
 		resultSerialiser := &mockResultSerialiser{}
-		data := &rcd.ResourceChangedData{Event: rcd.Event{Timepoint: 3}}
+		data := &rcd.ResourceChangedData{Event: rcd.Event{Timepoint: 3, Partition: 1}}
 		serialiser := NewSerialiser(dataSerialiser, resultSerialiser)
 		Convey("When a resource changed data message is serialised as a result", func() {
 			_, err := serialiser.Serialise(data)
@@ -79,7 +80,7 @@ func TestRaiseErrorIfResultCannotBeSerialised(t *testing.T) {
 		dataSerialiser.On("Marshal", mock.Anything).Return([]byte("data"), nil)
 		resultSerialiser := &mockResultSerialiser{}
 		resultSerialiser.On("Marshal", mock.Anything).Return([]byte(nil), expectedError)
-		data := &rcd.ResourceChangedData{Event: rcd.Event{Timepoint: 3}}
+		data := &rcd.ResourceChangedData{Event: rcd.Event{Timepoint: 3, Partition: 1}}
 		serialiser := NewSerialiser(dataSerialiser, resultSerialiser)
 		Convey("When a resource changed data message is serialised as a result", func() {
 			_, err := serialiser.Serialise(data)
@@ -87,14 +88,32 @@ func TestRaiseErrorIfResultCannotBeSerialised(t *testing.T) {
 				So(err, ShouldEqual, expectedError)
 				So(dataSerialiser.AssertCalled(t, "Marshal", data), ShouldBeTrue)
 				So(resultSerialiser.AssertCalled(t, "Marshal", &Result{
-					Data:   "data",
-					Offset: 3,
+					Data:      "data",
+					Offset:    3,
+					Partition: 1,
 				}), ShouldBeTrue)
 			})
 		})
 	})
 }
 
+func TestSerialiseNoticeAsJSONRecord(t *testing.T) {
+	Convey("Given a new serialiser instance", t, func() {
+		resultSerialiser := &mockResultSerialiser{}
+		resultSerialiser.On("Marshal", mock.Anything).Return([]byte(`{"heartbeat":{}}`), nil)
+		serialiser := NewSerialiser(&mockDataSerialiser{}, resultSerialiser)
+		heartbeat := &rcd.Heartbeat{}
+		Convey("When a notice is serialised", func() {
+			actual, err := serialiser.SerialiseNotice(heartbeat)
+			Convey("Then a record holding the notice under its name should be returned", func() {
+				So(err, ShouldBeNil)
+				So(actual, ShouldEqual, `{"heartbeat":{}}`+"\n")
+				So(resultSerialiser.AssertCalled(t, "Marshal", map[string]interface{}{"heartbeat": heartbeat}), ShouldBeTrue)
+			})
+		})
+	})
+}
+
 func (s *mockDataSerialiser) Marshal(input interface{}) ([]byte, error) {
 	args := s.Called(input)
 	return args.Get(0).([]byte), args.Error(1)
@@ -0,0 +1,154 @@
+package transformer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/companieshouse/chs-streaming-api-backend/schemaregistry"
+	"github.com/linkedin/goavro/v2"
+	"sync"
+	"time"
+)
+
+const (
+	// The first byte of a message serialised in the schema registry wire format
+	magicByte = 0
+	// The length of the magic byte and schema ID preceding the Avro encoded message
+	wireFormatHeaderLength = 5
+	// How long a schema ID the registry does not hold is remembered for before the registry is asked for it again
+	missingSchemaTTL = time.Minute
+)
+
+// Describes an object capable of fetching the definition of a schema from the schema registry by its ID.
+type SchemaFetchable interface {
+	SchemaByID(id int32) (string, error)
+}
+
+// Describes the schema messages are read with, whose definition may change while the application is running.
+type Schemable interface {
+	Unmarshallable
+	Definition() string
+}
+
+// Deserialises Avro messages serialised in the schema registry wire format, in which the message is preceded by a
+// magic byte and the ID of the schema it was written with. Messages are resolved from the schema they were written
+// with to the schema the application reads, so that fields added by producers are ignored and fields they have
+// removed take their default values. Messages without the magic byte are assumed to have been written with the
+// application's schema, as are messages whose apparent schema ID is unknown to the registry: a raw Avro message also
+// starts with a zero byte if its first field is, e.g., an empty string or zero.
+type WireFormatDeserialiser struct {
+	registry     SchemaFetchable
+	reader       Schemable
+	lock         sync.Mutex
+	readerSchema string
+	readerCodec  *goavro.Codec
+	writers      map[int32]*goavro.Codec
+	missing      map[int32]time.Time
+}
+
+// Construct a new wire format deserialiser instance reading messages with the given schema.
+func NewWireFormatDeserialiser(registry SchemaFetchable, reader Schemable) *WireFormatDeserialiser {
+	return &WireFormatDeserialiser{
+		registry: registry,
+		reader:   reader,
+		writers:  make(map[int32]*goavro.Codec),
+		missing:  make(map[int32]time.Time),
+	}
+}
+
+// Unmarshal the message into the given data structure, resolving it from the schema it was written with first.
+func (d *WireFormatDeserialiser) Unmarshal(input []byte, model interface{}) error {
+	if len(input) < wireFormatHeaderLength || input[0] != magicByte {
+		return d.reader.Unmarshal(input, model)
+	}
+	id := int32(binary.BigEndian.Uint32(input[1:wireFormatHeaderLength]))
+	if d.isMissing(id) {
+		return d.reader.Unmarshal(input, model)
+	}
+	resolved, err := d.resolve(id, input[wireFormatHeaderLength:])
+	var notFound *schemaregistry.SchemaNotFoundError
+	if errors.As(err, &notFound) {
+		d.lock.Lock()
+		d.missing[id] = time.Now().Add(missingSchemaTTL)
+		d.lock.Unlock()
+		return d.reader.Unmarshal(input, model)
+	}
+	if err != nil {
+		return err
+	}
+	return d.reader.Unmarshal(resolved, model)
+}
+
+// Return true if the registry has recently been found not to hold the schema of the given ID, so that raw messages
+// that happen to start with a zero byte do not each wait on a request to the registry.
+func (d *WireFormatDeserialiser) isMissing(id int32) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	expiry, ok := d.missing[id]
+	if ok && time.Now().After(expiry) {
+		delete(d.missing, id)
+		return false
+	}
+	return ok
+}
+
+// Re-encode a message written with the schema of the given ID using the application's schema.
+func (d *WireFormatDeserialiser) resolve(id int32, message []byte) ([]byte, error) {
+	readerCodec, err := d.readerSchemaCodec()
+	if err != nil {
+		return nil, err
+	}
+	writerCodec, err := d.writerCodec(id)
+	if err != nil {
+		return nil, err
+	}
+	if writerCodec.CanonicalSchema() == readerCodec.CanonicalSchema() {
+		return message, nil
+	}
+	native, _, err := writerCodec.NativeFromBinary(message)
+	if err != nil {
+		return nil, fmt.Errorf("message could not be decoded with schema %d: %s", id, err)
+	}
+	resolved, err := readerCodec.BinaryFromNative(nil, native)
+	if err != nil {
+		return nil, fmt.Errorf("message written with schema %d could not be resolved to the schema read: %s", id, err)
+	}
+	return resolved, nil
+}
+
+// Return the codec for the schema messages are read with, parsing it again if its definition has changed.
+func (d *WireFormatDeserialiser) readerSchemaCodec() (*goavro.Codec, error) {
+	definition := d.reader.Definition()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.readerCodec == nil || d.readerSchema != definition {
+		codec, err := goavro.NewCodec(definition)
+		if err != nil {
+			return nil, fmt.Errorf("schema read could not be parsed: %s", err)
+		}
+		d.readerCodec, d.readerSchema = codec, definition
+	}
+	return d.readerCodec, nil
+}
+
+// Return the codec for the schema of the given ID, fetching the schema from the registry if it has not been used
+// before.
+func (d *WireFormatDeserialiser) writerCodec(id int32) (*goavro.Codec, error) {
+	d.lock.Lock()
+	codec, ok := d.writers[id]
+	d.lock.Unlock()
+	if ok {
+		return codec, nil
+	}
+	schema, err := d.registry.SchemaByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if codec, err = goavro.NewCodec(schema); err != nil {
+		return nil, fmt.Errorf("schema %d could not be parsed: %s", id, err)
+	}
+	d.lock.Lock()
+	d.writers[id] = codec
+	d.lock.Unlock()
+	return codec, nil
+}
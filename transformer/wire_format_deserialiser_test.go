@@ -0,0 +1,196 @@
+package transformer
+
+import (
+	"encoding/binary"
+	"github.com/companieshouse/chs-streaming-api-backend/model/avro"
+	"github.com/companieshouse/chs-streaming-api-backend/schemaregistry"
+	"github.com/companieshouse/chs-streaming-api-backend/transformer/jsonproducer"
+	"github.com/linkedin/goavro/v2"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockReader struct {
+	mock.Mock
+}
+
+// The schema read by the application.
+const readerSchema = `{"type":"record","name":"resource_changed_data","fields":[
+	{"name":"resource_kind","type":"string"},
+	{"name":"context_id","type":"string","default":"unknown"},
+	{"name":"data","type":"string"}]}`
+
+// A later version of the schema that has dropped the context ID and added a field.
+const writerSchema = `{"type":"record","name":"resource_changed_data","fields":[
+	{"name":"resource_kind","type":"string"},
+	{"name":"data","type":"string"},
+	{"name":"source","type":"string"}]}`
+
+func TestCreateNewWireFormatDeserialiser(t *testing.T) {
+	Convey("When a new wire format deserialiser instance is created", t, func() {
+		registry := schemaregistry.NewClient("http://schema-registry")
+		schema := schemaregistry.NewSchema(readerSchema)
+		actual := NewWireFormatDeserialiser(registry, schema)
+		Convey("Then a new wire format deserialiser instance should be returned", func() {
+			So(actual.registry, ShouldEqual, registry)
+			So(actual.reader, ShouldEqual, schema)
+			So(actual.readerCodec, ShouldBeNil)
+			So(actual.writers, ShouldBeEmpty)
+			So(actual.missing, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestResolveMessageFromWriterSchema(t *testing.T) {
+	Convey("Given a message written with a later version of the schema registered as schema 12", t, func() {
+		registry := fakeRegistry(map[string]string{"12": writerSchema, "13": readerSchema})
+		defer registry.Close()
+		deserialiser, reader := newTestWireFormatDeserialiser(registry.URL)
+		message := wireFormat(12, writerSchema, map[string]interface{}{
+			"resource_kind": "company-profile",
+			"data":          "{}",
+			"source":        "producer",
+		})
+		Convey("When the message is deserialised", func() {
+			err := deserialiser.Unmarshal(message, &avro.ResourceChangedData{})
+			Convey("Then it should be resolved to the schema read before being decoded", func() {
+				So(err, ShouldBeNil)
+				native := decode(reader.Calls[0].Arguments.Get(0).([]byte))
+				So(native, ShouldResemble, map[string]interface{}{
+					"resource_kind": "company-profile",
+					"context_id":    "unknown",
+					"data":          "{}",
+				})
+				So(deserialiser.writers, ShouldContainKey, int32(12))
+			})
+		})
+		Convey("When a message written with the schema read is deserialised", func() {
+			original := wireFormat(13, readerSchema, map[string]interface{}{
+				"resource_kind": "company-profile",
+				"context_id":    "abc",
+				"data":          "{}",
+			})
+			err := deserialiser.Unmarshal(original, &avro.ResourceChangedData{})
+			Convey("Then it should be decoded as it is", func() {
+				So(err, ShouldBeNil)
+				So(reader.Calls[0].Arguments.Get(0), ShouldResemble, original[5:])
+			})
+		})
+	})
+}
+
+func TestDeserialiseMessageWithoutSchemaID(t *testing.T) {
+	Convey("Given a message that is not in the wire format", t, func() {
+		deserialiser, reader := newTestWireFormatDeserialiser("http://schema-registry")
+		message := []byte{2, 'a'}
+		Convey("When the message is deserialised", func() {
+			err := deserialiser.Unmarshal(message, &avro.ResourceChangedData{})
+			Convey("Then it should be decoded with the schema read", func() {
+				So(err, ShouldBeNil)
+				So(reader.Calls[0].Arguments.Get(0), ShouldResemble, message)
+			})
+		})
+	})
+}
+
+func TestDeserialiseMessageStartingWithZeroWithoutSchemaID(t *testing.T) {
+	Convey("Given messages not in the wire format whose first field is empty", t, func() {
+		var requests int32
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer registry.Close()
+		deserialiser, reader := newTestWireFormatDeserialiser(registry.URL)
+		message := []byte{0, 0, 0, 0, 99, 2, 'a'}
+		Convey("When two such messages are deserialised", func() {
+			firstErr := deserialiser.Unmarshal(message, &avro.ResourceChangedData{})
+			secondErr := deserialiser.Unmarshal(message, &avro.ResourceChangedData{})
+			Convey("Then both should be decoded with the schema read, asking the registry for the schema only once", func() {
+				So(firstErr, ShouldBeNil)
+				So(secondErr, ShouldBeNil)
+				So(reader.Calls[0].Arguments.Get(0), ShouldResemble, message)
+				So(reader.Calls[1].Arguments.Get(0), ShouldResemble, message)
+				So(atomic.LoadInt32(&requests), ShouldEqual, 1)
+			})
+		})
+		Convey("When such a message is deserialised after the schema ID was last found missing too long ago", func() {
+			deserialiser.missing[99] = time.Now().Add(-time.Second)
+			err := deserialiser.Unmarshal(message, &avro.ResourceChangedData{})
+			Convey("Then the registry should be asked for the schema again", func() {
+				So(err, ShouldBeNil)
+				So(atomic.LoadInt32(&requests), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestReturnErrorIfWriterSchemaUnavailable(t *testing.T) {
+	Convey("Given a message written with a schema while the registry is failing", t, func() {
+		registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer registry.Close()
+		deserialiser, reader := newTestWireFormatDeserialiser(registry.URL)
+		Convey("When the message is deserialised", func() {
+			err := deserialiser.Unmarshal([]byte{0, 0, 0, 0, 99, 2, 'a'}, &avro.ResourceChangedData{})
+			Convey("Then an error should be returned", func() {
+				So(err.Error(), ShouldEqual, "schema 99 could not be fetched from the schema registry: 503 Service Unavailable")
+				So(reader.AssertNotCalled(t, "Unmarshal", mock.Anything, mock.Anything), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func newTestWireFormatDeserialiser(url string) (*WireFormatDeserialiser, *mockReader) {
+	reader := &mockReader{}
+	reader.On("Unmarshal", mock.Anything, mock.Anything).Return(nil)
+	return NewWireFormatDeserialiser(schemaregistry.NewClient(url), reader), reader
+}
+
+// Serve the given schemas, keyed by ID, in the form returned by a schema registry.
+func fakeRegistry(schemas map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		schema, ok := schemas[strings.TrimPrefix(r.URL.Path, "/schemas/ids/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		codec, _ := goavro.NewCodec(schema)
+		_, _ = w.Write([]byte(`{"schema":` + quote(codec.Schema()) + `}`))
+	}))
+}
+
+func wireFormat(id uint32, schema string, native map[string]interface{}) []byte {
+	codec, _ := goavro.NewCodec(schema)
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], id)
+	message, _ := codec.BinaryFromNative(header, native)
+	return message
+}
+
+func decode(message []byte) interface{} {
+	codec, _ := goavro.NewCodec(readerSchema)
+	native, _, _ := codec.NativeFromBinary(message)
+	return native
+}
+
+func quote(s string) string {
+	data, _ := jsonproducer.Instance().Marshal(s)
+	return string(data)
+}
+
+func (r *mockReader) Unmarshal(input []byte, model interface{}) error {
+	args := r.Called(input, model)
+	return args.Error(0)
+}
+
+func (r *mockReader) Definition() string {
+	return readerSchema
+}